@@ -0,0 +1,7 @@
+module SOA_log_collector
+
+go 1.24.1
+
+require go.etcd.io/bbolt v1.3.11
+
+require golang.org/x/sys v0.31.0 // indirect
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	maxLogSize          = 4 << 20               // Максимальный размер принимаемого лога
+	defaultQueryLimit   = 100                   // Число логов в ответе по умолчанию
+	maxLogSchemaVersion = 3                     // Последняя известная версия формата лога флешера
+	flasherTimeFormat   = "2006-01-02T15:04:05" // формат поля timestamp в логах флешера
+	maxClockSkew        = 24 * time.Hour        // насколько время лога может опережать время сервера
+	shutdownTimeout     = 10 * time.Second
+	readHeaderTimeout   = 10 * time.Second
+)
+
+// LogData - лог операции, который присылает MAC Flasher
+type LogData struct {
+	Timestamp       string            `json:"timestamp"`
+	ProductName     string            `json:"product_name"`
+	MacAddress      string            `json:"mac_address"`
+	ActionPerformed string            `json:"action_performed"`
+	Success         bool              `json:"success"`
+	SchemaVersion   int               `json:"schema_version"` // 0 - логи до введения версии (версия 1)
+	SystemInfo      json.RawMessage   `json:"system_info"`    // разбор зависит от версии, сервис хранит как есть
+	HostInfo        map[string]string `json:"host_info"`
+	PoolHashBefore  string            `json:"pool_hash_before,omitempty"`
+	PoolHashAfter   string            `json:"pool_hash_after,omitempty"`
+	Signature       *LogSignature     `json:"signature,omitempty"`
+}
+
+// LogSignature - подпись лога ключом станции. Сервис хранит её вместе с логом,
+// проверка выполняется в MAC Pool Manager по доверенным ключам станций
+type LogSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+	Value     string `json:"value"`
+}
+
+// collector - состояние сервиса
+type collector struct {
+	store     *LogStore
+	tokens    []string // допустимые токены Bearer
+	clientCAs bool     // клиенты проходят проверку сертификата (mTLS)
+	poolState string   // выгрузка пула для сверки
+}
+
+var macRegexp = regexp.MustCompile(`^([0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}$`)
+
+func main() {
+	listenPtr := flag.String("listen", ":8443", "Address to listen on")
+	dbPtr := flag.String("db", "collector.db", "Path to the log database")
+	certPtr := flag.String("tls-cert", "", "Server TLS certificate")
+	keyPtr := flag.String("tls-key", "", "Server TLS private key")
+	clientCAPtr := flag.String("client-ca", "", "CA for client certificates (enables mTLS)")
+	tokensPtr := flag.String("tokens", "", "File with accepted bearer tokens, one per line")
+	poolStatePtr := flag.String("pool-state", "", "JSON Lines export of the MAC pool for cross-checks (SOA_mac_manager -export jsonl -columns address,state)")
+	flag.Parse()
+
+	c := &collector{poolState: *poolStatePtr}
+
+	if *certPtr == "" || *keyPtr == "" {
+		log.Fatal("-tls-cert and -tls-key are required")
+	}
+	if *tokensPtr != "" {
+		tokens, err := readTokens(*tokensPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.tokens = tokens
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if *clientCAPtr != "" {
+		pem, err := os.ReadFile(*clientCAPtr)
+		if err != nil {
+			log.Fatalf("Failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificates found in %s", *clientCAPtr)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		c.clientCAs = true
+	}
+	if c.clientCAs && len(c.tokens) > 0 {
+		// Клиенты без сертификата проходят по токену
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if len(c.tokens) == 0 && !c.clientCAs {
+		log.Fatal("No authentication configured, use -tokens and/or -client-ca")
+	}
+
+	if c.poolState != "" {
+		if _, err := loadPoolState(c.poolState); err != nil {
+			log.Fatalf("Cannot read pool state %s: %v", c.poolState, err)
+		}
+	}
+
+	store, err := openLogStore(*dbPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	c.store = store
+
+	server := &http.Server{
+		Addr:              *listenPtr,
+		Handler:           c.routes(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Log collector listening on %s, database %s", *listenPtr, *dbPtr)
+	if err := server.ListenAndServeTLS(*certPtr, *keyPtr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	log.Println("Log collector stopped")
+}
+
+// readTokens читает токены из файла, пропуская пустые строки и комментарии
+func readTokens(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %v", err)
+	}
+	var tokens []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens found in %s", path)
+	}
+	return tokens, nil
+}
+
+// routes возвращает обработчики API
+func (c *collector) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/logs", c.handleSubmit)
+	mux.HandleFunc("GET /api/v1/logs", c.handleQuery)
+	mux.HandleFunc("GET /api/v1/logs/{id}", c.handleGet)
+	mux.HandleFunc("GET /api/v1/crosscheck", c.handleCrossCheck)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	return c.authenticate(mux)
+}
+
+// authenticate пропускает запросы с действительным токеном или клиентским сертификатом
+func (c *collector) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.clientCAs && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			for _, t := range c.tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		writeError(w, http.StatusUnauthorized, "authentication required")
+	})
+}
+
+// handleSubmit принимает лог, проверяет его и сохраняет
+func (c *collector) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLogSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "log is too large")
+		return
+	}
+
+	entry, err := validateLog(body)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	entry.Filename = r.Header.Get("X-Log-Filename")
+	entry.Source = requestSource(r)
+
+	if err := c.store.Put(*entry); err != nil {
+		if errors.Is(err, errDuplicateLog) {
+			writeJSON(w, http.StatusConflict, map[string]string{"id": entry.ID, "status": "duplicate"})
+			return
+		}
+		log.Printf("Failed to store log: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to store log")
+		return
+	}
+
+	log.Printf("Stored log %s: %s %s %q success=%t from %s", entry.ID, entry.Product, entry.MAC, entry.Action, entry.Success, entry.Source)
+	writeJSON(w, http.StatusCreated, map[string]string{"id": entry.ID, "status": "stored"})
+}
+
+// validateLog разбирает лог и проверяет обязательные поля
+func validateLog(body []byte) (*StoredLog, error) {
+	var data LogData
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	if data.SchemaVersion > maxLogSchemaVersion {
+		return nil, fmt.Errorf("unsupported log schema version %d (max %d)", data.SchemaVersion, maxLogSchemaVersion)
+	}
+
+	ts, err := parseLogTimestamp(data.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if ts.After(time.Now().Add(maxClockSkew)) {
+		return nil, fmt.Errorf("timestamp %s is in the future", data.Timestamp)
+	}
+	if strings.TrimSpace(data.ProductName) == "" {
+		return nil, errors.New("product_name is required")
+	}
+	if strings.TrimSpace(data.ActionPerformed) == "" {
+		return nil, errors.New("action_performed is required")
+	}
+	if data.MacAddress != "" && !macRegexp.MatchString(data.MacAddress) {
+		return nil, fmt.Errorf("invalid mac_address %q", data.MacAddress)
+	}
+	if data.Success && data.MacAddress == "" {
+		return nil, errors.New("mac_address is required for successful operations")
+	}
+
+	sum := sha256.Sum256(body)
+	entry := &StoredLog{
+		ID:         hex.EncodeToString(sum[:16]),
+		ReceivedAt: time.Now().UTC(),
+		Timestamp:  ts,
+		Product:    data.ProductName,
+		Action:     data.ActionPerformed,
+		Success:    data.Success,
+		Log:        json.RawMessage(body),
+	}
+	if data.Signature != nil {
+		entry.StationKey = data.Signature.KeyID
+	}
+	if data.MacAddress != "" {
+		entry.MAC = normalizeMAC(data.MacAddress)
+	}
+	return entry, nil
+}
+
+// parseLogTimestamp разбирает время лога: формат флешера (местное время) или RFC 3339
+func parseLogTimestamp(value string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts, nil
+	}
+	if ts, err := time.ParseInLocation(flasherTimeFormat, value, time.Local); err == nil {
+		return ts, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// requestSource возвращает отправителя: имя из клиентского сертификата или адрес
+func requestSource(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return r.RemoteAddr
+}
+
+// handleQuery ищет логи по MAC, продукту, дате и результату
+func (c *collector) handleQuery(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := LogQuery{
+		MAC:     params.Get("mac"),
+		Product: params.Get("product"),
+		Limit:   defaultQueryLimit,
+	}
+
+	if q.MAC != "" && !macRegexp.MatchString(q.MAC) {
+		writeError(w, http.StatusBadRequest, "invalid mac")
+		return
+	}
+	var err error
+	if q.From, err = parseDateParam(params.Get("from"), false); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.To, err = parseDateParam(params.Get("to"), true); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if s := params.Get("success"); s != "" {
+		success, err := strconv.ParseBool(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "success must be true or false")
+			return
+		}
+		q.Success = &success
+	}
+	if s := params.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	logs, err := c.store.Find(q)
+	if err != nil {
+		log.Printf("Query failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, logs)
+}
+
+// parseDateParam разбирает дату (2006-01-02) или время RFC 3339. Для конца периода
+// дата без времени означает конец дня
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	if endOfDay {
+		return day.Add(24*time.Hour - time.Second), nil
+	}
+	return day, nil
+}
+
+// handleGet возвращает лог по идентификатору
+func (c *collector) handleGet(w http.ResponseWriter, r *http.Request) {
+	entry, err := c.store.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	if entry == nil {
+		writeError(w, http.StatusNotFound, "log not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// handleCrossCheck сверяет успешные логи с текущим состоянием пула
+func (c *collector) handleCrossCheck(w http.ResponseWriter, r *http.Request) {
+	if c.poolState == "" {
+		writeError(w, http.StatusNotImplemented, "collector was started without -pool-state")
+		return
+	}
+	// Выгрузка перечитывается при каждом запросе, чтобы её можно было обновлять по расписанию
+	pool, err := loadPoolState(c.poolState)
+	if err != nil {
+		log.Printf("Cross-check failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to load pool state")
+		return
+	}
+	logs, err := c.store.All()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+
+	report := crossCheckPool(pool, logs)
+	report.PoolState = c.poolState
+	writeJSON(w, http.StatusOK, report)
+}
+
+// writeJSON отправляет ответ в формате JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeError отправляет ошибку в формате JSON
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
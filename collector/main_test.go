@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLog возвращает лог флешера в JSON с заменой полей из overrides
+func testLog(t *testing.T, overrides map[string]interface{}) []byte {
+	t.Helper()
+	data := map[string]interface{}{
+		"timestamp":        "2026-03-02T10:15:00",
+		"product_name":     "MS-7C56",
+		"mac_address":      "00:e0:4c:00:00:01",
+		"action_performed": "MAC address updated",
+		"success":          true,
+		"schema_version":   3,
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(data, k)
+		} else {
+			data[k] = v
+		}
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestValidateLog(t *testing.T) {
+	future := time.Now().Add(48 * time.Hour).Format(flasherTimeFormat)
+
+	tests := []struct {
+		name      string
+		overrides map[string]interface{}
+		err       string
+	}{
+		{name: "valid log"},
+		{name: "RFC 3339 timestamp", overrides: map[string]interface{}{"timestamp": "2026-03-02T10:15:00+03:00"}},
+		{name: "failed operation without MAC", overrides: map[string]interface{}{"mac_address": nil, "success": false}},
+		{name: "legacy log without version", overrides: map[string]interface{}{"schema_version": nil}},
+		{name: "newer schema", overrides: map[string]interface{}{"schema_version": maxLogSchemaVersion + 1}, err: "unsupported log schema version"},
+		{name: "bad timestamp", overrides: map[string]interface{}{"timestamp": "02.03.2026"}, err: "invalid timestamp"},
+		{name: "timestamp in the future", overrides: map[string]interface{}{"timestamp": future}, err: "in the future"},
+		{name: "missing product", overrides: map[string]interface{}{"product_name": " "}, err: "product_name is required"},
+		{name: "missing action", overrides: map[string]interface{}{"action_performed": nil}, err: "action_performed is required"},
+		{name: "bad MAC", overrides: map[string]interface{}{"mac_address": "00:e0:4c:00:01"}, err: "invalid mac_address"},
+		{name: "successful operation without MAC", overrides: map[string]interface{}{"mac_address": nil}, err: "mac_address is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := validateLog(testLog(t, tt.overrides))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateLog: %v", err)
+			}
+			if entry.ID == "" || entry.Product != "MS-7C56" {
+				t.Errorf("entry = %+v", entry)
+			}
+		})
+	}
+
+	if _, err := validateLog([]byte("{not json")); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("error = %v, want invalid JSON", err)
+	}
+}
+
+func TestValidateLogNormalizesMAC(t *testing.T) {
+	body := testLog(t, map[string]interface{}{"mac_address": "00-e0-4c-00-00-0a"})
+	entry, err := validateLog(body)
+	if err != nil {
+		t.Fatalf("validateLog: %v", err)
+	}
+	if entry.MAC != "00:E0:4C:00:00:0A" {
+		t.Errorf("MAC = %s, want 00:E0:4C:00:00:0A", entry.MAC)
+	}
+	again, _ := validateLog(body)
+	if again.ID != entry.ID {
+		t.Errorf("ID of the same log changed: %s, %s", entry.ID, again.ID)
+	}
+}
+
+// testStore открывает пустую базу во временном каталоге и сохраняет в неё логи
+func testStore(t *testing.T, logs ...StoredLog) *LogStore {
+	t.Helper()
+	store, err := openLogStore(filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("openLogStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, l := range logs {
+		if err := store.Put(l); err != nil {
+			t.Fatalf("Put %s: %v", l.ID, err)
+		}
+	}
+	return store
+}
+
+// storedLog возвращает сохранённый лог с временем в полдень указанного дня
+func storedLog(id, mac, product, day string, success bool) StoredLog {
+	ts, _ := time.ParseInLocation("2006-01-02", day, time.Local)
+	return StoredLog{ID: id, MAC: mac, Product: product, Timestamp: ts.Add(12 * time.Hour), Success: success, Action: "MAC address updated", Log: json.RawMessage("{}")}
+}
+
+func TestHandleQueryFilters(t *testing.T) {
+	c := &collector{store: testStore(t,
+		storedLog("a", "00:E0:4C:00:00:01", "MS-7C56", "2026-03-01", true),
+		storedLog("b", "00:E0:4C:00:00:02", "MS-7C56", "2026-03-02", false),
+		storedLog("c", "00:E0:4C:00:00:02", "X11DDW-L", "2026-03-03", true),
+		storedLog("d", "", "X11DDW-L", "2026-03-04", false),
+	)}
+
+	tests := []struct {
+		query  string
+		status int
+		ids    []string
+	}{
+		{query: "", status: http.StatusOK, ids: []string{"a", "b", "c", "d"}},
+		{query: "mac=00-e0-4c-00-00-02", status: http.StatusOK, ids: []string{"b", "c"}},
+		{query: "mac=00:e0:4c:00:00:02&success=true", status: http.StatusOK, ids: []string{"c"}},
+		{query: "product=ms-7c56", status: http.StatusOK, ids: []string{"a", "b"}},
+		{query: "mac=00:e0:4c:00:00:02&product=X11DDW-L", status: http.StatusOK, ids: []string{"c"}},
+		{query: "from=2026-03-02&to=2026-03-03", status: http.StatusOK, ids: []string{"b", "c"}},
+		{query: "to=2026-03-01", status: http.StatusOK, ids: []string{"a"}},
+		{query: "success=false&limit=1", status: http.StatusOK, ids: []string{"b"}},
+		{query: "limit=0", status: http.StatusOK, ids: []string{"a", "b", "c", "d"}},
+		{query: "mac=00:e0:4c", status: http.StatusBadRequest},
+		{query: "from=03/02/2026", status: http.StatusBadRequest},
+		{query: "success=maybe", status: http.StatusBadRequest},
+		{query: "limit=-1", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c.handleQuery(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs?"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var logs []StoredLog
+			if err := json.Unmarshal(rec.Body.Bytes(), &logs); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			var ids []string
+			for _, l := range logs {
+				ids = append(ids, l.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxPoolStateLine - максимальная длина строки выгрузки пула
+const maxPoolStateLine = 1 << 20
+
+// PoolAddress - адрес из выгрузки пула в формате JSON Lines, которую делает MAC Pool Manager:
+//
+//	SOA_mac_manager -file <pool> -export jsonl -columns address,state -output <file>
+//
+// Сервис не расшифровывает сам пул: пароль пула одновременно является ключом его подписи HMAC,
+// и сервис, знающий пароль, мог бы подделать пул. Структуры пула поэтому остаются только
+// в MAC Flasher и MAC Pool Manager
+type PoolAddress struct {
+	Address string `json:"address"`
+	State   string `json:"state"`
+	Used    *bool  `json:"used"` // выгрузки без колонки state
+}
+
+// loadPoolState читает выгрузку пула. Адреса без состояния получают его по признаку used
+func loadPoolState(path string) ([]PoolAddress, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool state: %v", err)
+	}
+	defer f.Close()
+
+	var addrs []PoolAddress
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxPoolStateLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var addr PoolAddress
+		if err := json.Unmarshal([]byte(text), &addr); err != nil {
+			return nil, fmt.Errorf("pool state line %d: %v", line, err)
+		}
+		if !macRegexp.MatchString(addr.Address) {
+			return nil, fmt.Errorf("pool state line %d: invalid MAC address %q", line, addr.Address)
+		}
+		if addr.State == "" {
+			if addr.Used == nil {
+				return nil, fmt.Errorf("pool state line %d: export needs the state or used column", line)
+			}
+			addr.State = "free"
+			if *addr.Used {
+				addr.State = "used"
+			}
+		}
+		addrs = append(addrs, addr)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pool state: %v", err)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("pool state contains no addresses")
+	}
+	return addrs, nil
+}
+
+// CrossCheckProblem - расхождение между логами и пулом
+type CrossCheckProblem struct {
+	MAC     string `json:"mac"`
+	LogID   string `json:"log_id,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// CrossCheckReport - результат сверки логов с пулом
+type CrossCheckReport struct {
+	PoolState      string              `json:"pool_state"`
+	CheckedAt      time.Time           `json:"checked_at"`
+	LoggedMACs     int                 `json:"logged_macs"`
+	Consistent     int                 `json:"consistent"`
+	Problems       []CrossCheckProblem `json:"problems"`
+	UsedWithoutLog []string            `json:"used_without_log"` // адреса, помеченные использованными, без успешного лога
+}
+
+// crossCheckPool проверяет, что каждый MAC из успешных логов помечен в пуле как использованный
+func crossCheckPool(pool []PoolAddress, logs []StoredLog) CrossCheckReport {
+	report := CrossCheckReport{CheckedAt: time.Now().UTC(), Problems: []CrossCheckProblem{}, UsedWithoutLog: []string{}}
+
+	byAddress := make(map[string]PoolAddress, len(pool))
+	for _, addr := range pool {
+		byAddress[normalizeMAC(addr.Address)] = addr
+	}
+
+	logged := make(map[string]string) // MAC -> ID последнего успешного лога
+	for _, l := range logs {
+		if l.Success && l.MAC != "" {
+			logged[l.MAC] = l.ID
+		}
+	}
+
+	for mac, id := range logged {
+		report.LoggedMACs++
+		addr, ok := byAddress[mac]
+		switch {
+		case !ok:
+			report.Problems = append(report.Problems, CrossCheckProblem{MAC: mac, LogID: id, Problem: "not present in pool"})
+		case addr.State == "pending":
+			report.Problems = append(report.Problems, CrossCheckProblem{MAC: mac, LogID: id, Problem: "still pending in pool"})
+		case addr.State == "free":
+			report.Problems = append(report.Problems, CrossCheckProblem{MAC: mac, LogID: id, Problem: "not marked as used in pool"})
+		default:
+			report.Consistent++
+		}
+	}
+
+	for mac, addr := range byAddress {
+		// Успешный лог обязателен только для used: quarantined, defective и retired бывают и без него
+		if _, ok := logged[mac]; addr.State == "used" && !ok {
+			report.UsedWithoutLog = append(report.UsedWithoutLog, mac)
+		}
+	}
+
+	sort.Slice(report.Problems, func(i, j int) bool { return report.Problems[i].MAC < report.Problems[j].MAC })
+	sort.Strings(report.UsedWithoutLog)
+	return report
+}
+
+// normalizeMAC приводит MAC-адрес к виду AA:BB:CC:DD:EE:FF
+func normalizeMAC(mac string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(mac), "-", ":"))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writePoolState записывает выгрузку пула во временный файл
+func writePoolState(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pool.jsonl")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPoolState(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		states  []string
+		err     string
+	}{
+		{
+			name:    "state column",
+			content: `{"address":"00:E0:4C:00:00:01","state":"used"}` + "\n\n" + `{"address":"00:E0:4C:00:00:02","state":"quarantined"}` + "\n",
+			states:  []string{"used", "quarantined"},
+		},
+		{
+			name:    "legacy used column",
+			content: `{"address":"00:E0:4C:00:00:01","used":true}` + "\n" + `{"address":"00:E0:4C:00:00:02","used":false}`,
+			states:  []string{"used", "free"},
+		},
+		{name: "no state or used", content: `{"address":"00:E0:4C:00:00:01"}`, err: "line 1: export needs the state or used column"},
+		{name: "bad address", content: `{"address":"00:E0:4C:00:00:01","state":"used"}` + "\n" + `{"address":"zz","state":"used"}`, err: "line 2: invalid MAC address"},
+		{name: "not JSON", content: "address,state\n", err: "pool state line 1"},
+		{name: "empty export", content: "\n", err: "contains no addresses"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := loadPoolState(writePoolState(t, tt.content))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadPoolState: %v", err)
+			}
+			var states []string
+			for _, a := range addrs {
+				states = append(states, a.State)
+			}
+			if !reflect.DeepEqual(states, tt.states) {
+				t.Errorf("states = %v, want %v", states, tt.states)
+			}
+		})
+	}
+}
+
+func TestCrossCheckPool(t *testing.T) {
+	pool := []PoolAddress{
+		{Address: "00:e0:4c:00:00:01", State: "used"},
+		{Address: "00-e0-4c-00-00-02", State: "pending"},
+		{Address: "00:E0:4C:00:00:03", State: "free"},
+		{Address: "00:E0:4C:00:00:04", State: "used"},
+		{Address: "00:E0:4C:00:00:05", State: "quarantined"},
+		{Address: "00:E0:4C:00:00:06", State: "retired"},
+	}
+	logs := []StoredLog{
+		{ID: "ok", MAC: "00:E0:4C:00:00:01", Success: true},
+		{ID: "pending", MAC: "00:E0:4C:00:00:02", Success: true},
+		{ID: "free", MAC: "00:E0:4C:00:00:03", Success: true},
+		{ID: "failed", MAC: "00:E0:4C:00:00:04", Success: false},
+		{ID: "foreign", MAC: "00:E0:4C:00:00:09", Success: true},
+		{ID: "no-mac", Success: true},
+	}
+
+	report := crossCheckPool(pool, logs)
+
+	want := []CrossCheckProblem{
+		{MAC: "00:E0:4C:00:00:02", LogID: "pending", Problem: "still pending in pool"},
+		{MAC: "00:E0:4C:00:00:03", LogID: "free", Problem: "not marked as used in pool"},
+		{MAC: "00:E0:4C:00:00:09", LogID: "foreign", Problem: "not present in pool"},
+	}
+	if !reflect.DeepEqual(report.Problems, want) {
+		t.Errorf("problems = %+v, want %+v", report.Problems, want)
+	}
+	if report.LoggedMACs != 4 || report.Consistent != 1 {
+		t.Errorf("logged/consistent = %d/%d, want 4/1", report.LoggedMACs, report.Consistent)
+	}
+	// Адрес с одним неудачным логом считается использованным без лога, карантин и списанные - нет
+	if !reflect.DeepEqual(report.UsedWithoutLog, []string{"00:E0:4C:00:00:04"}) {
+		t.Errorf("used without log = %v, want [00:E0:4C:00:00:04]", report.UsedWithoutLog)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Корзины базы: сами логи и индексы по MAC, продукту и времени
+var (
+	bucketLogs      = []byte("logs")
+	bucketByMAC     = []byte("by_mac")
+	bucketByProduct = []byte("by_product")
+	bucketByTime    = []byte("by_time")
+)
+
+// indexTimeFormat - формат времени в ключах индекса, сортируется лексикографически
+const indexTimeFormat = "20060102T150405Z"
+
+// errDuplicateLog возвращается при повторной отправке уже сохранённого лога
+var errDuplicateLog = errors.New("log already stored")
+
+// StoredLog - лог операции вместе с данными о приёме
+type StoredLog struct {
+	ID         string          `json:"id"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Filename   string          `json:"filename,omitempty"`
+	Source     string          `json:"source,omitempty"` // адрес или имя сертификата отправителя
+	Timestamp  time.Time       `json:"timestamp"`
+	MAC        string          `json:"mac,omitempty"`
+	Product    string          `json:"product"`
+	Action     string          `json:"action"`
+	Success    bool            `json:"success"`
+	StationKey string          `json:"station_key,omitempty"` // идентификатор ключа, которым подписан лог
+	Log        json.RawMessage `json:"log"`                   // лог в том виде, в каком его прислал флешер
+}
+
+// LogQuery - условия поиска логов; пустые поля не ограничивают выборку
+type LogQuery struct {
+	MAC     string
+	Product string
+	From    time.Time
+	To      time.Time
+	Success *bool
+	Limit   int
+}
+
+// LogStore - хранилище логов на bbolt
+type LogStore struct {
+	db *bolt.DB
+}
+
+// openLogStore открывает базу и создаёт корзины
+func openLogStore(path string) (*LogStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketLogs, bucketByMAC, bucketByProduct, bucketByTime} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+	return &LogStore{db: db}, nil
+}
+
+// Close закрывает базу
+func (s *LogStore) Close() error {
+	return s.db.Close()
+}
+
+// indexKey формирует ключ индекса: значение, время и идентификатор через нулевой байт
+func indexKey(value string, ts time.Time, id string) []byte {
+	return []byte(value + "\x00" + ts.UTC().Format(indexTimeFormat) + "\x00" + id)
+}
+
+// Put сохраняет лог и обновляет индексы
+func (s *LogStore) Put(l StoredLog) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		logs := tx.Bucket(bucketLogs)
+		if logs.Get([]byte(l.ID)) != nil {
+			return errDuplicateLog
+		}
+		if err := logs.Put([]byte(l.ID), data); err != nil {
+			return err
+		}
+		if l.MAC != "" {
+			if err := tx.Bucket(bucketByMAC).Put(indexKey(l.MAC, l.Timestamp, l.ID), nil); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(bucketByProduct).Put(indexKey(strings.ToLower(l.Product), l.Timestamp, l.ID), nil); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketByTime).Put(indexKey("", l.Timestamp, l.ID), nil)
+	})
+}
+
+// Get возвращает лог по идентификатору
+func (s *LogStore) Get(id string) (*StoredLog, error) {
+	var result *StoredLog
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketLogs).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		result = &StoredLog{}
+		return json.Unmarshal(data, result)
+	})
+	return result, err
+}
+
+// Find ищет логи по условиям, используя самый избирательный индекс. Результат упорядочен по времени
+func (s *LogStore) Find(q LogQuery) ([]StoredLog, error) {
+	bucket, prefix := bucketByTime, ""
+	switch {
+	case q.MAC != "":
+		bucket, prefix = bucketByMAC, normalizeMAC(q.MAC)
+	case q.Product != "":
+		bucket, prefix = bucketByProduct, strings.ToLower(q.Product)
+	}
+
+	result := []StoredLog{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		logs := tx.Bucket(bucketLogs)
+		c := tx.Bucket(bucket).Cursor()
+
+		seek := []byte(prefix + "\x00")
+		if !q.From.IsZero() {
+			seek = append(seek, q.From.UTC().Format(indexTimeFormat)...)
+		}
+		for k, _ := c.Seek(seek); k != nil && bytes.HasPrefix(k, []byte(prefix+"\x00")); k, _ = c.Next() {
+			parts := strings.SplitN(string(k), "\x00", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			if !q.To.IsZero() && parts[1] > q.To.UTC().Format(indexTimeFormat) {
+				break
+			}
+
+			var l StoredLog
+			if err := json.Unmarshal(logs.Get([]byte(parts[2])), &l); err != nil {
+				return fmt.Errorf("corrupted log %s: %v", parts[2], err)
+			}
+			if q.Product != "" && !strings.EqualFold(l.Product, q.Product) {
+				continue
+			}
+			if q.Success != nil && l.Success != *q.Success {
+				continue
+			}
+			result = append(result, l)
+			if q.Limit > 0 && len(result) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// All возвращает все логи
+func (s *LogStore) All() ([]StoredLog, error) {
+	return s.Find(LogQuery{})
+}
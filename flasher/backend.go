@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FlashBackend - способ записи MAC-адреса в сетевые карты определённого производителя
+type FlashBackend interface {
+	// Name возвращает имя, по которому backend выбирается флагом -backend и правилами политики
+	Name() string
+	// Detect возвращает сетевые карты, которые умеет прошивать backend
+	Detect(nics map[string]NICInfo) []NICInfo
+	// Prepare загружает служебный драйвер и готовит утилиту прошивки
+	Prepare() error
+	// Write записывает MAC-адрес в энергонезависимую память карты
+	Write(mac string) error
+	// Verify перечитывает аппаратный адрес и возвращает интерфейсы, получившие mac
+	Verify(mac string) ([]string, error)
+	// Restore выгружает служебный драйвер и возвращает штатный
+	Restore() error
+	// Preflight проверяет, что для прошивки есть всё необходимое, ничего не меняя в системе
+	Preflight() []PreflightResult
+}
+
+// flashBackends - все известные способы прошивки в порядке автоматического выбора
+var flashBackends = []FlashBackend{
+	&realtekBackend{},
+}
+
+// findBackend возвращает backend по имени
+func findBackend(name string) (FlashBackend, error) {
+	for _, b := range flashBackends {
+		if strings.EqualFold(b.Name(), name) {
+			return b, nil
+		}
+	}
+	var names []string
+	for _, b := range flashBackends {
+		names = append(names, b.Name())
+	}
+	return nil, fmt.Errorf("unknown flashing backend %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// selectFlashBackend выбирает способ прошивки: явно указанный флагом, заданный правилом
+// политики или первый, который нашёл поддерживаемую сетевую карту по PCI ID
+func selectFlashBackend(name string, rule *PolicyRule) (FlashBackend, error) {
+	if name == "" && rule != nil {
+		name = rule.Driver
+	}
+
+	nics := listPCINICs()
+
+	if name != "" {
+		backend, err := findBackend(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(backend.Detect(nics)) == 0 {
+			fmt.Printf(colorYellow+"[WARNING] Backend %s did not detect a supported network card\n"+colorReset, backend.Name())
+		}
+		return backend, nil
+	}
+
+	for _, backend := range flashBackends {
+		if detected := backend.Detect(nics); len(detected) > 0 {
+			for _, nic := range detected {
+				fmt.Printf("Detected %s network card: %s (%s %s:%s)\n", backend.Name(), nic.Interface, nic.PCIAddress, nic.PCIVendor, nic.PCIDevice)
+			}
+			return backend, nil
+		}
+	}
+
+	return nil, errors.New("no supported network card found")
+}
+
+// interfaceExists проверяет наличие сетевого интерфейса
+func interfaceExists(iface string) bool {
+	_, err := os.Stat(filepath.Join(sysClassNet, iface))
+	return err == nil
+}
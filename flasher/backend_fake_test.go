@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testFlashMAC - локально администрируемый адрес для имитации прошивки
+const testFlashMAC = "02:00:5e:fa:ce:01"
+
+// Имитация прошивки доступна по имени "fake" только в тестовой сборке
+func init() {
+	flashBackends = append(flashBackends, &fakeBackend{})
+}
+
+// fakeBackend имитирует прошивку без обращения к оборудованию. Регистрируется только
+// в тестах, поэтому в рабочей сборке выбрать его нельзя
+type fakeBackend struct {
+	written string
+
+	// Для тестов: сбои записи и несовпадение адреса при проверке
+	failWrites int    // сколько первых попыток записи завершатся ошибкой
+	readBack   string // адрес, который «прочитает» проверка вместо записанного
+	writes     int
+	verifies   int
+	restores   int
+}
+
+func (f *fakeBackend) Name() string {
+	return "fake"
+}
+
+func (f *fakeBackend) Detect(nics map[string]NICInfo) []NICInfo {
+	return nil
+}
+
+func (f *fakeBackend) Prepare() error {
+	fmt.Println(colorYellow + "[FAKE] No drivers are changed, MAC address will not be written to hardware" + colorReset)
+	return nil
+}
+
+func (f *fakeBackend) Write(mac string) error {
+	f.writes++
+	if f.writes <= f.failWrites {
+		return fmt.Errorf("fake write failure on attempt %d", f.writes)
+	}
+	f.written = strings.ToLower(mac)
+	fmt.Printf(colorYellow+"[FAKE] Pretending to write MAC %s\n"+colorReset, mac)
+	return nil
+}
+
+func (f *fakeBackend) Verify(mac string) ([]string, error) {
+	f.verifies++
+	stored := f.written
+	if f.readBack != "" {
+		stored = strings.ToLower(f.readBack)
+	}
+	if stored != strings.ToLower(mac) {
+		return nil, fmt.Errorf("fake backend has MAC %q, expected %s", stored, mac)
+	}
+	return []string{"fake0"}, nil
+}
+
+func (f *fakeBackend) Restore() error {
+	f.restores++
+	return nil
+}
+
+func (f *fakeBackend) Preflight() []PreflightResult {
+	return []PreflightResult{{Name: "Flashing backend", Status: preflightPass, Detail: "fake (no hardware access)"}}
+}
+
+func TestFakeBackendFlow(t *testing.T) {
+	backend := &fakeBackend{}
+
+	if err := backend.Prepare(); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if err := backend.Write(strings.ToUpper(testFlashMAC)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	ifaces, err := backend.Verify(testFlashMAC)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !reflect.DeepEqual(ifaces, []string{"fake0"}) {
+		t.Errorf("Verify interfaces = %v, want [fake0]", ifaces)
+	}
+	if _, err := backend.Verify("02:00:5e:fa:ce:02"); err == nil {
+		t.Error("Verify accepted an address that was not written")
+	}
+	if err := backend.Restore(); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+}
+
+func TestFlashAndVerifyWithFakeBackendFailures(t *testing.T) {
+	saved := writeRetryDelay
+	writeRetryDelay = 0
+	defer func() { writeRetryDelay = saved }()
+
+	tests := []struct {
+		name     string
+		backend  *fakeBackend
+		err      string
+		writes   int
+		verifies int
+	}{
+		{
+			name:     "write fails on every attempt",
+			backend:  &fakeBackend{failWrites: maxRetries},
+			err:      "Failed to write MAC address after",
+			writes:   maxRetries,
+			verifies: 0,
+		},
+		{
+			name:     "verify mismatch after a retried write",
+			backend:  &fakeBackend{failWrites: 1, readBack: "02:00:5e:fa:ce:ff"},
+			err:      "Flash verification failed",
+			writes:   2,
+			verifies: 1,
+		},
+		{
+			name:     "write succeeds after a retry",
+			backend:  &fakeBackend{failWrites: maxRetries - 1},
+			writes:   maxRetries,
+			verifies: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ifaces, err := flashAndVerify(context.Background(), tt.backend, testFlashMAC)
+			if tt.err == "" {
+				if err != nil || !reflect.DeepEqual(ifaces, []string{"fake0"}) {
+					t.Fatalf("flashAndVerify = %v, %v, want [fake0]", ifaces, err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.err)
+			}
+			if tt.backend.writes != tt.writes || tt.backend.verifies != tt.verifies {
+				t.Errorf("writes/verifies = %d/%d, want %d/%d", tt.backend.writes, tt.backend.verifies, tt.writes, tt.verifies)
+			}
+			// Штатный драйвер возвращается и после неудачной записи
+			if tt.backend.restores != 1 {
+				t.Errorf("Restore called %d times, want 1", tt.backend.restores)
+			}
+		})
+	}
+}
+
+func TestFlashAndVerifyStopsWhenInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	backend := &fakeBackend{}
+
+	_, err := flashAndVerify(ctx, backend, testFlashMAC)
+	if err == nil || !strings.Contains(err.Error(), errInterrupted.Error()) {
+		t.Fatalf("error = %v, want it to mention %q", err, errInterrupted)
+	}
+	if backend.writes != 0 || backend.restores != 1 {
+		t.Errorf("writes/restores = %d/%d, want 0/1", backend.writes, backend.restores)
+	}
+}
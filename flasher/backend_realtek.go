@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// realtekPCIVendor - идентификатор производителя Realtek
+const realtekPCIVendor = "0x10ec"
+
+// realtekPCIDevices - сетевые контроллеры Realtek, поддерживаемые rtnicpg
+var realtekPCIDevices = []string{
+	"0x8136", // RTL810xE
+	"0x8161", // RTL8111/8168 PCIe
+	"0x8162",
+	"0x8168", // RTL8111/8168/8411
+	"0x8125", // RTL8125 2.5GbE
+	"0x8126", // RTL8126 5GbE
+	"0x3000", // RTL8125 Killer E3000
+	"0x2502", // RTL8125 Killer E3100
+	"0x2600", // RTL8125 Killer E2600
+}
+
+// realtekBackend прошивает контроллеры Realtek утилитой rtnicpg через драйвер pgdrv
+type realtekBackend struct {
+	rebuilt bool // драйвер уже пересобирался в этом запуске
+}
+
+func (r *realtekBackend) Name() string {
+	return "rtnicpg"
+}
+
+// Detect возвращает контроллеры Realtek из списка поддерживаемых
+func (r *realtekBackend) Detect(nics map[string]NICInfo) []NICInfo {
+	var result []NICInfo
+	for _, nic := range nics {
+		if !strings.EqualFold(nic.PCIVendor, realtekPCIVendor) {
+			continue
+		}
+		for _, device := range realtekPCIDevices {
+			if strings.EqualFold(nic.PCIDevice, device) {
+				result = append(result, nic)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Prepare выгружает штатные драйверы Realtek и загружает pgdrv, пересобирая его при необходимости
+func (r *realtekBackend) Prepare() error {
+	// Первая попытка загрузить драйвер из кэша
+	driverErr := loadDriver(false)
+	if driverErr == nil {
+		return r.prepareTool()
+	}
+	if errors.Is(driverErr, errModuleSignature) {
+		// Пересборка не поможет, модулю нужна доверенная подпись
+		fmt.Println(colorYellow + signatureGuidance() + colorReset)
+		return driverErr
+	}
+
+	fmt.Printf(colorYellow+"[WARNING] Initial driver load failed: %v\nAttempting to recompile driver..."+colorReset+"\n", driverErr)
+	r.rebuilt = true
+	if err := loadDriver(true); err != nil {
+		if errors.Is(err, errModuleSignature) {
+			fmt.Println(colorYellow + signatureGuidance() + colorReset)
+		}
+		return fmt.Errorf("Failed to load driver even after recompilation: %w", err)
+	}
+	return r.prepareTool()
+}
+
+// Write записывает MAC-адрес в efuse. При первой неудаче драйвер пересобирается и перезагружается
+func (r *realtekBackend) Write(mac string) error {
+	rtnic, err := rtnicpgBinary()
+	if err != nil {
+		return err
+	}
+
+	// Модифицируем MAC-адрес для команды (удаляем двоеточия)
+	modmac := strings.ReplaceAll(mac, ":", "")
+	fmt.Println("Modified MAC for flashing:", modmac)
+
+	writeErr := runCommandNoOutput(rtnic, "/efuse", "/nicmac", "/nodeid", modmac)
+	if writeErr == nil || r.rebuilt {
+		return writeErr
+	}
+
+	fmt.Println(colorYellow + "[WARNING] MAC write failed. Attempting to recompile driver and try again..." + colorReset)
+	r.rebuilt = true
+	if err := loadDriver(true); err != nil {
+		fmt.Printf(colorYellow+"[WARNING] Failed to reload driver after recompilation: %v\n"+colorReset, err)
+	}
+	return writeErr
+}
+
+// Verify перечитывает аппаратный адрес после возврата штатного драйвера
+func (r *realtekBackend) Verify(mac string) ([]string, error) {
+	return verifyFlashedMAC(mac)
+}
+
+// Restore выгружает pgdrv и загружает все удалённые штатные драйверы
+func (r *realtekBackend) Restore() error {
+	return moduleState.Restore()
+}
+
+// Preflight проверяет наличие карты Realtek, утилиты rtnicpg для архитектуры и окружения для сборки pgdrv
+func (r *realtekBackend) Preflight() []PreflightResult {
+	var results []PreflightResult
+
+	if nics := r.Detect(listPCINICs()); len(nics) > 0 {
+		var names []string
+		for _, nic := range nics {
+			names = append(names, fmt.Sprintf("%s (%s:%s)", nic.Interface, nic.PCIVendor, nic.PCIDevice))
+		}
+		results = append(results, PreflightResult{Name: "Supported network card", Status: preflightPass, Detail: strings.Join(names, ", ")})
+	} else {
+		results = append(results, PreflightResult{Name: "Supported network card", Status: preflightFail, Detail: "no supported Realtek controller found"})
+	}
+
+	rtnic, err := rtnicpgBinary()
+	if err == nil {
+		if info, statErr := os.Stat(rtnic); statErr != nil || info.IsDir() {
+			err = fmt.Errorf("%s not found for this architecture", rtnic)
+		}
+	}
+	results = append(results, preflightResult("rtnicpg binary", err, rtnic))
+	results = append(results, checkModuleLoading())
+
+	srcDir := filepath.Join(cDir, "rtnicpg")
+	if info, err := os.Stat(srcDir); err != nil || !info.IsDir() {
+		return append(results, PreflightResult{Name: "pgdrv sources", Status: preflightFail, Detail: srcDir + " not found"})
+	}
+	return append(results, checkKernelBuildEnv(srcDir, "pgdrv")...)
+}
+
+// prepareTool делает утилиту rtnicpg для текущей архитектуры исполняемой
+func (r *realtekBackend) prepareTool() error {
+	rtnic, err := rtnicpgBinary()
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(rtnic, 0755); err != nil {
+		return fmt.Errorf("Failed to chmod %s: %v", rtnic, err)
+	}
+	return nil
+}
+
+// rtnicpgBinary возвращает путь к утилите rtnicpg для архитектуры машины
+func rtnicpgBinary() (string, error) {
+	arch, err := machineArch()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cDir, "rtnicpg", "rtnicpg-"+arch), nil
+}
+
+// loadDriver выгружает штатные драйверы Realtek и загружает pgdrv из пакета драйверов или кэша сборок.
+// При rebuild модуль пересобирается, даже если в кэше есть подходящая сборка
+func loadDriver(rebuild bool) error {
+	moduleDefault := "pgdrv"
+	modulesToRemove := []string{"r8169", "r8168", "r8125", "r8101"}
+
+	rtnicpgPath := filepath.Join(cDir, "rtnicpg")
+	if info, err := os.Stat(rtnicpgPath); err != nil || !info.IsDir() {
+		return fmt.Errorf("Directory %s does not exist", rtnicpgPath)
+	}
+
+	stage := beginStage("driver unload")
+	for _, mod := range modulesToRemove {
+		if isModuleLoaded(mod) {
+			fmt.Printf("Removing module: %s\n", mod)
+			if err := moduleState.Remove(mod); err != nil {
+				fmt.Printf("[WARNING] Could not remove module %s: %v\n", mod, err)
+				stage.detail(fmt.Sprintf("could not remove %s: %v", mod, err))
+			} else {
+				fmt.Printf("[INFO] Module %s successfully removed.\n", mod)
+				stage.detail("removed " + mod)
+			}
+		}
+	}
+	stage.finish(nil)
+
+	if isModuleLoaded(moduleDefault) {
+		if !rebuild {
+			fmt.Printf("[INFO] Module %s is already loaded.\n", moduleDefault)
+			return nil
+		}
+		_ = moduleState.Unload(moduleDefault)
+	}
+
+	modulePath, err := driverModulePath(rtnicpgPath, moduleDefault, rebuild)
+	if err != nil {
+		return err
+	}
+
+	stage = beginStage("insmod")
+	stage.detail(modulePath)
+	err = moduleState.Insert(modulePath, moduleDefault)
+	stage.finish(err)
+	if err != nil {
+		return fmt.Errorf("Failed to load module %s: %w", modulePath, err)
+	}
+	fmt.Printf("[INFO] Module %s loaded successfully.\n", modulePath)
+	return nil
+}
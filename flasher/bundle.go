@@ -0,0 +1,548 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Файлы пакета драйверов
+const (
+	bundleManifestName    = "manifest.json"
+	bundleFormatVersion   = 1
+	defaultBundleDir      = "driver-bundle"        // каталог пакета рядом с флешером
+	defaultBundleTarball  = "driver-bundle.tar.gz" // упакованный пакет рядом с флешером
+	bundleKernelReleaseAt = "include/config/kernel.release"
+)
+
+// bundleKernelConfigs - файлы конфигурации ядра в дереве заголовков, по которым определяется архитектура
+var bundleKernelConfigs = []string{"include/config/auto.conf", ".config"}
+
+// kernelArches сопоставляет параметры конфигурации ядра архитектуре в том виде, в каком её выводит
+// uname -m на плате, и значению ARCH для сборки модуля. Проверяются по порядку, частные случаи раньше
+var kernelArches = []struct {
+	symbols []string
+	machine string
+	karch   string
+}{
+	{[]string{"CONFIG_X86_64"}, "x86_64", "x86"},
+	{[]string{"CONFIG_X86_32"}, "i686", "x86"},
+	{[]string{"CONFIG_ARM64"}, "aarch64", "arm64"},
+	{[]string{"CONFIG_ARM", "CONFIG_CPU_V7"}, "armv7l", "arm"},
+	{[]string{"CONFIG_ARM", "CONFIG_CPU_V6"}, "armv6l", "arm"},
+	{[]string{"CONFIG_RISCV", "CONFIG_64BIT"}, "riscv64", "riscv"},
+	{[]string{"CONFIG_PPC64", "CONFIG_CPU_LITTLE_ENDIAN"}, "ppc64le", "powerpc"},
+	{[]string{"CONFIG_PPC64"}, "ppc64", "powerpc"},
+	{[]string{"CONFIG_S390"}, "s390x", "s390"},
+	{[]string{"CONFIG_LOONGARCH", "CONFIG_64BIT"}, "loongarch64", "loongarch"},
+}
+
+// driverBundlePath - пакет собранных драйверов (каталог или .tar.gz), задаётся флагом -driver-bundle
+var driverBundlePath string
+
+// BundleManifest описывает пакет заранее собранных модулей для набора ядер.
+// Контрольные суммы SHA256 в манифесте защищают только от повреждения файлов при копировании:
+// манифест не подписан, и тот, кто может подменить модуль, подменит и его сумму
+type BundleManifest struct {
+	FormatVersion int           `json:"format_version"`
+	Module        string        `json:"module"`
+	SourceHash    string        `json:"source_hash"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Entries       []BundleEntry `json:"entries"`
+}
+
+// BundleEntry - модуль для одного ядра и архитектуры
+type BundleEntry struct {
+	Kernel   string `json:"kernel"`
+	Arch     string `json:"arch"`
+	Path     string `json:"path"`   // путь внутри пакета
+	SHA256   string `json:"sha256"` // проверка целостности, а не подлинности модуля
+	Vermagic string `json:"vermagic"`
+}
+
+// driverBundle - открытый пакет: каталог или архив
+type driverBundle struct {
+	location string
+	manifest BundleManifest
+	tarball  bool
+}
+
+// findDriverBundle возвращает путь к пакету драйверов: заданный флагом или найденный рядом с флешером
+func findDriverBundle() string {
+	if driverBundlePath != "" {
+		return driverBundlePath
+	}
+	for _, name := range []string{defaultBundleDir, defaultBundleTarball} {
+		candidate := filepath.Join(cDir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// openDriverBundle читает манифест пакета
+func openDriverBundle(location string) (*driverBundle, error) {
+	b := &driverBundle{location: location, tarball: strings.HasSuffix(location, ".tar.gz") || strings.HasSuffix(location, ".tgz")}
+
+	data, err := b.readFile(bundleManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle manifest: %v", err)
+	}
+	if err := json.Unmarshal(data, &b.manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle manifest: %v", err)
+	}
+	if b.manifest.FormatVersion != bundleFormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d", b.manifest.FormatVersion)
+	}
+	return b, nil
+}
+
+// readFile читает файл из пакета. Пути, выходящие за пределы пакета, отклоняются
+func (b *driverBundle) readFile(name string) ([]byte, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return nil, fmt.Errorf("path %q points outside the bundle", name)
+	}
+	if !b.tarball {
+		return os.ReadFile(filepath.Join(b.location, filepath.FromSlash(name)))
+	}
+
+	f, err := os.Open(b.location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", name, b.location)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Clean(strings.TrimPrefix(hdr.Name, "./")) == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// findEntry ищет модуль для ядра и архитектуры
+func (b *driverBundle) findEntry(kernel, arch string) (BundleEntry, bool) {
+	for _, e := range b.manifest.Entries {
+		if e.Kernel == kernel && e.Arch == arch {
+			return e, true
+		}
+	}
+	return BundleEntry{}, false
+}
+
+// bundledDriverPath извлекает модуль для работающего ядра из пакета в кэш драйверов,
+// проверив контрольную сумму и vermagic. Сумма отсеивает повреждённые файлы, но не подменённый
+// пакет: доверие к модулю определяет подпись ядра (ensureModuleSigned), а не манифест
+func bundledDriverPath(location, srcDir, moduleName string) (string, error) {
+	bundle, err := openDriverBundle(location)
+	if err != nil {
+		return "", err
+	}
+	if bundle.manifest.Module != moduleName {
+		return "", fmt.Errorf("bundle contains module %q, expected %q", bundle.manifest.Module, moduleName)
+	}
+
+	kernel, err := kernelRelease()
+	if err != nil {
+		return "", err
+	}
+	arch, err := machineArch()
+	if err != nil {
+		return "", err
+	}
+	entry, ok := bundle.findEntry(kernel, arch)
+	if !ok {
+		return "", fmt.Errorf("bundle has no %s module for kernel %s (%s)", moduleName, kernel, arch)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(entry.Path)) {
+		return "", fmt.Errorf("bundle manifest has an unsafe module path %q", entry.Path)
+	}
+
+	// Пакет собран из других исходников - предупреждаем, но не отказываем: на станции
+	// без компилятора исходники могут отсутствовать
+	if hash, err := hashDriverSources(srcDir); err == nil && bundle.manifest.SourceHash != "" && hash != bundle.manifest.SourceHash {
+		fmt.Println(colorYellow + "[WARNING] Driver bundle was built from different driver sources than ./rtnicpg" + colorReset)
+	}
+
+	data, err := bundle.readFile(entry.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from bundle: %v", entry.Path, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != entry.SHA256 {
+		return "", fmt.Errorf("checksum mismatch for %s in bundle", entry.Path)
+	}
+
+	key := DriverCacheKey{Kernel: kernel, Arch: arch, SourceHash: entry.SHA256}
+	entryDir := filepath.Join(driverCacheRoot(), "bundle-"+key.dirName())
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create driver cache directory: %v", err)
+	}
+	modulePath := filepath.Join(entryDir, moduleName+".ko")
+
+	// Подписанная копия в кэше отличается от пакета, поэтому перезаписываем её только если
+	// она отсутствует или собрана не из этого модуля
+	if existing, err := os.ReadFile(modulePath); err != nil || !sameUnsignedModule(existing, data) {
+		if err := os.WriteFile(modulePath, data, 0644); err != nil {
+			return "", fmt.Errorf("failed to store bundled module: %v", err)
+		}
+	}
+
+	if err := checkModuleVermagic(modulePath, kernel); err != nil {
+		return "", fmt.Errorf("bundled module is unusable: %v", err)
+	}
+	if err := ensureModuleSigned(modulePath, kernel); err != nil {
+		return "", err
+	}
+
+	fmt.Printf("[INFO] Using bundled driver for kernel %s from %s\n", kernel, location)
+	return modulePath, nil
+}
+
+// sameUnsignedModule проверяет, совпадает ли модуль без подписи с исходным
+func sameUnsignedModule(module, original []byte) bool {
+	unsigned, err := stripModuleSignature(module)
+	if err != nil {
+		return false
+	}
+	return string(unsigned) == string(original)
+}
+
+// driverModulePath возвращает модуль для работающего ядра: из пакета драйверов, если он есть,
+// иначе из кэша сборок с компиляцией при необходимости
+func driverModulePath(srcDir, moduleName string, rebuild bool) (string, error) {
+	if location := findDriverBundle(); location != "" && !rebuild {
+		modulePath, err := bundledDriverPath(location, srcDir, moduleName)
+		if err == nil {
+			return modulePath, nil
+		}
+		fmt.Printf(colorYellow+"[WARNING] Driver bundle unusable: %v. Falling back to compilation.\n"+colorReset, err)
+	}
+	return cachedDriverPath(srcDir, moduleName, rebuild)
+}
+
+// headerTreeRelease определяет версию ядра по дереву заголовков
+func headerTreeRelease(headersDir string) (string, error) {
+	release := readSysfsValue(filepath.Join(headersDir, bundleKernelReleaseAt))
+	if release != "" {
+		return release, nil
+	}
+	// /lib/modules/<версия>/build
+	if base := filepath.Base(filepath.Dir(headersDir)); filepath.Base(headersDir) == "build" && base != "" {
+		return base, nil
+	}
+	return "", fmt.Errorf("cannot determine kernel version of %s (missing %s)", headersDir, bundleKernelReleaseAt)
+}
+
+// headerTreeArch определяет архитектуру ядра по конфигурации в дереве заголовков: деревья для
+// других плат могут лежать на машине сборки рядом с родными. Возвращает архитектуру как
+// uname -m и значение ARCH для make
+func headerTreeArch(headersDir string) (machine, karch string, err error) {
+	for _, name := range bundleKernelConfigs {
+		data, err := os.ReadFile(filepath.Join(headersDir, name))
+		if err != nil {
+			continue
+		}
+		enabled := make(map[string]bool)
+		for _, line := range strings.Split(string(data), "\n") {
+			if symbol, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok && value == "y" {
+				enabled[symbol] = true
+			}
+		}
+		for _, a := range kernelArches {
+			matched := true
+			for _, symbol := range a.symbols {
+				matched = matched && enabled[symbol]
+			}
+			if matched {
+				return a.machine, a.karch, nil
+			}
+		}
+		return "", "", fmt.Errorf("unsupported architecture in %s", filepath.Join(headersDir, name))
+	}
+	return "", "", fmt.Errorf("cannot determine architecture of %s (missing %s)", headersDir, strings.Join(bundleKernelConfigs, " and "))
+}
+
+// buildBundleModule собирает модуль для одного дерева заголовков в отдельной копии исходников
+// и сохраняет его в dst. karch задаёт ARCH для сборки под другую архитектуру, пустое - под текущую;
+// компилятор для неё указывается переменной окружения CROSS_COMPILE
+func buildBundleModule(srcDir, headersDir, moduleName, kernel, karch, logPath, dst string) error {
+	workDir, err := os.MkdirTemp("", "pgdrv-build-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+	if err := copyDir(srcDir, workDir); err != nil {
+		return fmt.Errorf("failed to copy driver sources: %v", err)
+	}
+
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return fmt.Errorf("failed to create build log: %v", err)
+	}
+	defer logFile.Close()
+
+	// Makefile драйвера берёт путь к заголовкам из разных переменных, задаём все распространённые
+	args := []string{"-C", workDir,
+		"KERNELDIR=" + headersDir, "KDIR=" + headersDir, "KSRC=" + headersDir, "KVER=" + kernel}
+	if karch != "" {
+		args = append(args, "ARCH="+karch)
+	}
+	cmd := exec.CommandContext(commandContext(), "make", append(args, "clean", "all")...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("compilation failed: %v (see %s)", err, logPath)
+	}
+
+	builtModule := filepath.Join(workDir, moduleName+".ko")
+	if err := checkModuleVermagic(builtModule, kernel); err != nil {
+		return fmt.Errorf("%v (see %s)", err, logPath)
+	}
+	return copyFile(builtModule, dst)
+}
+
+// copyDir копирует дерево файлов
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(p, target)
+	})
+}
+
+// runBuildBundleCommand выполняет подкоманду build-bundle: собирает модуль для каждого
+// дерева заголовков и сохраняет пакет с манифестом и контрольными суммами
+func runBuildBundleCommand(args []string) int {
+	flags := flag.NewFlagSet("build-bundle", flag.ExitOnError)
+	outPtr := flags.String("out", defaultBundleDir, "Output bundle directory, or a .tar.gz file")
+	srcPtr := flags.String("src", "rtnicpg", "Directory with the pgdrv driver sources")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: flasher build-bundle [-out dir|file.tar.gz] [-src dir] <kernel headers dir>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// Прерывание останавливает сборку, временные каталоги удаляются отложенными вызовами
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	setCommandContext(ctx)
+
+	moduleName := "pgdrv"
+	srcDir, err := filepath.Abs(*srcPtr)
+	if err != nil {
+		criticalError(err.Error())
+		return 1
+	}
+	sourceHash, err := hashDriverSources(srcDir)
+	if err != nil {
+		criticalError("Failed to hash driver sources: " + err.Error())
+		return 1
+	}
+	// Архитектура машины сборки нужна, только чтобы отличить сборку под другую архитектуру
+	hostArch, _ := machineArch()
+
+	out := *outPtr
+	tarball := strings.HasSuffix(out, ".tar.gz") || strings.HasSuffix(out, ".tgz")
+	stageDir := out
+	if tarball {
+		if stageDir, err = os.MkdirTemp("", "driver-bundle-*"); err != nil {
+			criticalError(err.Error())
+			return 1
+		}
+		defer os.RemoveAll(stageDir)
+	}
+
+	// Существующий каталог пакета дополняется: модули для других ядер сохраняются
+	manifest := BundleManifest{FormatVersion: bundleFormatVersion, Module: moduleName, SourceHash: sourceHash}
+	if !tarball {
+		if existing, err := openDriverBundle(out); err == nil && existing.manifest.SourceHash == sourceHash {
+			manifest.Entries = existing.manifest.Entries
+		}
+	}
+
+	failed := 0
+	for _, headersDir := range flags.Args() {
+		if ctx.Err() != nil {
+			criticalError("Bundle build interrupted")
+			return 1
+		}
+		headersDir, _ = filepath.Abs(headersDir)
+		kernel, err := headerTreeRelease(headersDir)
+		if err != nil {
+			fmt.Printf(colorYellow+"[WARNING] %v\n"+colorReset, err)
+			failed++
+			continue
+		}
+		arch, karch, err := headerTreeArch(headersDir)
+		if err != nil {
+			fmt.Printf(colorYellow+"[WARNING] Kernel %s: %v\n"+colorReset, kernel, err)
+			failed++
+			continue
+		}
+		if arch == hostArch {
+			karch = ""
+		}
+
+		entryPath := path.Join(arch, kernel, moduleName+".ko")
+		entryDir := filepath.Join(stageDir, arch, kernel)
+		if err := os.MkdirAll(entryDir, 0755); err != nil {
+			criticalError(err.Error())
+			return 1
+		}
+
+		fmt.Printf("[INFO] Building %s for kernel %s (%s)\n", moduleName, kernel, arch)
+		modulePath := filepath.Join(entryDir, moduleName+".ko")
+		if err := buildBundleModule(srcDir, headersDir, moduleName, kernel, karch, filepath.Join(entryDir, "build.log"), modulePath); err != nil {
+			fmt.Printf(colorYellow+"[WARNING] Kernel %s: %v\n"+colorReset, kernel, err)
+			failed++
+			continue
+		}
+		data, err := os.ReadFile(modulePath)
+		if err != nil {
+			criticalError(err.Error())
+			return 1
+		}
+		sum := sha256.Sum256(data)
+		vermagic, _ := moduleVermagic(modulePath)
+
+		entry := BundleEntry{Kernel: kernel, Arch: arch, Path: entryPath, SHA256: hex.EncodeToString(sum[:]), Vermagic: vermagic}
+		replaced := false
+		for i := range manifest.Entries {
+			if manifest.Entries[i].Kernel == kernel && manifest.Entries[i].Arch == arch {
+				manifest.Entries[i] = entry
+				replaced = true
+			}
+		}
+		if !replaced {
+			manifest.Entries = append(manifest.Entries, entry)
+		}
+		fmt.Printf(colorGreen+"[INFO] Kernel %s: %s\n"+colorReset, kernel, entry.SHA256)
+	}
+
+	if len(manifest.Entries) == 0 {
+		criticalError("No modules were built")
+		return 1
+	}
+
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		if manifest.Entries[i].Arch != manifest.Entries[j].Arch {
+			return manifest.Entries[i].Arch < manifest.Entries[j].Arch
+		}
+		return manifest.Entries[i].Kernel < manifest.Entries[j].Kernel
+	})
+	manifest.CreatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		criticalError(err.Error())
+		return 1
+	}
+	if err := os.WriteFile(filepath.Join(stageDir, bundleManifestName), data, 0644); err != nil {
+		criticalError("Failed to write manifest: " + err.Error())
+		return 1
+	}
+
+	if tarball {
+		if err := writeTarball(stageDir, out); err != nil {
+			criticalError("Failed to write bundle archive: " + err.Error())
+			return 1
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf(colorYellow+"[WARNING] %d kernel(s) could not be built\n"+colorReset, failed)
+		return 1
+	}
+	successMessage(fmt.Sprintf("Driver bundle with %d module(s) written to %s", len(manifest.Entries), out))
+	return 0
+}
+
+// writeTarball упаковывает каталог в архив tar.gz
+func writeTarball(srcDir, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	walkErr := filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: filepath.ToSlash(rel), Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+
+	for _, closer := range []io.Closer{tw, gz, f} {
+		if err := closer.Close(); err != nil && walkErr == nil {
+			walkErr = err
+		}
+	}
+	if walkErr != nil {
+		os.Remove(dst)
+		return walkErr
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDriverBundleRejectsPathsOutsideBundle(t *testing.T) {
+	root := t.TempDir()
+	location := filepath.Join(root, "driver-bundle")
+	if err := os.MkdirAll(filepath.Join(location, "x86_64"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(location, "x86_64", "pgdrv.ko"), []byte("module"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := &driverBundle{location: location}
+
+	for _, name := range []string{"../secret", "x86_64/../../secret", "/etc/passwd", ""} {
+		if _, err := b.readFile(name); err == nil {
+			t.Errorf("readFile(%q) succeeded", name)
+		}
+	}
+	if data, err := b.readFile("x86_64/pgdrv.ko"); err != nil || string(data) != "module" {
+		t.Errorf("readFile(x86_64/pgdrv.ko) = %q, %v", data, err)
+	}
+}
+
+func TestHeaderTreeArch(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		config  string
+		machine string
+		karch   string
+	}{
+		{"x86_64 auto.conf", "include/config/auto.conf", "CONFIG_X86=y\nCONFIG_X86_64=y\nCONFIG_64BIT=y\n", "x86_64", "x86"},
+		{"arm64 .config", ".config", "# CONFIG_X86_64 is not set\nCONFIG_ARM64=y\nCONFIG_64BIT=y\n", "aarch64", "arm64"},
+		{"armv7", ".config", "CONFIG_ARM=y\nCONFIG_CPU_V7=y\n", "armv7l", "arm"},
+		{"little-endian ppc64", ".config", "CONFIG_PPC64=y\nCONFIG_CPU_LITTLE_ENDIAN=y\n", "ppc64le", "powerpc"},
+		{"module option is not an architecture", ".config", "CONFIG_X86_64=m\n", "", ""},
+		{"no config", "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.file != "" {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, tt.file)), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			machine, karch, err := headerTreeArch(dir)
+			if tt.machine == "" {
+				if err == nil {
+					t.Fatalf("headerTreeArch = %s, %s, want an error", machine, karch)
+				}
+				return
+			}
+			if err != nil || machine != tt.machine || karch != tt.karch {
+				t.Errorf("headerTreeArch = %s, %s, %v, want %s, %s", machine, karch, err, tt.machine, tt.karch)
+			}
+		})
+	}
+}
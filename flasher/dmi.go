@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DMIInfo содержит поля DMI, используемые для выбора правил пула
+type DMIInfo struct {
+	SystemManufacturer    string `json:"system_manufacturer,omitempty"`
+	ProductName           string `json:"product_name,omitempty"`
+	SKU                   string `json:"sku,omitempty"`
+	SystemSerial          string `json:"system_serial,omitempty"`
+	SystemUUID            string `json:"system_uuid,omitempty"`
+	BaseboardManufacturer string `json:"baseboard_manufacturer,omitempty"`
+	BaseboardProduct      string `json:"baseboard_product,omitempty"`
+	BoardSerial           string `json:"board_serial,omitempty"`
+}
+
+// readSMBIOS возвращает данные SMBIOS текущей системы: из таблиц в sysfs, а если они недоступны -
+// из /sys/class/dmi/id. Если задан флаг -dmi-file, данные читаются из файла с выводом dmidecode,
+// дампа dmidecode --dump-bin или копии каталога таблиц (для проверки на стенде без реального оборудования)
+func readSMBIOS() (*SMBIOSInfo, error) {
+	if dmiDumpFile != "" {
+		if info, err := os.Stat(dmiDumpFile); err == nil && info.IsDir() {
+			return readSMBIOSTables(dmiDumpFile)
+		}
+		data, err := os.ReadFile(dmiDumpFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DMI dump %s: %v", dmiDumpFile, err)
+		}
+		if isSMBIOSBinaryDump(data) {
+			return decodeSMBIOSDump(data)
+		}
+		return parseSMBIOS(string(data)), nil
+	}
+
+	info, err := readSMBIOSTables(sysfsSMBIOSTables)
+	if err == nil {
+		return info, nil
+	}
+	info, idErr := readDMIIDInfo()
+	if idErr != nil {
+		return nil, fmt.Errorf("SMBIOS tables are not available (%v), fallback failed: %v", err, idErr)
+	}
+	return info, nil
+}
+
+// loadDMIInfo получает и разбирает данные DMI текущей системы
+func loadDMIInfo() (DMIInfo, error) {
+	smbios, err := readSMBIOS()
+	if err != nil {
+		return DMIInfo{}, err
+	}
+
+	info := dmiInfoFromSMBIOS(smbios)
+	if info.ProductName == "" && info.BaseboardProduct == "" {
+		return info, errors.New("could not determine Product Name")
+	}
+	return info, nil
+}
+
+// placeholderDMIValues - значения, которые производители оставляют вместо настоящих идентификаторов
+var placeholderDMIValues = []string{
+	"",
+	"not specified",
+	"not present",
+	"not settable",
+	"none",
+	"default string",
+	"to be filled by o.e.m.",
+	"system serial number",
+	"0123456789",
+	"00000000-0000-0000-0000-000000000000",
+	"ffffffff-ffff-ffff-ffff-ffffffffffff",
+	"03000200-0400-0500-0006-000700080009",
+}
+
+// isUsableDMIValue проверяет, что значение DMI может служить идентификатором платы
+func isUsableDMIValue(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, placeholder := range placeholderDMIValues {
+		if value == placeholder {
+			return false
+		}
+	}
+	return true
+}
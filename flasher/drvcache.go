@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// driverCacheDir - каталог кэша собранных драйверов (по умолчанию <рабочая директория>/driver-cache)
+var driverCacheDir string
+
+// driverSourceExts - файлы исходников, от которых зависит результат сборки
+var driverSourceExts = []string{".c", ".h"}
+
+// driverSourceNames - файлы сборки без расширения, также входящие в хеш исходников
+var driverSourceNames = []string{"Makefile", "Kbuild"}
+
+// DriverCacheKey определяет запись кэша: сборка годится только для того же ядра,
+// архитектуры и тех же исходников
+type DriverCacheKey struct {
+	Kernel     string
+	Arch       string
+	SourceHash string
+}
+
+// dirName возвращает имя каталога записи кэша
+func (k DriverCacheKey) dirName() string {
+	hash := k.SourceHash
+	if len(hash) > 16 {
+		hash = hash[:16]
+	}
+	return fmt.Sprintf("%s-%s-%s", k.Kernel, k.Arch, hash)
+}
+
+// kernelRelease возвращает версию работающего ядра (uname -r)
+func kernelRelease() (string, error) {
+	if release := readSysfsValue("/proc/sys/kernel/osrelease"); release != "" {
+		return release, nil
+	}
+	out, err := runCommand("uname", "-r")
+	if err != nil {
+		return "", fmt.Errorf("Failed to get kernel version: %v", err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// machineArch возвращает архитектуру машины (uname -m)
+func machineArch() (string, error) {
+	out, err := runCommand("uname", "-m")
+	if err != nil {
+		return "", fmt.Errorf("Failed to get machine architecture: %v", err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// driverCacheRoot возвращает каталог кэша драйверов
+func driverCacheRoot() string {
+	if driverCacheDir != "" {
+		return driverCacheDir
+	}
+	return filepath.Join(cDir, "driver-cache")
+}
+
+// hashDriverSources вычисляет SHA-256 по именам и содержимому исходников драйвера
+func hashDriverSources(srcDir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if isDriverSourceFile(d.Name()) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to scan driver sources: %v", err)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no driver sources found in %s", srcDir)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, path := range files {
+		rel, _ := filepath.Rel(srcDir, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isDriverSourceFile проверяет, влияет ли файл на результат сборки драйвера
+func isDriverSourceFile(name string) bool {
+	for _, n := range driverSourceNames {
+		if name == n {
+			return true
+		}
+	}
+	for _, ext := range driverSourceExts {
+		if strings.HasSuffix(name, ext) && !strings.HasSuffix(name, ".mod.c") {
+			return true
+		}
+	}
+	return false
+}
+
+// currentDriverCacheKey вычисляет ключ кэша для работающего ядра
+func currentDriverCacheKey(srcDir string) (DriverCacheKey, error) {
+	var key DriverCacheKey
+	var err error
+
+	if key.Kernel, err = kernelRelease(); err != nil {
+		return key, err
+	}
+	if key.Arch, err = machineArch(); err != nil {
+		return key, err
+	}
+	if key.SourceHash, err = hashDriverSources(srcDir); err != nil {
+		return key, err
+	}
+	return key, nil
+}
+
+// cachedDriverPath возвращает путь к собранному модулю из кэша, собирая его при отсутствии,
+// несовпадении vermagic или по требованию rebuild
+func cachedDriverPath(srcDir, moduleName string, rebuild bool) (string, error) {
+	key, err := currentDriverCacheKey(srcDir)
+	if err != nil {
+		return "", err
+	}
+
+	entryDir := filepath.Join(driverCacheRoot(), key.dirName())
+	modulePath := filepath.Join(entryDir, moduleName+".ko")
+
+	if !rebuild {
+		if _, err := os.Stat(modulePath); err == nil {
+			err := checkModuleVermagic(modulePath, key.Kernel)
+			if err == nil {
+				fmt.Printf("[INFO] Using cached driver %s\n", modulePath)
+				if err := ensureModuleSigned(modulePath, key.Kernel); err != nil {
+					return "", err
+				}
+				return modulePath, nil
+			}
+			fmt.Printf(colorYellow+"[WARNING] Cached driver %s is unusable: %v. Rebuilding...\n"+colorReset, modulePath, err)
+		}
+	}
+
+	if err := buildDriverIntoCache(srcDir, entryDir, moduleName, key); err != nil {
+		return "", err
+	}
+	if err := ensureModuleSigned(modulePath, key.Kernel); err != nil {
+		return "", err
+	}
+	return modulePath, nil
+}
+
+// buildDriverIntoCache собирает модуль и сохраняет его вместе с журналом сборки в записи кэша
+func buildDriverIntoCache(srcDir, entryDir, moduleName string, key DriverCacheKey) error {
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return fmt.Errorf("failed to create driver cache directory: %v", err)
+	}
+
+	logPath := filepath.Join(entryDir, "build.log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return fmt.Errorf("failed to create build log: %v", err)
+	}
+	defer logFile.Close()
+
+	fmt.Fprintf(logFile, "Build started: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(logFile, "Kernel: %s\nArch: %s\nSource hash: %s\nSource dir: %s\n\n", key.Kernel, key.Arch, key.SourceHash, srcDir)
+
+	fmt.Printf("[INFO] Compiling module %s for kernel %s.\n", moduleName, key.Kernel)
+	stage := beginStage("driver build")
+	stage.detail(fmt.Sprintf("%s for kernel %s", moduleName, key.Kernel))
+	buildErr := runRecorded(exec.CommandContext(commandContext(), "make", "-C", srcDir, "clean", "all"), logFile)
+	stage.finish(buildErr)
+
+	fmt.Fprintf(logFile, "\nBuild finished: %s\n", time.Now().Format(time.RFC3339))
+	if buildErr != nil {
+		fmt.Fprintf(logFile, "Result: FAILED (%v)\n", buildErr)
+		return fmt.Errorf("Compilation failed: %v (see %s)", buildErr, logPath)
+	}
+
+	builtModule := filepath.Join(srcDir, moduleName+".ko")
+	if _, err := os.Stat(builtModule); errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(logFile, "Result: FAILED (module %s not produced)\n", builtModule)
+		return fmt.Errorf("Compiled module %s not found (see %s)", builtModule, logPath)
+	}
+
+	if err := checkModuleVermagic(builtModule, key.Kernel); err != nil {
+		fmt.Fprintf(logFile, "Result: FAILED (%v)\n", err)
+		return fmt.Errorf("Compiled module does not match running kernel: %v (see %s)", err, logPath)
+	}
+
+	if err := copyFile(builtModule, filepath.Join(entryDir, moduleName+".ko")); err != nil {
+		return fmt.Errorf("failed to store module in cache: %v", err)
+	}
+
+	fmt.Fprintln(logFile, "Result: OK")
+	fmt.Println("[INFO] Compilation completed successfully.")
+	return nil
+}
+
+// moduleVermagic извлекает строку vermagic из секции .modinfo модуля ядра
+func moduleVermagic(modulePath string) (string, error) {
+	data, err := os.ReadFile(modulePath)
+	if err != nil {
+		return "", err
+	}
+
+	marker := []byte("vermagic=")
+	idx := bytes.Index(data, marker)
+	if idx == -1 {
+		return "", fmt.Errorf("no vermagic found in %s", modulePath)
+	}
+	value := data[idx+len(marker):]
+	if end := bytes.IndexByte(value, 0); end != -1 {
+		value = value[:end]
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// checkModuleVermagic проверяет, что модуль собран для указанной версии ядра
+func checkModuleVermagic(modulePath, kernel string) error {
+	vermagic, err := moduleVermagic(modulePath)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(vermagic)
+	if len(fields) == 0 || fields[0] != kernel {
+		return fmt.Errorf("vermagic %q does not match kernel %s", vermagic, kernel)
+	}
+	return nil
+}
+
+// copyFile копирует файл через временный файл в том же каталоге
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Состояния адреса в пуле, как их ведёт MAC Pool Manager
+const (
+	stateFree        = "free"        // можно выдавать
+	statePending     = "pending"     // выдан флешеру, прошивка не завершена
+	stateUsed        = "used"        // записан в плату
+	stateRetired     = "retired"     // плата списана, адрес больше не выдаётся
+	stateQuarantined = "quarantined" // судьба адреса неизвестна, требуется проверка
+	stateDefective   = "defective"   // плата с адресом неисправна
+)
+
+// allowedTransitions - разрешённые переходы между состояниями, те же, что в MAC Pool Manager
+var allowedTransitions = map[string][]string{
+	stateFree:        {statePending, stateRetired, stateQuarantined},
+	statePending:     {stateUsed, stateFree, stateQuarantined},
+	stateUsed:        {stateRetired, stateQuarantined, stateDefective, stateFree},
+	stateQuarantined: {stateFree, stateUsed, stateRetired, stateDefective},
+	stateDefective:   {stateRetired, stateQuarantined},
+	stateRetired:     {},
+}
+
+// addressState возвращает состояние адреса. Пулы без поля state хранят только признак Used
+func addressState(addr MACAddress) string {
+	if addr.State != "" {
+		return addr.State
+	}
+	if addr.Used {
+		return stateUsed
+	}
+	return stateFree
+}
+
+// isAddressAvailable проверяет, что адрес можно выдать плате: только свободные и незарезервированные
+func isAddressAvailable(addr MACAddress) bool {
+	return addressState(addr) == stateFree && !isReserved(addr)
+}
+
+// canTransition проверяет, разрешён ли переход между состояниями
+func canTransition(from, to string) bool {
+	for _, s := range allowedTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// setAddressState переводит адрес в новое состояние, если переход разрешён. Признак Used
+// остаётся установленным для всех состояний, кроме свободного: старые версии флешера смотрят только на него
+func setAddressState(addr *MACAddress, to string) error {
+	from := addressState(*addr)
+	if from == to {
+		return nil
+	}
+	if !canTransition(from, to) {
+		return fmt.Errorf("%s: transition from %s to %s is not allowed", addr.Address, from, to)
+	}
+	addr.State = to
+	addr.Used = to != stateFree
+	if to == stateFree {
+		addr.UsedAt = time.Time{}
+		addr.UsedBy = ""
+	}
+	return nil
+}
+
+// changeAllocationState переводит адреса выделения в состояние to. Адреса, которые находятся
+// не в состоянии from, не изменяются. Возвращает число изменённых адресов
+func changeAllocationState(pool MACPool, addresses []string, from, to string) (int, error) {
+	changed := 0
+	for _, address := range addresses {
+		for i := range pool.Addresses {
+			if !strings.EqualFold(pool.Addresses[i].Address, address) {
+				continue
+			}
+			if addressState(pool.Addresses[i]) != from {
+				break
+			}
+			if err := setAddressState(&pool.Addresses[i], to); err != nil {
+				return changed, err
+			}
+			changed++
+			break
+		}
+	}
+	return changed, nil
+}
+
+// claimAllocation переводит выбранные адреса в pending и сохраняет пул, чтобы другие станции
+// не выдали их, пока идёт прошивка
+func claimAllocation(pool MACPool, password string, allocation Allocation) error {
+	changed, err := changeAllocationState(pool, allocation.Addresses, stateFree, statePending)
+	if err != nil {
+		return err
+	}
+	if changed != len(allocation.Addresses) {
+		return fmt.Errorf("only %d of %d selected addresses are still free", changed, len(allocation.Addresses))
+	}
+	return updatePool(pool, password, poolFilePath)
+}
+
+// releaseAllocation возвращает незавершённые (pending) адреса в состояние to: free, если запись
+// не начиналась, или quarantined, если адрес мог частично попасть в железо
+func releaseAllocation(pool MACPool, password string, addresses []string, to string) {
+	changed, err := changeAllocationState(pool, addresses, statePending, to)
+	if err != nil {
+		fmt.Printf(colorYellow+"[WARNING] Could not release pending addresses: %v\n"+colorReset, err)
+		return
+	}
+	if changed == 0 {
+		return
+	}
+	if err := updatePool(pool, password, poolFilePath); err != nil {
+		return
+	}
+	fmt.Printf("[INFO] %d pending address(es) marked as %s in the pool.\n", changed, to)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetAddressState(t *testing.T) {
+	claimed := MACAddress{Address: "00:e0:4c:00:00:01", Used: true, State: statePending, UsedAt: time.Now(), UsedBy: "host-a eth0"}
+
+	tests := []struct {
+		name   string
+		addr   MACAddress
+		to     string
+		ok     bool
+		used   bool
+		usedBy string
+	}{
+		{"released address forgets its board", claimed, stateFree, true, false, ""},
+		{"completed flash keeps the board", claimed, stateUsed, true, true, "host-a eth0"},
+		{"interrupted flash is quarantined", claimed, stateQuarantined, true, true, "host-a eth0"},
+		{"legacy used flag", MACAddress{Address: "00:e0:4c:00:00:02", Used: true, UsedBy: "host-b"}, stateFree, true, false, ""},
+		{"pending cannot be retired", claimed, stateRetired, false, true, "host-a eth0"},
+		{"retired is final", MACAddress{Address: "00:e0:4c:00:00:03", Used: true, State: stateRetired}, stateFree, false, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := tt.addr
+			err := setAddressState(&addr, tt.to)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error = %v, want ok=%v", err, tt.ok)
+			}
+			if addr.Used != tt.used || addr.UsedBy != tt.usedBy {
+				t.Errorf("used=%v usedBy=%q, want used=%v usedBy=%q", addr.Used, addr.UsedBy, tt.used, tt.usedBy)
+			}
+			if tt.ok && addressState(addr) != tt.to {
+				t.Errorf("state = %s, want %s", addressState(addr), tt.to)
+			}
+			if tt.ok && tt.to == stateFree && !addr.UsedAt.IsZero() {
+				t.Errorf("UsedAt = %v, want it cleared", addr.UsedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Ключ станции по умолчанию и алгоритм подписи логов
+const (
+	defaultStationKey = "station_ed25519.key"
+	logSignatureAlgo  = "ed25519"
+)
+
+// stationKeyPath - путь к закрытому ключу станции, задаётся флагом -station-key
+var stationKeyPath string
+
+// Хэши состояния пула до и после операции, попадают в подписанный лог
+var (
+	poolHashBefore string
+	poolHashAfter  string
+)
+
+// LogSignature - подпись лога ключом станции
+type LogSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`     // первые 8 байт SHA-256 открытого ключа в hex
+	PublicKey string `json:"public_key"` // открытый ключ в base64, только для справки: проверка идёт по доверенным ключам
+	Value     string `json:"value"`      // подпись в base64
+}
+
+// poolStateHash возвращает SHA-256 пула в том виде, в каком по нему считается HMAC подпись
+func poolStateHash(pool MACPool) string {
+	data, err := json.Marshal(pool)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// stationKeyID возвращает короткий идентификатор открытого ключа
+func stationKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// resolveStationKeyPath возвращает путь к ключу станции с учётом флага
+func resolveStationKeyPath() string {
+	if stationKeyPath != "" {
+		return stationKeyPath
+	}
+	return filepath.Join(cDir, defaultStationKey)
+}
+
+// loadStationKey читает закрытый ключ станции, при отсутствии создаёт новый вместе с файлом .pub
+func loadStationKey() (ed25519.PrivateKey, error) {
+	path := resolveStationKeyPath()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return generateStationKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read station key: %v", err)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		fmt.Printf(colorYellow+"[WARNING] Station key %s is accessible by other users, run: chmod 600 %s\n"+colorReset, path, path)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a PEM encoded private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse station key: %v", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("station key %s is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// generateStationKey создаёт ключ станции и сохраняет открытую часть рядом для регистрации в менеджере
+func generateStationKey(path string) (ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate station key: %v", err)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create station key directory: %v", err)
+	}
+	// O_EXCL: ключ, созданный параллельно запущенной копией, не перезаписываем
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create station key: %v", err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: privDER}); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write station key: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write station key: %v", err)
+	}
+
+	pubPath := strings.TrimSuffix(path, ".key") + ".pub"
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		fmt.Printf(colorYellow+"[WARNING] Could not save station public key: %v\n"+colorReset, err)
+	}
+
+	fmt.Printf(colorGreen+"[INFO] Generated station signing key %s (key ID %s)\n"+colorReset, path, stationKeyID(pub))
+	fmt.Printf(colorGreen+"[INFO] Register %s in MAC Pool Manager to verify logs from this station\n"+colorReset, pubPath)
+	return priv, nil
+}
+
+// canonicalLogPayload возвращает данные лога, по которым считается подпись: объект верхнего уровня
+// без поля signature с ключами по алфавиту и без пробелов. Форматирование файла на подпись не влияет
+func canonicalLogPayload(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "signature")
+	return json.Marshal(fields)
+}
+
+// signLog подписывает лог ключом станции и встраивает подпись в документ
+func signLog(logData *LogData) error {
+	key, err := loadStationKey()
+	if err != nil {
+		return err
+	}
+
+	logData.Signature = nil
+	unsigned, err := json.Marshal(logData)
+	if err != nil {
+		return err
+	}
+	payload, err := canonicalLogPayload(unsigned)
+	if err != nil {
+		return err
+	}
+
+	pub := key.Public().(ed25519.PublicKey)
+	logData.Signature = &LogSignature{
+		Algorithm: logSignatureAlgo,
+		KeyID:     stationKeyID(pub),
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Каталог очереди неотправленных логов и таймаут отправки
+const (
+	logSpoolDir    = "log-spool"
+	logSendTimeout = 15 * time.Second
+	logTokenEnv    = "FLASHER_LOG_TOKEN"
+	rejectedDir    = "rejected" // подкаталог очереди для логов, которые получатель не примет
+)
+
+// errLogRejected - получатель окончательно отказался принять лог, повторная отправка не поможет
+var errLogRejected = errors.New("log rejected")
+
+// Параметры отправки логов, задаются флагами
+var (
+	logURL         string // адрес HTTPS для отправки логов
+	logTokenFile   string // файл с токеном Bearer
+	logClientCert  string // клиентский сертификат для mTLS
+	logClientKey   string // ключ клиентского сертификата
+	logCAFile      string // сертификат центра сертификации сервера
+	knownHostsPath string // файл known_hosts для scp
+)
+
+// LogSink - место доставки логов операций
+type LogSink interface {
+	// Name возвращает имя получателя, оно же - подкаталог очереди
+	Name() string
+	// Send доставляет лог с указанным именем файла
+	Send(filename string, data []byte) error
+}
+
+// fileSink сохраняет логи в локальный каталог
+type fileSink struct {
+	dir string
+}
+
+func (s *fileSink) Name() string {
+	return "file"
+}
+
+func (s *fileSink) Send(filename string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("could not create log directory: %v", err)
+	}
+	return os.WriteFile(filepath.Join(s.dir, filename), data, 0644)
+}
+
+// httpsSink отправляет логи POST-запросом с токеном Bearer и/или клиентским сертификатом
+type httpsSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (s *httpsSink) Name() string {
+	return "https"
+}
+
+func (s *httpsSink) Send(filename string, data []byte) error {
+	req, err := http.NewRequestWithContext(commandContext(), http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Log-Filename", filename)
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 409 - сервер уже получил этот лог при предыдущей попытке
+	if resp.StatusCode/100 == 2 || resp.StatusCode == http.StatusConflict {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if permanentRejection(resp.StatusCode) {
+		return fmt.Errorf("%w: server responded %s: %s", errLogRejected, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return fmt.Errorf("server responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// permanentRejection сообщает, что ответ 4xx относится к самому логу. Ошибки доступа и
+// ограничения частоты устраняются на стороне станции или сервера, такой лог отправляется повторно
+func permanentRejection(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return status/100 == 4
+}
+
+// newHTTPSSink создаёт получателя HTTPS с настройками TLS из флагов
+func newHTTPSSink(url string) (*httpsSink, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("log URL %q must use https", url)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if logCAFile != "" {
+		pem, err := os.ReadFile(logCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", logCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if logClientCert != "" || logClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(logClientCert, logClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	token := os.Getenv(logTokenEnv)
+	if logTokenFile != "" {
+		data, err := os.ReadFile(logTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log token: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	return &httpsSink{
+		url:   url,
+		token: token,
+		client: &http.Client{
+			Timeout:   logSendTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// scpSink копирует логи по scp с проверкой ключа сервера по known_hosts
+type scpSink struct {
+	server     string // user@host:path
+	knownHosts string
+}
+
+func (s *scpSink) Name() string {
+	return "scp"
+}
+
+func (s *scpSink) Send(filename string, data []byte) error {
+	tempFile, err := os.CreateTemp("", "mac-log-*.json")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file for log: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("could not write to temporary file: %v", err)
+	}
+	tempFile.Close()
+
+	// Parse server string to host and path
+	host, remotePath, _ := strings.Cut(s.server, ":")
+	destination := fmt.Sprintf("%s:%s", host, filename)
+	if remotePath != "" {
+		destination = fmt.Sprintf("%s:%s/%s", host, remotePath, filename)
+	}
+
+	args := []string{"-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes",
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(logSendTimeout.Seconds()))}
+	if s.knownHosts != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+s.knownHosts)
+	}
+	args = append(args, tempFile.Name(), destination)
+
+	cmd := exec.CommandContext(commandContext(), "scp", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "Host key verification failed") || strings.Contains(string(output), "No ED25519 host key") {
+			return fmt.Errorf("host key of %s is not in known_hosts; add it with ssh-keyscan after verifying the fingerprint", host)
+		}
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// brokenSink - получатель, который не удалось настроить. Логи для него попадают в очередь
+type brokenSink struct {
+	name string
+	err  error
+}
+
+func (s *brokenSink) Name() string {
+	return s.name
+}
+
+func (s *brokenSink) Send(filename string, data []byte) error {
+	return fmt.Errorf("misconfigured: %v", s.err)
+}
+
+// remoteLogSinks возвращает настроенных удалённых получателей логов
+func remoteLogSinks() []LogSink {
+	var sinks []LogSink
+	if logURL != "" {
+		sink, err := newHTTPSSink(logURL)
+		if err != nil {
+			sinks = append(sinks, &brokenSink{name: "https", err: err})
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+	if logServer != "" {
+		sinks = append(sinks, &scpSink{server: logServer, knownHosts: knownHostsPath})
+	}
+	return sinks
+}
+
+// spoolPath возвращает каталог очереди для получателя
+func spoolPath(sink string) string {
+	return filepath.Join(cDir, logSpoolDir, sink)
+}
+
+// spoolLog сохраняет неотправленный лог для повторной отправки
+func spoolLog(sink, filename string, data []byte) error {
+	dir := spoolPath(sink)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, filename), data, 0600)
+}
+
+// rejectLog переносит лог, который получатель не примет, в подкаталог rejected очереди,
+// чтобы он не задерживал отправку остальных
+func rejectLog(sink, filename string, data []byte) (string, error) {
+	dir := filepath.Join(spoolPath(sink), rejectedDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filename)
+	return path, os.WriteFile(path, data, 0600)
+}
+
+// deliverLog сохраняет лог локально и отправляет удалённым получателям.
+// Лог, который не удалось отправить, остаётся в очереди до следующего запуска или flush-logs
+func deliverLog(filename string, data []byte) {
+	if logToFile {
+		sink := &fileSink{dir: filepath.Join(cDir, "logs")}
+		if err := sink.Send(filename, data); err != nil {
+			fmt.Printf(colorYellow+"[WARNING] Could not write log file: %v.\n"+colorReset, err)
+		} else {
+			fmt.Printf(colorGreen+"[INFO] Log saved to: %s\n"+colorReset, filepath.Join(sink.dir, filename))
+		}
+	}
+
+	for _, sink := range remoteLogSinks() {
+		if err := sink.Send(filename, data); err != nil {
+			fmt.Printf(colorYellow+"[WARNING] Could not send log via %s: %v\n"+colorReset, sink.Name(), err)
+			if errors.Is(err, errLogRejected) {
+				if path, rejectErr := rejectLog(sink.Name(), filename, data); rejectErr != nil {
+					fmt.Printf(colorRed+"[ERROR] Could not save rejected log: %v\n"+colorReset, rejectErr)
+				} else {
+					fmt.Printf(colorYellow+"[WARNING] Log saved to %s, it will not be sent again\n"+colorReset, path)
+				}
+				continue
+			}
+			if spoolErr := spoolLog(sink.Name(), filename, data); spoolErr != nil {
+				fmt.Printf(colorRed+"[ERROR] Could not spool log for later upload: %v\n"+colorReset, spoolErr)
+			} else {
+				fmt.Printf(colorYellow+"[WARNING] Log queued in %s and will be sent on the next run or with 'flush-logs'\n"+colorReset, spoolPath(sink.Name()))
+			}
+			continue
+		}
+		fmt.Printf(colorGreen+"[INFO] Log sent via %s: %s\n"+colorReset, sink.Name(), filename)
+	}
+}
+
+// flushLogSpool повторно отправляет логи из очереди. Логи, которые получатель окончательно
+// отклонил, переносятся в подкаталог rejected. Возвращает число отправленных, оставшихся
+// в очереди и отклонённых логов
+func flushLogSpool() (sent, pending, rejected int) {
+	bySink := make(map[string]LogSink)
+	for _, s := range remoteLogSinks() {
+		bySink[s.Name()] = s
+	}
+
+	dirs, err := os.ReadDir(filepath.Join(cDir, logSpoolDir))
+	if err != nil {
+		return 0, 0, 0
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(spoolPath(dir.Name()))
+		if err != nil {
+			continue
+		}
+		var names []string
+		for _, e := range entries {
+			if e.Type().IsRegular() {
+				names = append(names, e.Name())
+			}
+		}
+		sort.Strings(names)
+
+		sink, configured := bySink[dir.Name()]
+		if !configured {
+			pending += len(names)
+			continue
+		}
+
+		for i, name := range names {
+			path := filepath.Join(spoolPath(dir.Name()), name)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				pending++
+				continue
+			}
+			err = sink.Send(name, data)
+			if errors.Is(err, errLogRejected) {
+				dest := filepath.Join(spoolPath(dir.Name()), rejectedDir, name)
+				if mkErr := os.MkdirAll(filepath.Dir(dest), 0700); mkErr != nil {
+					err = mkErr
+				} else if mvErr := os.Rename(path, dest); mvErr != nil {
+					err = mvErr
+				} else {
+					fmt.Printf(colorYellow+"[WARNING] Spooled log %s was rejected via %s and moved to %s: %v\n"+colorReset, name, sink.Name(), dest, err)
+					rejected++
+					continue
+				}
+			}
+			if err != nil {
+				fmt.Printf(colorYellow+"[WARNING] Spooled log %s still cannot be sent via %s: %v\n"+colorReset, name, sink.Name(), err)
+				// Получатель недоступен - остальные логи не пытаемся отправить
+				pending += len(names) - i
+				break
+			}
+			os.Remove(path)
+			sent++
+		}
+	}
+	return sent, pending, rejected
+}
+
+// retrySpooledLogs отправляет логи, оставшиеся в очереди с прошлых запусков
+func retrySpooledLogs() {
+	sent, pending, rejected := flushLogSpool()
+	if sent > 0 {
+		fmt.Printf(colorGreen+"[INFO] %d spooled log(s) sent\n"+colorReset, sent)
+	}
+	if rejected > 0 {
+		fmt.Printf(colorYellow+"[WARNING] %d spooled log(s) were rejected by the server, see the %s subdirectories in %s\n"+colorReset, rejected, rejectedDir, filepath.Join(cDir, logSpoolDir))
+	}
+	if pending > 0 {
+		fmt.Printf(colorYellow+"[WARNING] %d log(s) are still waiting in %s\n"+colorReset, pending, filepath.Join(cDir, logSpoolDir))
+	}
+}
+
+// runFlushLogsCommand выполняет подкоманду flush-logs
+func runFlushLogsCommand() int {
+	var err error
+	if cDir, err = os.Getwd(); err != nil {
+		criticalError("Could not get current directory: " + err.Error())
+		return 1
+	}
+	if logURL == "" && logServer == "" {
+		criticalError("No log destination configured, use -log-url or -server")
+		return 1
+	}
+
+	sent, pending, rejected := flushLogSpool()
+	fmt.Printf("Sent: %d, still pending: %d, rejected: %d\n", sent, pending, rejected)
+	if pending > 0 || rejected > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testCollector запускает HTTPS-сервер, который отвечает на лог кодом из statuses по имени файла,
+// и настраивает отправку логов на него
+func testCollector(t *testing.T, statuses map[string]int) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, ok := statuses[r.Header.Get("X-Log-Filename")]
+		if !ok {
+			status = http.StatusCreated
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	savedURL, savedCA, savedServer, savedDir := logURL, logCAFile, logServer, cDir
+	t.Cleanup(func() { logURL, logCAFile, logServer, cDir = savedURL, savedCA, savedServer, savedDir })
+	logURL, logCAFile, logServer, cDir = srv.URL, caFile, "", t.TempDir()
+}
+
+// listDir возвращает имена обычных файлов каталога
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFlushLogSpool(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses map[string]int
+		sent     int
+		pending  int
+		rejected []string
+	}{
+		{
+			name:     "rejected log is moved aside and flushing continues",
+			statuses: map[string]int{"b.json": http.StatusUnprocessableEntity, "c.json": http.StatusConflict},
+			sent:     2,
+			rejected: []string{"b.json"},
+		},
+		{
+			name:     "server error stops the flush",
+			statuses: map[string]int{"b.json": http.StatusServiceUnavailable},
+			sent:     1,
+			pending:  2,
+		},
+		{
+			name:     "authentication failure is retried later",
+			statuses: map[string]int{"a.json": http.StatusUnauthorized},
+			pending:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCollector(t, tt.statuses)
+			for _, name := range []string{"a.json", "b.json", "c.json"} {
+				if err := spoolLog("https", name, []byte(`{}`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sent, pending, rejected := flushLogSpool()
+			if sent != tt.sent || pending != tt.pending || rejected != len(tt.rejected) {
+				t.Errorf("sent/pending/rejected = %d/%d/%d, want %d/%d/%d", sent, pending, rejected, tt.sent, tt.pending, len(tt.rejected))
+			}
+			if got := listDir(t, filepath.Join(spoolPath("https"), rejectedDir)); !reflect.DeepEqual(got, tt.rejected) {
+				t.Errorf("rejected files = %v, want %v", got, tt.rejected)
+			}
+			if got := len(listDir(t, spoolPath("https"))); got != tt.pending {
+				t.Errorf("%d files left in the spool, want %d", got, tt.pending)
+			}
+		})
+	}
+}
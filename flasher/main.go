@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
@@ -15,9 +16,9 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -37,16 +38,18 @@ const (
 )
 
 var (
-	cDir        string // текущая рабочая директория
-	mac         string // MAC-адрес из пула
-	rtDrv       string // имя удалённого конфликтующего драйвера
-	productName string // имя продукта из dmidecode
+	cDir        string  // текущая рабочая директория
+	mac         string  // MAC-адрес из пула
+	productName string  // имя продукта из SMBIOS
+	dmiInfo     DMIInfo // данные DMI платы
 
 	// Параметры
 	poolFilePath string // путь к файлу с пулом MAC-адресов
 	noReboot     bool   // флаг для отключения автоматической перезагрузки
 	logToFile    bool   // флаг для сохранения лога в файл
 	logServer    string // адрес сервера для отправки лога (формат: user@host:path)
+	dmiDumpFile  string // файл с выводом или дампом dmidecode вместо таблиц SMBIOS
+	backendName  string // принудительно выбранный способ прошивки
 )
 
 // ANSI escape sequences для цветного вывода
@@ -63,33 +66,96 @@ const (
 
 // MACPool содержит пул MAC-адресов и метаданные
 type MACPool struct {
-	Version         int          `json:"version"`
-	Addresses       []MACAddress `json:"addresses"`
-	LastUpdated     time.Time    `json:"last_updated"`
-	CreatedBy       string       `json:"created_by"`
-	Signature       string       `json:"signature,omitempty"` // HMAC подпись
-	MACVendorPrefix string       `json:"mac_vendor_prefix,omitempty"`
+	Version         int               `json:"version"`
+	Addresses       []MACAddress      `json:"addresses"`
+	LastUpdated     time.Time         `json:"last_updated"`
+	CreatedBy       string            `json:"created_by"`
+	Signature       string            `json:"signature,omitempty"` // HMAC подпись
+	MACVendorPrefix string            `json:"mac_vendor_prefix,omitempty"`
+	Policy          *AllocationPolicy `json:"policy,omitempty"`    // Правила выделения адресов по данным DMI
+	Approvers       []Approver        `json:"approvers,omitempty"` // Подтверждающие сброс адресов
+	Journal         []PoolEvent       `json:"journal,omitempty"`   // Журнал сбросов адресов
+}
+
+// Approver - сотрудник, чей пароль подтверждает сброс использованных адресов
+type Approver struct {
+	Name string `json:"name"`
+	Salt string `json:"salt"` // base64
+	Hash string `json:"hash"` // PBKDF2-SHA256 пароля, base64
+}
+
+// PoolEvent - запись журнала пула о сбросе адресов
+type PoolEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Addresses []string  `json:"addresses"`
+	Reason    string    `json:"reason"`
+	Operator  string    `json:"operator,omitempty"`
+	Approver  string    `json:"approver,omitempty"`
+	Evidence  string    `json:"evidence,omitempty"` // сверка с логами или запись о возврате оборудования
 }
 
 // MACAddress представляет MAC-адрес и его статус
 type MACAddress struct {
-	Address  string    `json:"address"`
-	Used     bool      `json:"used"`
-	UsedAt   time.Time `json:"used_at,omitempty"`
-	UsedBy   string    `json:"used_by,omitempty"`
-	Reserved bool      `json:"reserved,omitempty"`
-	Comment  string    `json:"comment,omitempty"`
+	Address     string           `json:"address"`
+	Used        bool             `json:"used"`
+	State       string           `json:"state,omitempty"` // Состояние жизненного цикла; пустое - по признаку Used
+	UsedAt      time.Time        `json:"used_at,omitempty"`
+	UsedBy      string           `json:"used_by,omitempty"`
+	Reserved    bool             `json:"reserved,omitempty"`
+	Reservation *Reservation     `json:"reservation,omitempty"` // Причина и срок резервирования
+	Comment     string           `json:"comment,omitempty"`
+	Binding     *HardwareBinding `json:"binding,omitempty"` // Плата, на которую записан адрес
+}
+
+// Reservation описывает, кто и зачем зарезервировал адрес
+type Reservation struct {
+	Reason     string    `json:"reason"`
+	Owner      string    `json:"owner"`
+	ReservedAt time.Time `json:"reserved_at"`
+	ReservedBy string    `json:"reserved_by,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"` // Нулевое значение - бессрочно
+}
+
+// HardwareBinding связывает выделенный адрес с конкретной платой
+type HardwareBinding struct {
+	SystemUUID         string `json:"system_uuid,omitempty"`
+	SystemSerial       string `json:"system_serial,omitempty"`
+	BoardSerial        string `json:"board_serial,omitempty"`
+	Interface          string `json:"interface,omitempty"`
+	PCIAddress         string `json:"pci_address,omitempty"` // Адрес на шине, например 0000:03:00.0
+	PCIVendor          string `json:"pci_vendor,omitempty"`  // Идентификаторы в формате 0x10ec
+	PCIDevice          string `json:"pci_device,omitempty"`
+	PCISubsystemVendor string `json:"pci_subsystem_vendor,omitempty"`
+	PCISubsystemDevice string `json:"pci_subsystem_device,omitempty"`
+	PreviousMAC        string `json:"previous_mac,omitempty"` // Заводской MAC-адрес до прошивки
 }
 
+// logSchemaVersion - версия формата лога операции. Версия 2: system_info содержит типизированные
+// записи SMBIOS вместо карты секций dmidecode; версия 3: этапы операции с запущенными командами,
+// сетевые карты и отпечаток файла пула. Логи без поля schema_version имеют версию 1
+const logSchemaVersion = 3
+
 // LogData структура для хранения информации о процессе
 type LogData struct {
-	Timestamp       string                 `json:"timestamp"`
-	ProductName     string                 `json:"product_name"`
-	MacAddress      string                 `json:"mac_address"`
-	ActionPerformed string                 `json:"action_performed"`
-	Success         bool                   `json:"success"`
-	SystemInfo      map[string]interface{} `json:"system_info"`
-	HostInfo        map[string]string      `json:"host_info"`
+	SchemaVersion   int                  `json:"schema_version"`
+	Timestamp       string               `json:"timestamp"`
+	ProductName     string               `json:"product_name"`
+	MacAddress      string               `json:"mac_address"`
+	ActionPerformed string               `json:"action_performed"`
+	Success         bool                 `json:"success"`
+	SystemInfo      *SMBIOSInfo          `json:"system_info,omitempty"`
+	HostInfo        map[string]string    `json:"host_info"`
+	StartedAt       string               `json:"started_at,omitempty"`
+	DurationMs      int64                `json:"duration_ms,omitempty"`
+	Backend         string               `json:"backend,omitempty"`
+	WriteAttempts   int                  `json:"write_attempts,omitempty"`
+	Stages          []OperationStage     `json:"stages,omitempty"`
+	Interfaces      []InterfaceRecord    `json:"interfaces,omitempty"` // сетевые карты с MAC до и после операции
+	PoolFile        *PoolFileFingerprint `json:"pool_file,omitempty"`
+	PoolHashBefore  string               `json:"pool_hash_before,omitempty"` // SHA-256 пула до операции
+	PoolHashAfter   string               `json:"pool_hash_after,omitempty"`  // SHA-256 пула после операции
+	Signature       *LogSignature        `json:"signature,omitempty"`        // подпись ключом станции
 }
 
 func main() {
@@ -97,73 +163,285 @@ func main() {
 	poolFilePtr := flag.String("pool", defaultPoolFile, "Path to encrypted MAC address pool file")
 	noRebootPtr := flag.Bool("no-reboot", false, "Do not reboot after MAC address flash")
 	logFilePtr := flag.Bool("log", true, "Save log to file")
-	logServerPtr := flag.String("server", "", "Server to send log to (format: user@host:path)")
-	flag.Parse()
+	logServerPtr := flag.String("server", "", "Server to send log to via scp (format: user@host:path)")
+	logURLPtr := flag.String("log-url", "", "HTTPS endpoint to POST logs to")
+	logTokenFilePtr := flag.String("log-token-file", "", "File with bearer token for -log-url (default: $"+logTokenEnv+")")
+	logCertPtr := flag.String("log-cert", "", "Client certificate for mTLS log upload")
+	logKeyPtr := flag.String("log-key", "", "Private key for -log-cert")
+	logCAPtr := flag.String("log-ca", "", "CA certificate to verify the log server")
+	knownHostsPtr := flag.String("known-hosts", "", "known_hosts file for scp log upload (default: ~/.ssh/known_hosts)")
+	dmiFilePtr := flag.String("dmi-file", "", "Read SMBIOS data from dmidecode output or a dmidecode --dump-bin file instead of sysfs (samples in testdata)")
+	backendPtr := flag.String("backend", "", "Flashing backend to use (rtnicpg); detected from PCI IDs by default")
+	driverCachePtr := flag.String("driver-cache", "", "Directory for cached driver builds (default: ./driver-cache)")
+	driverBundlePtr := flag.String("driver-bundle", "", "Pre-built driver bundle directory or .tar.gz (default: ./driver-bundle if present)")
+	signKeyPtr := flag.String("sign-key", "", "Private key for signing the driver module on Secure Boot systems")
+	signCertPtr := flag.String("sign-cert", "", "Certificate matching -sign-key, must be enrolled as a MOK")
+	signHashPtr := flag.String("sign-hash", "sha256", "Hash algorithm for module signing")
+	stationKeyPtr := flag.String("station-key", "", "Ed25519 key for signing operation logs (default: ./"+defaultStationKey+", created if missing)")
+	rewriteProfilesPtr := flag.String("rewrite-profiles", "ask", "Rewrite network profiles bound to the old MAC address (ask, yes, no)")
+
+	// Подкоманда указывается первым аргументом, флаги следуют за ней
+	subcommand := ""
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subcommand = args[0]
+		args = args[1:]
+	}
+	if subcommand == "build-bundle" {
+		os.Exit(runBuildBundleCommand(args))
+	}
+	flag.CommandLine.Parse(args)
 
 	poolFilePath = *poolFilePtr
 	noReboot = *noRebootPtr
 	logToFile = *logFilePtr
 	logServer = *logServerPtr
+	logURL = *logURLPtr
+	logTokenFile = *logTokenFilePtr
+	logClientCert = *logCertPtr
+	logClientKey = *logKeyPtr
+	logCAFile = *logCAPtr
+	knownHostsPath = *knownHostsPtr
+	dmiDumpFile = *dmiFilePtr
+	backendName = *backendPtr
+	driverCacheDir = *driverCachePtr
+	driverBundlePath = *driverBundlePtr
+	signKeyPath = *signKeyPtr
+	signCertPath = *signCertPtr
+	signHashAlgo = *signHashPtr
+	stationKeyPath = *stationKeyPtr
+	rewriteProfiles = strings.ToLower(*rewriteProfilesPtr)
+	if rewriteProfiles != "ask" && rewriteProfiles != "yes" && rewriteProfiles != "no" {
+		fmt.Fprintln(os.Stderr, "Invalid -rewrite-profiles value, expected ask, yes or no")
+		os.Exit(2)
+	}
+	if (signKeyPath == "") != (signCertPath == "") {
+		fmt.Fprintln(os.Stderr, "-sign-key and -sign-cert must be used together")
+		os.Exit(2)
+	}
+
+	switch subcommand {
+	case "":
+	case "preflight":
+		os.Exit(runPreflightCommand())
+	case "flush-logs":
+		os.Exit(runFlushLogsCommand())
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q (available: preflight, flush-logs, build-bundle)\n", subcommand)
+		os.Exit(2)
+	}
+
+	// Прерывание по сигналу отменяет контекст: текущая внешняя команда завершается,
+	// после чего этапы очистки возвращают систему в исходное состояние
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	setCommandContext(ctx)
+
+	if state, err := term.GetState(int(syscall.Stdin)); err == nil {
+		cleanup.Push("restore terminal", func() error {
+			return term.Restore(int(syscall.Stdin), state)
+		})
+	}
+
+	done := make(chan struct{})
+	go watchForSignal(ctx, done)
+
+	code := func() int {
+		defer func() {
+			if r := recover(); r != nil {
+				cleanup.Run()
+				panic(r)
+			}
+		}()
+		return run(ctx)
+	}()
+	close(done)
+	if ctx.Err() != nil {
+		code = 130
+	}
+	stop()
 
+	cleanup.Run()
+	os.Exit(code)
+}
+
+// run выполняет сеанс прошивки и возвращает код завершения
+func run(ctx context.Context) int {
 	// Проверка прав root
 	if os.Geteuid() != 0 {
 		criticalError("Please run this program with root privileges")
-		os.Exit(1)
+		return 1
 	}
 
 	var err error
 	cDir, err = os.Getwd()
 	if err != nil {
 		criticalError("Could not get current directory: " + err.Error())
-		os.Exit(1)
+		return 1
 	}
 
 	fmt.Println(colorBlue + "Starting MAC address flashing tool..." + colorReset)
 	fmt.Println(colorBlue + "----------------------------------------" + colorReset)
 
-	// Получение имени продукта
-	productName, err = getProductName()
+	// Отправляем логи, которые не удалось доставить в прошлых запусках
+	retrySpooledLogs()
+
+	// Получение данных DMI и имени продукта
+	dmiInfo, err = loadDMIInfo()
 	if err != nil {
 		fmt.Printf(colorYellow+"[WARNING] Could not get product name: %v. Using 'Unknown'.\n"+colorReset, err)
 		productName = "Unknown"
 	} else {
+		productName = dmiInfo.ProductName
+		if productName == "" {
+			productName = dmiInfo.BaseboardProduct
+		}
 		fmt.Printf("Product Name: %s\n", productName)
 	}
 
+	// Возвращаем систему в рабочее состояние после прерванного сеанса
+	interrupted, err := recoverInterruptedSystem()
+	if err != nil {
+		criticalError("Cannot start: " + err.Error())
+		return 1
+	}
+
 	// Проверка наличия файла пула
 	if _, err := os.Stat(poolFilePath); os.IsNotExist(err) {
 		criticalError(fmt.Sprintf("MAC address pool file %s does not exist", poolFilePath))
-		os.Exit(1)
+		return 1
 	}
 
 	// Получение MAC-адреса из пула
 	pool, password, err := loadAndDecryptPool(poolFilePath)
 	if err != nil {
 		criticalError("Failed to load MAC address pool: " + err.Error())
-		os.Exit(1)
+		return 1
+	}
+
+	if interrupted != nil {
+		if !samePoolFile(interrupted.PoolFile, poolFilePath) {
+			criticalError(fmt.Sprintf("The interrupted session claimed its addresses in %s. Run the flasher with -pool %s to finish it first.", interrupted.PoolFile, interrupted.PoolFile))
+			return 1
+		}
+		finishInterruptedSession(pool, password, interrupted, "an interrupted run")
+		// Поверх не возвращённых драйверов новый сеанс начинать нельзя: журнал сохранён для повтора
+		if pending := pendingSystemRestore(); pending != "" {
+			criticalError("The interrupted session could not be rolled back (" + pending + "). Restore it manually or reboot, then run the flasher again.")
+			return 1
+		}
+	}
+
+	// Проверяем, не получала ли эта плата адрес из пула ранее
+	provisioned := findProvisionedBoard(pool, dmiInfo)
+	if provisioned != nil {
+		mac = provisioned.Address
+		fmt.Printf(colorYellow+"Board already received MAC %s from this pool (matched by %s, state %s)\n"+colorReset, provisioned.Address, provisioned.MatchedBy, provisioned.State)
+		if len(provisioned.Interfaces) > 0 {
+			fmt.Printf("Address is present on interfaces: %s\n", strings.Join(provisioned.Interfaces, ", "))
+		} else {
+			fmt.Println(colorYellow + "Address is not present on any local interface. Check the NIC manually before reflashing." + colorReset)
+		}
+		// Незавершённую прошивку разбирают в менеджере пула: новый адрес этой плате не выдаём
+		if provisioned.State != stateUsed {
+			criticalError(fmt.Sprintf("MAC %s is %s in the pool: an earlier flash of this board did not finish. Resolve the address in the MAC pool manager before flashing this board again.", provisioned.Address, provisioned.State))
+			createOperationLog("Board has an unfinished MAC address claim", false)
+			return 1
+		}
+		successMessage("Board already provisioned – no new MAC address claimed")
+		createOperationLog("Board already provisioned", true)
+		return 0
 	}
 
-	mac, err = getAvailableMACFromPool(pool)
+	allocation, err := selectAllocation(pool, dmiInfo)
 	if err != nil {
 		criticalError("Failed to get available MAC address: " + err.Error())
-		os.Exit(1)
+		return 1
 	}
+	mac = allocation.Addresses[0]
 
+	if allocation.Rule != nil {
+		fmt.Printf("Matched allocation policy rule: %s\n", allocation.Rule.Name)
+	}
 	fmt.Printf("Selected MAC address: %s\n", mac)
+	if len(allocation.Addresses) > 1 {
+		fmt.Printf("Additional port addresses: %s\n", strings.Join(allocation.Addresses[1:], ", "))
+	}
 
 	// Проверяем, не установлен ли уже указанный MAC
 	targetMAC := strings.ToLower(mac)
 	macAlreadySet := false
 	var existingInterfaces []string
 
-	if ifaces, err := getInterfacesWithMAC(targetMAC); err == nil && len(ifaces) > 0 {
+	if ifaces := interfacesWithPermanentMAC(targetMAC); len(ifaces) > 0 {
 		macAlreadySet = true
 		existingInterfaces = ifaces
 		fmt.Printf(colorGreen+"MAC %s is already present on interfaces: %s\n"+colorReset, targetMAC, strings.Join(ifaces, ", "))
+	} else if ifaces, err := getInterfacesWithMAC(targetMAC); err == nil && len(ifaces) > 0 {
+		fmt.Printf(colorYellow+"MAC %s is set only as the runtime address on %s, flashing is required\n"+colorReset, targetMAC, strings.Join(ifaces, ", "))
 	} else {
 		fmt.Printf("MAC %s not found in system, flashing is required\n", targetMAC)
 	}
 
+	// Способ прошивки и проверки окружения выбираются до того, как адрес занят в пуле:
+	// проваленная проверка не должна оставлять следов в пуле
+	var backend FlashBackend
+	if !macAlreadySet {
+		backend, err = selectFlashBackend(backendName, allocation.Rule)
+		if err != nil {
+			criticalError("No suitable flashing backend: " + err.Error())
+			createOperationLog("MAC address update failed", false)
+			return 1
+		}
+
+		// Проверяем окружение до выгрузки драйверов, чтобы не прерваться на середине
+		stage := beginStage("preflight")
+		preflightResults := runPreflight(backend)
+		stage.detail(preflightSummary(preflightResults))
+		if !printPreflightTable(preflightResults) {
+			stage.finish(errors.New("pre-flight checks failed"))
+			criticalError("Pre-flight checks failed, no changes were made to the system or the pool")
+			createOperationLog("MAC address update failed", false)
+			return 1
+		}
+		stage.finish(nil)
+	}
+
+	// Журнал сеанса позволит следующему запуску довести до конца прерванную прошивку
+	startSessionJournal(allocation)
+	moduleState.OnChange = func() { updateSessionJournal(func(j *SessionJournal) {}) }
+	var flashErr error // причина неудачной прошивки для итогового обновления пула
+	cleanup.Push("finish pool update", func() error {
+		switch sessionStage() {
+		case stageWriting, stageWritten, stageVerified:
+			journalMu.Lock()
+			j := *sessionJournal
+			journalMu.Unlock()
+			reason := "an unexpected stop"
+			if ctx.Err() != nil {
+				reason = "an interrupt signal"
+			} else if flashErr != nil {
+				reason = "a failed flash: " + flashErr.Error()
+			}
+			finishInterruptedSession(pool, password, &j, reason)
+		case stageStarted, stagePrepared:
+			// Система не изменялась: адреса возвращаются в оборот
+			releaseAllocation(pool, password, allocation.Addresses, stateFree)
+			finishSessionJournal()
+		default:
+			finishSessionJournal()
+		}
+		return nil
+	})
+
+	// Занимаем адреса в пуле до изменения системы, чтобы их не выдали другой плате
+	if err := claimAllocation(pool, password, allocation); err != nil {
+		criticalError("Failed to claim MAC address in pool: " + err.Error())
+		return 1
+	}
+
+	// Запоминаем заводские адреса сетевых карт до выгрузки драйверов
+	nicsBeforeFlash = snapshotNICs()
+
 	// Переменная для записи выполненных действий
 	actionPerformed := ""
 	success := true
@@ -174,11 +452,12 @@ func main() {
 		actionPerformed = "No changes required"
 		successMessage("No reflash required – system already has the correct MAC address")
 
-		// Обновляем статус MAC-адреса в пуле
-		markMACAsUsed(pool, mac, &existingInterfaces)
+		// Обновляем статус MAC-адресов в пуле
+		markAllocationAsUsed(pool, allocation, &existingInterfaces)
 
 		// Сохраняем обновленный пул
 		updatePool(pool, password, poolFilePath)
+		finishSessionJournal()
 
 		// Создание лога перед завершением
 		createOperationLog(actionPerformed, success)
@@ -196,7 +475,7 @@ func main() {
 				fmt.Println("Exiting without reboot.")
 			}
 		}
-		return
+		return 0
 	}
 
 	// CASE 2: MAC требует обновления
@@ -204,14 +483,15 @@ func main() {
 	fmt.Println(colorYellow + "MAC address flash is required." + colorReset)
 
 	// Пытаемся обновить MAC через драйвер с повторными попытками
-	if err := writeMAcWithRetries(mac); err != nil {
+	if err := writeMAcWithRetries(ctx, backend, mac); err != nil {
+		flashErr = err
 		success = false
 		criticalError("MAC address could not be written after multiple attempts. It is recommended to power off the system and diagnose the hardware manually.")
 
 		// Создаём лог перед выходом
 		createOperationLog("MAC address update failed", false)
 
-		os.Exit(1)
+		return 1
 	}
 
 	// Обновляем статус MAC-адреса в пуле
@@ -221,10 +501,12 @@ func main() {
 		updatedInterfaces = ifaces
 	}
 
-	markMACAsUsed(pool, mac, &updatedInterfaces)
+	markAllocationAsUsed(pool, allocation, &updatedInterfaces)
 
 	// Сохраняем обновленный пул
-	updatePool(pool, password, poolFilePath)
+	if err := updatePool(pool, password, poolFilePath); err == nil {
+		finishSessionJournal()
+	}
 
 	// Создаём лог
 	createOperationLog(actionPerformed, success)
@@ -234,24 +516,27 @@ func main() {
 	}
 
 	// Предлагаем перезагрузить систему
-	if !noReboot {
+	if !noReboot && ctx.Err() == nil {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Reboot system now? (Y/n): ")
 		choice, _ := reader.ReadString('\n')
 		choice = strings.TrimSpace(choice)
 		if !strings.EqualFold(choice, "n") {
 			fmt.Println("Rebooting system...")
+			cleanup.Run()
 			_ = runCommandNoOutput("reboot")
 		} else {
 			fmt.Println("Exiting without reboot.")
 		}
 	}
+	return 0
 }
 
 // updatePool обновляет и сохраняет пул с обновленной подписью
 func updatePool(pool MACPool, password, poolFilePath string) error {
 	// Обновляем HMAC подпись
 	signPool(&pool, password)
+	poolHashAfter = poolStateHash(pool)
 
 	// Сохраняем обновленный пул
 	err := saveEncryptedPool(pool, password, poolFilePath)
@@ -259,6 +544,7 @@ func updatePool(pool MACPool, password, poolFilePath string) error {
 		fmt.Printf(colorYellow+"[WARNING] Failed to update MAC pool: %v\n"+colorReset, err)
 		return err
 	}
+	recordPoolFile(poolFilePath, true)
 
 	return nil
 }
@@ -308,28 +594,11 @@ func successMessage(message string) {
 	fmt.Println("")
 }
 
-// getProductName получает имя продукта из выхода dmidecode
-func getProductName() (string, error) {
-	output, err := runCommand("dmidecode", "-t", "system")
-	if err != nil {
-		return "", fmt.Errorf("dmidecode failed: %v", err)
-	}
-	for _, line := range strings.Split(output, "\n") {
-		if strings.Contains(line, "Product Name") {
-			parts := strings.SplitN(line, ":", 2)
-			if len(parts) == 2 {
-				return strings.TrimSpace(parts[1]), nil
-			}
-		}
-	}
-	return "", errors.New("could not determine Product Name")
-}
-
 // getAvailableMACFromPool получает доступный MAC-адрес из пула
 func getAvailableMACFromPool(pool MACPool) (string, error) {
 	// Поиск неиспользуемого MAC-адреса
 	for _, addr := range pool.Addresses {
-		if !addr.Used && !addr.Reserved {
+		if isAddressAvailable(addr) {
 			return addr.Address, nil
 		}
 	}
@@ -337,13 +606,28 @@ func getAvailableMACFromPool(pool MACPool) (string, error) {
 	return "", errors.New("no available MAC addresses in pool")
 }
 
+// isReserved проверяет, что адрес зарезервирован и срок резервирования не истёк
+func isReserved(addr MACAddress) bool {
+	if !addr.Reserved {
+		return false
+	}
+	return addr.Reservation == nil || addr.Reservation.ExpiresAt.IsZero() || time.Now().Before(addr.Reservation.ExpiresAt)
+}
+
 // markMACAsUsed помечает MAC-адрес как использованный в пуле
 func markMACAsUsed(pool MACPool, macAddress string, interfaces *[]string) {
 	// Поиск MAC-адреса в пуле
 	for i, addr := range pool.Addresses {
 		if strings.EqualFold(addr.Address, macAddress) {
+			// Адрес проходит через pending, даже если его не успели занять заранее
+			if addressState(pool.Addresses[i]) == stateFree {
+				_ = setAddressState(&pool.Addresses[i], statePending)
+			}
+			if err := setAddressState(&pool.Addresses[i], stateUsed); err != nil {
+				fmt.Printf(colorYellow+"[WARNING] Could not mark MAC as used: %v\n"+colorReset, err)
+				return
+			}
 			hostname, _ := os.Hostname()
-			pool.Addresses[i].Used = true
 			pool.Addresses[i].UsedAt = time.Now()
 
 			// Добавляем имя хоста и интерфейсы в комментарий
@@ -352,11 +636,29 @@ func markMACAsUsed(pool MACPool, macAddress string, interfaces *[]string) {
 				interfaceStr = " on " + strings.Join(*interfaces, ",")
 			}
 			pool.Addresses[i].UsedBy = fmt.Sprintf("%s%s", hostname, interfaceStr)
+
+			// Привязываем адрес к плате и сетевой карте, чтобы распознать её при повторном запуске
+			var ifaceList []string
+			if interfaces != nil {
+				ifaceList = *interfaces
+			}
+			pool.Addresses[i].Binding = buildHardwareBinding(ifaceList)
 			return
 		}
 	}
 }
 
+// markAllocationAsUsed помечает все выделенные плате адреса как использованные
+func markAllocationAsUsed(pool MACPool, allocation Allocation, interfaces *[]string) {
+	for i, address := range allocation.Addresses {
+		if i == 0 {
+			markMACAsUsed(pool, address, interfaces)
+		} else {
+			markMACAsUsed(pool, address, nil)
+		}
+	}
+}
+
 // loadAndDecryptPool загружает и дешифрует пул MAC-адресов
 func loadAndDecryptPool(poolFilePath string) (MACPool, string, error) {
 	var pool MACPool
@@ -396,6 +698,11 @@ func loadAndDecryptPool(poolFilePath string) (MACPool, string, error) {
 		return pool, "", errors.New("integrity check failed: the pool file may have been tampered with")
 	}
 
+	// Пока пул не изменён, состояния до и после операции совпадают
+	poolHashBefore = poolStateHash(pool)
+	poolHashAfter = poolHashBefore
+	recordPoolFile(poolFilePath, false)
+
 	return pool, string(password), nil
 }
 
@@ -590,16 +897,12 @@ func decrypt(encryptedData []byte, passphrase string) ([]byte, error) {
 func createOperationLog(action string, success bool) {
 	fmt.Println(colorBlue + "Creating operation log..." + colorReset)
 
-	// Get full dmidecode output for system info
-	dmidecodeOutput, err := runCommand("dmidecode")
+	// Get full SMBIOS data for system info
+	systemInfo, err := readSMBIOS()
 	if err != nil {
-		fmt.Printf(colorYellow+"[WARNING] Could not get dmidecode output for log: %v"+colorReset, err)
-		dmidecodeOutput = "Error getting dmidecode output"
+		fmt.Printf(colorYellow+"[WARNING] Could not read SMBIOS data for log: %v\n"+colorReset, err)
 	}
 
-	// Parse dmidecode output to get system info
-	systemInfo := parseDmidecodeToMap(dmidecodeOutput)
-
 	// Collect host info
 	hostInfo := map[string]string{
 		"hostname": "unknown",
@@ -627,6 +930,7 @@ func createOperationLog(action string, success bool) {
 	// Create log data structure
 	timestamp := time.Now().Format("2006-01-02T15:04:05")
 	logData := LogData{
+		SchemaVersion:   logSchemaVersion,
 		Timestamp:       timestamp,
 		ProductName:     productName,
 		MacAddress:      mac,
@@ -634,6 +938,17 @@ func createOperationLog(action string, success bool) {
 		Success:         success,
 		SystemInfo:      systemInfo,
 		HostInfo:        hostInfo,
+		PoolHashBefore:  poolHashBefore,
+		PoolHashAfter:   poolHashAfter,
+		Interfaces:      interfaceRecords(),
+	}
+	fillOperationDetails(&logData)
+	// Следующий лог этого запуска продолжает цепочку от текущего состояния пула
+	poolHashBefore = poolHashAfter
+
+	// Sign the log with the station key
+	if err := signLog(&logData); err != nil {
+		fmt.Printf(colorYellow+"[WARNING] Could not sign operation log: %v. Log will be unsigned.\n"+colorReset, err)
 	}
 
 	// Convert to JSON
@@ -647,137 +962,22 @@ func createOperationLog(action string, success bool) {
 	timeFormat := time.Now().Format("060102_150405") // YYMMDDHHMMSS
 	filename := fmt.Sprintf("%s_MAC-%s_%s.json", productName, strings.ReplaceAll(mac, ":", ""), timeFormat)
 
-	// Save log to file if flag is set
-	if logToFile {
-		logDir := filepath.Join(cDir, "logs")
-		// Create log directory if it doesn't exist
-		if _, err := os.Stat(logDir); os.IsNotExist(err) {
-			if err := os.Mkdir(logDir, 0755); err != nil {
-				fmt.Printf(colorYellow+"[WARNING] Could not create log directory: %v. "+colorReset, err)
-				logDir = cDir
-			}
-		}
-
-		logPath := filepath.Join(logDir, filename)
-		if err := os.WriteFile(logPath, jsonData, 0644); err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Could not write log file: %v.\n"+colorReset, err)
-		} else {
-			fmt.Printf(colorGreen+"[INFO] Log saved to: %s\n"+colorReset, logPath)
-		}
-	}
-
-	// Send log to server if specified
-	if logServer != "" {
-		// Create temporary file
-		tempFile, err := os.CreateTemp("", "mac-log-*.json")
-		if err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Could not create temporary file for log: %v"+colorReset, err)
-			return
-		}
-
-		// Write JSON to file
-		if _, err := tempFile.Write(jsonData); err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Could not write to temporary file: %v"+colorReset, err)
-			tempFile.Close()
-			os.Remove(tempFile.Name())
-			return
-		}
-		tempFile.Close()
-
-		// Parse server string to host and path
-		var host, remotePath string
-		parts := strings.SplitN(logServer, ":", 2)
-
-		host = parts[0]
-		if len(parts) > 1 {
-			remotePath = parts[1]
-		}
-
-		// Build correct path for SCP
-		var destination string
-		if remotePath != "" {
-			destination = fmt.Sprintf("%s:%s/%s", host, remotePath, filename)
-		} else {
-			destination = fmt.Sprintf("%s:%s", host, filename)
-		}
-
-		// Send file to server using SCP
-		cmd := exec.Command("scp",
-			"-o", "StrictHostKeyChecking=no",
-			"-o", "UserKnownHostsFile=/dev/null",
-			tempFile.Name(), destination)
-		output, err := cmd.CombinedOutput()
-
-		// Clean up temporary file
-		os.Remove(tempFile.Name())
-
-		if err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Could not send log to server: %v\nOutput: %s\n"+colorReset, err, output)
-		} else {
-			fmt.Printf(colorGreen+"[INFO] Log sent to server: %s\n"+colorReset, destination)
-		}
-	}
-}
-
-// parseDmidecodeToMap преобразует вывод dmidecode в карту для JSON
-func parseDmidecodeToMap(output string) map[string]interface{} {
-	systemInfo := make(map[string]interface{})
-
-	// Простой парсер, который группирует информацию по секциям
-	var currentSection string
-	sectionData := make(map[string]interface{})
-
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		// Начало новой секции
-		if strings.HasPrefix(line, "Handle") {
-			// Сохраняем предыдущую секцию, если она существует
-			if currentSection != "" && len(sectionData) > 0 {
-				systemInfo[currentSection] = sectionData
-				sectionData = make(map[string]interface{})
-			}
-			currentSection = line
-			continue
-		}
-
-		// Если строка содержит двоеточие, это пара ключ-значение
-		if colonIndex := strings.Index(line, ":"); colonIndex != -1 {
-			key := strings.TrimSpace(line[:colonIndex])
-			value := strings.TrimSpace(line[colonIndex+1:])
-			sectionData[key] = value
-		}
-	}
-
-	// Сохраняем последнюю секцию
-	if currentSection != "" && len(sectionData) > 0 {
-		systemInfo[currentSection] = sectionData
-	}
-
-	return systemInfo
+	// Save log locally and upload it, queueing failed uploads
+	deliverLog(filename, jsonData)
 }
 
 // runCommand запускает команду и возвращает её вывод
 func runCommand(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
+	cmd := exec.CommandContext(commandContext(), name, args...)
 	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	err := cmd.Run()
+	err := runRecorded(cmd, &out)
 	return strings.TrimSpace(out.String()), err
 }
 
 // runCommandNoOutput запускает команду без вывода результата
 func runCommandNoOutput(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	var dummy bytes.Buffer
-	cmd.Stdout = &dummy
-	cmd.Stderr = &dummy
-	return cmd.Run()
+	cmd := exec.CommandContext(commandContext(), name, args...)
+	return runRecorded(cmd, io.Discard)
 }
 
 // getInterfacesWithMAC получает список интерфейсов с указанным MAC-адресом
@@ -806,330 +1006,130 @@ func getInterfacesWithMAC(targetMAC string) ([]string, error) {
 	return interfaces, nil
 }
 
-// writeMAcWithRetries пытается записать MAC-адрес с повторными попытками и пересборкой драйвера при необходимости
-func writeMAcWithRetries(macInput string) error {
+// writeMAcWithRetries пытается записать MAC-адрес выбранным способом прошивки с повторными попытками
+func writeMAcWithRetries(ctx context.Context, backend FlashBackend, macInput string) error {
 	targetMAC := strings.ToLower(macInput)
-	// Если указанный MAC уже присутствует, пропускаем прошивку
-	if ifaces, err := getInterfacesWithMAC(targetMAC); err == nil && len(ifaces) > 0 {
+	// Если указанный MAC уже записан в оборудование, пропускаем прошивку
+	if ifaces := interfacesWithPermanentMAC(targetMAC); len(ifaces) > 0 {
 		fmt.Printf(colorGreen+"[INFO] MAC address %s already present on interface(s): %s. Skipping flashing.\n"+colorReset,
 			targetMAC, strings.Join(ifaces, ", "))
 		return nil
 	}
 
-	out, err := runCommand("uname", "-m")
+	// Сохраняем сетевую конфигурацию до выгрузки штатного драйвера
+	networkRestored := false
+	stage := beginStage("network snapshot")
+	snapshot, err := takeNetworkSnapshot()
+	stage.finish(err)
 	if err != nil {
-		return fmt.Errorf("Failed to get machine architecture: %v", err)
+		fmt.Printf(colorYellow+"[WARNING] Could not save network configuration: %v\n"+colorReset, err)
+	} else {
+		fmt.Printf("Saved network configuration: %d interfaces, %d active\n", len(snapshot.Links), len(snapshot.activeLinks()))
+		updateSessionJournal(func(j *SessionJournal) { j.Network = snapshot })
+		cleanup.Push("restore network configuration", func() error {
+			if !networkRestored {
+				printNetworkRestoreReport(restoreNetworkUninterruptible(snapshot, nil))
+			}
+			return nil
+		})
 	}
-	arch := strings.TrimSpace(out)
-	rtnic := filepath.Join(cDir, "rtnicpg", "rtnicpg-"+arch)
 
-	oldIface, oldIP, err := getActiveInterfaceAndIP()
+	fmt.Printf("Using flashing backend: %s\n", backend.Name())
+	recordBackend(backend.Name())
+	updateSessionJournal(func(j *SessionJournal) { j.Backend = backend.Name() })
+	cleanup.Push("restore network drivers", backend.Restore)
+	stage = beginStage("prepare")
+	err = backend.Prepare()
+	stage.finish(err)
 	if err != nil {
-		fmt.Printf(colorYellow+"[WARNING] %v"+colorReset, err)
-	} else {
-		fmt.Printf("Old IP address for interface %s: %s\n", oldIface, oldIP)
+		criticalError("Failed to prepare flashing backend: " + err.Error())
+		stage = beginStage("driver restore")
+		stage.finish(runUninterruptible(backend.Restore))
+		return err
 	}
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	setSessionStage(stagePrepared)
 
-	// Первая попытка загрузить драйвер как есть
-	driverErr := loadDriver()
-
-	// Если загрузка драйвера не удалась, пытаемся пересобрать и загрузить снова
-	if driverErr != nil {
-		fmt.Printf(colorYellow+"[WARNING] Initial driver load failed: %v\nAttempting to recompile driver..."+colorReset+"\n", driverErr)
-
-		// Пытаемся пересобрать драйвер
-		rtnicpgPath := filepath.Join(cDir, "rtnicpg")
-		if info, err := os.Stat(rtnicpgPath); err == nil && info.IsDir() {
-			if err := runCommandNoOutput("make", "-C", rtnicpgPath, "clean", "all"); err != nil {
-				criticalError("Failed to recompile driver: " + err.Error())
-				return err
-			}
-			fmt.Println(colorGreen + "[INFO] Driver recompilation successful." + colorReset)
+	ifaces, err := flashAndVerify(ctx, backend, targetMAC)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(colorGreen+"[INFO] Permanent address %s verified on interfaces: %v\n"+colorReset, targetMAC, ifaces)
+	setSessionStage(stageVerified)
 
-			// Пытаемся загрузить драйвер снова после пересборки
-			if driverErr = loadDriver(); driverErr != nil {
-				criticalError("Failed to load driver even after recompilation: " + driverErr.Error())
-				return driverErr
-			}
+	// Восстанавливаем сетевую конфигурацию на интерфейсах, которые теперь несут новый адрес
+	if snapshot != nil {
+		stage = beginStage("network restore")
+		diffs := restoreNetworkUninterruptible(snapshot, ifaces)
+		if len(diffs) > 0 {
+			stage.finish(fmt.Errorf("configuration differs from snapshot: %s", strings.Join(diffs, "; ")))
 		} else {
-			criticalError("rtnicpg directory does not exist, cannot recompile driver")
-			return fmt.Errorf("rtnicpg directory does not exist, cannot recompile driver")
+			stage.finish(nil)
 		}
+		printNetworkRestoreReport(diffs)
+		networkRestored = true
 	}
 
-	if err := os.Chmod(rtnic, 0755); err != nil {
-		return fmt.Errorf("Failed to chmod %s: %v", rtnic, err)
-	}
+	return nil
+}
 
-	// Модифицируем MAC-адрес для команды (удаляем двоеточия)
-	modmac := strings.ReplaceAll(macInput, ":", "")
-	fmt.Println("Modified MAC for flashing:", modmac)
+// writeRetryDelay - пауза между попытками записи, аппаратным операциям нужно время
+var writeRetryDelay = 1 * time.Second
 
+// flashAndVerify записывает адрес подготовленным backend с повторными попытками, возвращает
+// штатный драйвер и перечитывает аппаратный адрес. Возвращает интерфейсы, получившие адрес
+func flashAndVerify(ctx context.Context, backend FlashBackend, targetMAC string) ([]string, error) {
 	// Пытаемся записать MAC с повторными попытками
 	var macWriteSuccess bool = false
 	var macWriteErr error
 
+	setSessionStage(stageWriting)
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		macWriteErr = runCommandNoOutput(rtnic, "/efuse", "/nicmac", "/nodeid", modmac)
+		if ctx.Err() != nil {
+			macWriteErr = errInterrupted
+			break
+		}
+		recordWriteAttempt(attempt)
+		stage := beginStage(fmt.Sprintf("write attempt %d", attempt))
+		macWriteErr = backend.Write(targetMAC)
+		stage.finish(macWriteErr)
 
 		if macWriteErr == nil {
 			fmt.Println(colorGreen + "[INFO] MAC address was successfully written, verifying..." + colorReset)
 			macWriteSuccess = true
+			setSessionStage(stageWritten)
 			break
-		} else {
-			fmt.Printf(colorYellow+"[WARNING] Attempt %d: Failed to write MAC: %v\n"+colorReset, attempt, macWriteErr)
-
-			if attempt == 1 {
-				// При первой неудаче пытаемся пересобрать драйвер
-				fmt.Println(colorYellow + "[WARNING] MAC write failed. Attempting to recompile driver and try again..." + colorReset)
-				rtnicpgPath := filepath.Join(cDir, "rtnicpg")
-				if info, err := os.Stat(rtnicpgPath); err == nil && info.IsDir() {
-					if err := runCommandNoOutput("make", "-C", rtnicpgPath, "clean", "all"); err != nil {
-						fmt.Printf(colorYellow+"[WARNING] Failed to recompile driver: %v\n"+colorReset, err)
-					} else {
-						fmt.Println(colorGreen + "[INFO] Driver recompilation successful." + colorReset)
-						if err := loadDriver(); err != nil {
-							fmt.Printf(colorYellow+"[WARNING] Failed to reload driver after recompilation: %v\n"+colorReset, err)
-						}
-					}
-				}
-			}
-
-			time.Sleep(1 * time.Second) // Более длительная задержка для аппаратных операций
-		}
-	}
-
-	if !macWriteSuccess {
-		criticalError("Failed to write MAC address after " + fmt.Sprintf("%d", maxRetries) + " attempts: " + macWriteErr.Error())
-		return fmt.Errorf("Failed to write MAC address after %d attempts: %v", maxRetries, macWriteErr)
-	}
-
-	_ = runCommandNoOutput("rmmod", "pgdrv")
-	if rtDrv != "" {
-		if err := runCommandNoOutput("modprobe", rtDrv); err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Failed to modprobe %s: %v\n"+colorReset, rtDrv, err)
-		}
-	}
-
-	// Проверяем, появились ли интерфейсы с установленным MAC
-	ifaces, err := getInterfacesWithMAC(targetMAC)
-	if err != nil {
-		return fmt.Errorf("Failed to find interface with target MAC: %v", err)
-	}
-	fmt.Printf("Found interfaces with MAC %s: %v\n", targetMAC, ifaces)
-
-	// Восстанавливаем сетевые настройки
-	var newIface string
-	if oldIface != "" {
-		for _, iface := range ifaces {
-			if iface == oldIface {
-				newIface = iface
-				break
-			}
-		}
-	}
-	if newIface == "" {
-		newIface = ifaces[0]
-		if len(ifaces) > 1 {
-			fmt.Printf(colorYellow+"[WARNING] Multiple interfaces with matching MAC found. Using %s\n"+colorReset, newIface)
-		}
-	}
-
-	if newIface != "" && oldIP != "" {
-		maxRetries := 3
-		var assignErr error
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			fmt.Printf("[INFO] Attempt %d: Restarting interface %s with IP %s\n", attempt, newIface, oldIP)
-
-			// Выключаем интерфейс
-			_ = runCommandNoOutput("ip", "link", "set", "dev", newIface, "down")
-
-			// Удаляем все IP-адреса с интерфейса
-			_ = runCommandNoOutput("ip", "addr", "flush", "dev", newIface)
-
-			// Устанавливаем MAC-адрес
-			_ = runCommandNoOutput("ip", "link", "set", "dev", newIface, "address", targetMAC)
-
-			// Включаем интерфейс
-			_ = runCommandNoOutput("ip", "link", "set", "dev", newIface, "up")
-
-			// Назначаем только оригинальный IP
-			assignErr = runCommandNoOutput("ip", "addr", "add", oldIP, "dev", newIface)
-
-			if assignErr == nil {
-				fmt.Printf(colorGreen+"[INFO] Interface %s restarted with IP %s\n"+colorReset, newIface, oldIP)
-				break
-			} else {
-				fmt.Printf(colorYellow+"[WARNING] Attempt %d: Failed to assign IP %s to interface %s: %v\n"+colorReset, attempt, oldIP, newIface, assignErr)
-
-				// Проверяем, не был ли уже назначен этот IP
-				ipCheckOutput, _ := runCommand("ip", "addr", "show", "dev", newIface)
-				if strings.Contains(ipCheckOutput, oldIP) {
-					fmt.Printf(colorGreen+"[INFO] IP %s is already assigned to %s, continuing...\n"+colorReset, oldIP, newIface)
-					assignErr = nil
-					break
-				}
-
-				time.Sleep(500 * time.Millisecond) // Небольшая задержка между попытками
-			}
-		}
-	} else {
-		fmt.Println(colorYellow + "[WARNING] Could not find interface for " + targetMAC + " or no previous IP was stored." + colorReset)
-	}
-
-	return nil
-}
-
-// getActiveInterfaceAndIP получает активный интерфейс и его IP-адрес
-func getActiveInterfaceAndIP() (string, string, error) {
-	output, err := runCommand("ip", "a")
-	if err != nil {
-		return "", "", fmt.Errorf("Failed to get 'ip a' output: %v", err)
-	}
-
-	lines := strings.Split(output, "\n")
-	var currentIface, currentIP string
-	headerRe := regexp.MustCompile(`^\d+:\s+([^:]+):\s+<([^>]+)>`)
-	for i, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if matches := headerRe.FindStringSubmatch(line); len(matches) == 3 {
-			ifaceName := matches[1]
-			flags := matches[2]
-			if ifaceName == "lo" {
-				continue
-			}
-			if !strings.Contains(flags, "UP") {
-				continue
-			}
-			currentIface = ifaceName
-			for j := i + 1; j < len(lines); j++ {
-				nextLine := strings.TrimSpace(lines[j])
-				if nextLine == "" {
-					continue
-				}
-				if headerRe.MatchString(nextLine) {
-					break
-				}
-				if strings.HasPrefix(nextLine, "inet ") {
-					fields := strings.Fields(nextLine)
-					if len(fields) >= 2 {
-						currentIP = fields[1]
-						break
-					}
-				}
-			}
-			if currentIP != "" {
-				break
-			}
 		}
-	}
 
-	if currentIface == "" {
-		return "", "", errors.New("no active interface found")
-	}
-	if currentIP == "" {
-		return currentIface, "", errors.New("active interface found but no IPv4 address detected")
-	}
-	return currentIface, currentIP, nil
-}
-
-// loadDriver загружает необходимый драйвер
-func loadDriver() error {
-	moduleDefault := "pgdrv"
-	modulesToRemove := []string{"r8169", "r8168", "r8125", "r8101"}
-
-	rtnicpgPath := filepath.Join(cDir, "rtnicpg")
-	if info, err := os.Stat(rtnicpgPath); err != nil || !info.IsDir() {
-		return fmt.Errorf("Directory %s does not exist", rtnicpgPath)
-	}
-
-	for _, mod := range modulesToRemove {
-		if isModuleLoaded(mod) {
-			fmt.Printf("Removing module: %s\n", mod)
-			if err := runCommandNoOutput("rmmod", mod); err != nil {
-				fmt.Printf("[WARNING] Could not remove module %s: %v\n", mod, err)
-			} else {
-				fmt.Printf("[INFO] Module %s successfully removed.\n", mod)
-				rtDrv = mod
-			}
-		}
+		fmt.Printf(colorYellow+"[WARNING] Attempt %d: Failed to write MAC: %v\n"+colorReset, attempt, macWriteErr)
+		time.Sleep(writeRetryDelay)
 	}
 
-	var targetModule string
-	// Получаем версию ядра для включения в имя файла драйвера
-	kernelVersion, err := runCommand("uname", "-r")
+	// Возвращаем штатный драйвер независимо от результата записи
+	stage := beginStage("driver restore")
+	err := runUninterruptible(backend.Restore)
+	stage.finish(err)
 	if err != nil {
-		kernelVersion = "unknown"
-	} else {
-		kernelVersion = strings.TrimSpace(kernelVersion)
-	}
-	if rtDrv != "" {
-		targetModule = rtDrv + "_mod_" + kernelVersion + ".ko"
-	} else {
-		targetModule = moduleDefault + ".ko"
-	}
-	targetModulePath := filepath.Join(rtnicpgPath, targetModule)
-
-	// Проверка, существует ли драйвер и загружен ли он
-	if _, err := os.Stat(targetModulePath); err == nil {
-		fmt.Printf("[INFO] Found existing driver file %s. Loading it...\n", targetModulePath)
-		modName := strings.TrimSuffix(targetModule, ".ko")
-		if isModuleLoaded(modName) {
-			fmt.Printf("[INFO] Module %s is already loaded.\n", modName)
-			return nil
-		}
-		if err := runCommandNoOutput("insmod", targetModulePath); err != nil {
-			return fmt.Errorf("Failed to load module %s: %v", targetModulePath, err)
-		}
-		fmt.Printf("[INFO] Module %s loaded successfully.\n", targetModule)
-		return nil
-	}
-
-	// Если драйвер не существует, компилируем его
-	fmt.Printf("[INFO] Compiling module %s.\n", moduleDefault)
-	if err := runCommandNoOutput("make", "-C", rtnicpgPath, "clean", "all"); err != nil {
-		return fmt.Errorf("Compilation failed: %v", err)
+		fmt.Printf(colorYellow+"[WARNING] Failed to restore drivers: %v\n"+colorReset, err)
 	}
-	fmt.Println("[INFO] Compilation completed successfully.")
 
-	builtModule := filepath.Join(rtnicpgPath, moduleDefault+".ko")
-	if _, err := os.Stat(builtModule); errors.Is(err, fs.ErrNotExist) {
-		return fmt.Errorf("Compiled module %s not found", builtModule)
-	}
-
-	// Переименовываем модуль при необходимости
-	if rtDrv != "" {
-		err := os.Rename(builtModule, targetModulePath)
-		if err != nil {
-			return fmt.Errorf("Failed to rename %s to %s: %v", builtModule, targetModulePath, err)
-		}
-	} else {
-		targetModulePath = builtModule
+	if !macWriteSuccess {
+		criticalError("Failed to write MAC address after " + fmt.Sprintf("%d", maxRetries) + " attempts: " + macWriteErr.Error())
+		return nil, fmt.Errorf("Failed to write MAC address after %d attempts: %v", maxRetries, macWriteErr)
 	}
 
-	// Загружаем новый скомпилированный модуль
-	if err := runCommandNoOutput("insmod", targetModulePath); err != nil {
-		return fmt.Errorf("Failed to load module %s: %v", targetModulePath, err)
+	// Перечитываем аппаратный адрес, чтобы убедиться, что MAC записан в efuse
+	stage = beginStage("verify")
+	ifaces, err := backend.Verify(targetMAC)
+	if err == nil {
+		stage.detail("permanent address found on " + strings.Join(ifaces, ", "))
 	}
-	fmt.Printf("[INFO] Module %s loaded successfully.\n", targetModulePath)
-	return nil
-}
-
-// isModuleLoaded проверяет, загружен ли модуль ядра
-func isModuleLoaded(mod string) bool {
-	out, err := runCommand("lsmod")
+	stage.finish(err)
 	if err != nil {
-		return false
-	}
-	lines := strings.Split(out, "\n")
-	for _, line := range lines {
-		fields := strings.Fields(line)
-		if len(fields) > 0 && fields[0] == mod {
-			return true
-		}
+		criticalError("Flash verification failed: " + err.Error())
+		return nil, fmt.Errorf("Flash verification failed: %v", err)
 	}
-	return false
+	return ifaces, nil
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	procModules = "/proc/modules" // список загруженных модулей ядра
+	sysModule   = "/sys/module"   // параметры и состояние модулей
+)
+
+// RemovedModule - выгруженный флешером модуль ядра и его параметры на момент выгрузки
+type RemovedModule struct {
+	Name   string
+	Params map[string]string
+}
+
+// ModuleManager запоминает все изменения набора модулей ядра и откатывает их
+// при любом завершении программы, в том числе по сигналу или панике
+type ModuleManager struct {
+	mu       sync.Mutex
+	removed  []RemovedModule // выгруженные штатные модули в порядке выгрузки
+	inserted []string        // загруженные служебные модули в порядке загрузки
+	OnChange func()          // вызывается после выгрузки штатного модуля
+}
+
+// moduleState - состояние модулей ядра текущего запуска
+var moduleState = &ModuleManager{}
+
+// Remove выгружает модуль, предварительно сохранив его параметры
+func (m *ModuleManager) Remove(name string) error {
+	m.mu.Lock()
+	params := moduleParams(name)
+	if err := runCommandNoOutput("rmmod", name); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.removed = append(m.removed, RemovedModule{Name: name, Params: params})
+	m.mu.Unlock()
+
+	if m.OnChange != nil {
+		m.OnChange()
+	}
+	return nil
+}
+
+// Insert загружает служебный модуль из файла и запоминает его для последующей выгрузки
+func (m *ModuleManager) Insert(path, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if output, err := runCommand("insmod", path); err != nil {
+		if isSignatureRejection(output) {
+			return fmt.Errorf("%w: %s", errModuleSignature, output)
+		}
+		if output != "" {
+			return fmt.Errorf("%v: %s", err, output)
+		}
+		return err
+	}
+	m.inserted = append(m.inserted, name)
+	return nil
+}
+
+// Unload выгружает ранее загруженный служебный модуль
+func (m *ModuleManager) Unload(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := runCommandNoOutput("rmmod", name); err != nil {
+		return err
+	}
+	for i, mod := range m.inserted {
+		if mod == name {
+			m.inserted = append(m.inserted[:i], m.inserted[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// RemovedModules возвращает список выгруженных модулей
+func (m *ModuleManager) RemovedModules() []RemovedModule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RemovedModule(nil), m.removed...)
+}
+
+// Restore выгружает служебные модули и возвращает все выгруженные штатные модули
+// с их параметрами. Модули, которые вернуть не удалось, остаются в списках: их восстановит
+// повторный вызов или следующий запуск по журналу сеанса
+func (m *ModuleManager) Restore() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []string
+
+	var inserted []string
+	for i := len(m.inserted) - 1; i >= 0; i-- {
+		name := m.inserted[i]
+		if isModuleLoaded(name) {
+			if err := runCommandNoOutput("rmmod", name); err != nil {
+				errs = append(errs, fmt.Sprintf("rmmod %s: %v", name, err))
+				inserted = append([]string{name}, inserted...)
+				continue
+			}
+		}
+		fmt.Printf("[INFO] Module %s unloaded.\n", name)
+	}
+	m.inserted = inserted
+
+	var removed []RemovedModule
+	for i := len(m.removed) - 1; i >= 0; i-- {
+		mod := m.removed[i]
+		if isModuleLoaded(mod.Name) {
+			continue
+		}
+		if err := loadModuleWithParams(mod); err != nil {
+			errs = append(errs, fmt.Sprintf("modprobe %s: %v", mod.Name, err))
+			removed = append([]RemovedModule{mod}, removed...)
+			continue
+		}
+		fmt.Printf("[INFO] Module %s restored.\n", mod.Name)
+	}
+	m.removed = removed
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to restore kernel modules: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Adopt принимает изменения модулей из журнала прерванного сеанса, чтобы вернуть их через Restore
+func (m *ModuleManager) Adopt(removed []RemovedModule, inserted ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removed = append(m.removed, removed...)
+	m.inserted = append(m.inserted, inserted...)
+}
+
+// Pending возвращает модули, которые ещё не возвращены в исходное состояние
+func (m *ModuleManager) Pending() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	names = append(names, m.inserted...)
+	for _, mod := range m.removed {
+		names = append(names, mod.Name)
+	}
+	return names
+}
+
+// loadModuleWithParams загружает модуль с сохранёнными параметрами. Если ядро
+// отклоняет параметры, модуль загружается с параметрами по умолчанию
+func loadModuleWithParams(mod RemovedModule) error {
+	var keys []string
+	for k := range mod.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := []string{mod.Name}
+	for _, k := range keys {
+		args = append(args, k+"="+mod.Params[k])
+	}
+
+	err := runCommandNoOutput("modprobe", args...)
+	if err == nil || len(keys) == 0 {
+		return err
+	}
+	fmt.Printf(colorYellow+"[WARNING] modprobe %s with saved parameters failed: %v. Retrying with defaults.\n"+colorReset, mod.Name, err)
+	return runCommandNoOutput("modprobe", mod.Name)
+}
+
+// loadedModules читает список загруженных модулей из /proc/modules
+func loadedModules() (map[string]bool, error) {
+	f, err := os.Open(procModules)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			result[fields[0]] = true
+		}
+	}
+	return result, scanner.Err()
+}
+
+// isModuleLoaded проверяет, загружен ли модуль ядра
+func isModuleLoaded(mod string) bool {
+	mod = strings.ReplaceAll(mod, "-", "_")
+	if modules, err := loadedModules(); err == nil {
+		return modules[mod]
+	}
+	// Встроенные в ядро модули отсутствуют в /proc/modules, но имеют initstate в /sys/module
+	return readSysfsValue(filepath.Join(sysModule, mod, "initstate")) == "live"
+}
+
+// moduleParams читает текущие значения параметров модуля из /sys/module/<mod>/parameters
+func moduleParams(mod string) map[string]string {
+	params := make(map[string]string)
+	dir := filepath.Join(sysModule, mod, "parameters")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return params
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue // параметр недоступен для чтения
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "" || value == "(null)" || strings.ContainsAny(value, " \t\n") {
+			continue
+		}
+		params[entry.Name()] = value
+	}
+	return params
+}
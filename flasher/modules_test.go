@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// cancelledCommands подменяет контекст внешних команд отменённым, как после SIGINT
+func cancelledCommands(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	prev := commandContext()
+	setCommandContext(ctx)
+	t.Cleanup(func() { setCommandContext(prev) })
+	return ctx
+}
+
+func TestModuleRestoreKeepsModulesAfterCancel(t *testing.T) {
+	cancelledCommands(t)
+
+	// Модулей с такими именами нет: отменённый контекст не даёт запустить modprobe,
+	// а незагруженный служебный модуль считается выгруженным
+	removed := []RemovedModule{
+		{Name: "soa_test_stock_a"},
+		{Name: "soa_test_stock_b", Params: map[string]string{"debug": "1"}},
+	}
+	m := &ModuleManager{
+		removed:  append([]RemovedModule(nil), removed...),
+		inserted: []string{"soa_test_service"},
+	}
+
+	if err := m.Restore(); err == nil {
+		t.Fatal("Restore succeeded with a cancelled command context")
+	}
+	if got := m.RemovedModules(); !reflect.DeepEqual(got, removed) {
+		t.Errorf("removed modules after failed restore = %+v, want %+v", got, removed)
+	}
+	if got := m.Pending(); !reflect.DeepEqual(got, []string{"soa_test_stock_a", "soa_test_stock_b"}) {
+		t.Errorf("pending = %v", got)
+	}
+
+	// Повторный вызов снова пытается вернуть те же модули
+	if err := m.Restore(); err == nil || len(m.RemovedModules()) != 2 {
+		t.Errorf("second Restore: err=%v, removed=%+v", err, m.RemovedModules())
+	}
+}
+
+func TestRunUninterruptible(t *testing.T) {
+	ctx := cancelledCommands(t)
+
+	err := runUninterruptible(func() error {
+		return commandContext().Err()
+	})
+	if err != nil {
+		t.Errorf("command context inside runUninterruptible: %v", err)
+	}
+	if commandContext() != ctx {
+		t.Error("the interrupted context was not put back")
+	}
+
+	// Контекст, заданный очисткой во время восстановления, не перезаписывается
+	runUninterruptible(func() error {
+		setCommandContext(context.Background())
+		return nil
+	})
+	if commandContext() != context.Background() {
+		t.Error("runUninterruptible replaced the context set by cleanup")
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Сетевые службы, которым передаётся перезапуск интерфейсов
+const (
+	netManagerNone      = ""
+	netManagerNM        = "NetworkManager"
+	netManagerNetworkd  = "systemd-networkd"
+	netManagerSettleMax = 30 * time.Second // сколько ждать, пока служба поднимет интерфейсы
+)
+
+// Каталоги с конфигурацией, которая может ссылаться на MAC-адрес
+var (
+	networkdConfigDirs = []string{"/etc/systemd/network", "/run/systemd/network"}
+	udevRulesDir       = "/etc/udev/rules.d"
+	netplanConfigDir   = "/etc/netplan"
+)
+
+// rewriteProfiles - режим обновления профилей, привязанных к старому MAC (ask, yes, no)
+var rewriteProfiles string
+
+// MACBoundProfile - профиль сети или правило udev, ссылающееся на заводской MAC-адрес
+type MACBoundProfile struct {
+	Kind        string // nmcli, networkd, udev, netplan
+	Name        string // UUID соединения или путь к файлу
+	Description string
+}
+
+// detectNetworkManager определяет, какая служба управляет сетью
+func detectNetworkManager() string {
+	if serviceActive("NetworkManager") {
+		if _, err := exec.LookPath("nmcli"); err == nil {
+			return netManagerNM
+		}
+	}
+	if serviceActive("systemd-networkd") {
+		if _, err := exec.LookPath("networkctl"); err == nil {
+			return netManagerNetworkd
+		}
+	}
+	return netManagerNone
+}
+
+// serviceActive проверяет, запущена ли служба systemd
+func serviceActive(name string) bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return false
+	}
+	return runCommandNoOutput("systemctl", "is-active", "--quiet", name) == nil
+}
+
+// managerControlsInterface проверяет, управляет ли служба интерфейсом
+func managerControlsInterface(manager, iface string) bool {
+	switch manager {
+	case netManagerNM:
+		state, err := runCommand("nmcli", "-g", "GENERAL.STATE", "device", "show", iface)
+		if err != nil {
+			return false
+		}
+		return !strings.Contains(state, "unmanaged")
+	case netManagerNetworkd:
+		status, err := runCommand("networkctl", "status", "--no-pager", iface)
+		if err != nil {
+			return false
+		}
+		return !strings.Contains(status, "unmanaged")
+	}
+	return false
+}
+
+// restartInterfaceWithManager передаёт перезапуск интерфейса сетевой службе
+func restartInterfaceWithManager(manager, iface string) error {
+	switch manager {
+	case netManagerNM:
+		// Профиль мог быть привязан к старому адресу, поэтому сначала перечитываем профили
+		_ = runCommandNoOutput("nmcli", "connection", "reload")
+		if err := runCommandNoOutput("nmcli", "device", "reapply", iface); err == nil {
+			return nil
+		}
+		return runCommandNoOutput("nmcli", "device", "connect", iface)
+	case netManagerNetworkd:
+		_ = runCommandNoOutput("networkctl", "reload")
+		return runCommandNoOutput("networkctl", "reconfigure", iface)
+	}
+	return fmt.Errorf("no network manager to hand %s to", iface)
+}
+
+// restoreNetworkConfiguration восстанавливает сеть после прошивки. Интерфейсы, которыми управляет
+// NetworkManager или systemd-networkd, перезапускаются самой службой, чтобы не спорить с ней
+// ручным назначением адресов; остальная конфигурация восстанавливается из снимка
+func restoreNetworkConfiguration(snap *NetworkSnapshot, flashed []string) []string {
+	manager := detectNetworkManager()
+	if manager == netManagerNone {
+		// Без службы управления сетью старый адрес всё равно может быть закреплён в правилах udev или netplan
+		diffs := restoreNetworkSnapshot(snap, flashed)
+		offerProfileRewrite(manager, flashed)
+		return diffs
+	}
+
+	fmt.Printf("[INFO] Network is managed by %s\n", manager)
+	offerProfileRewrite(manager, flashed)
+
+	var handed []string
+	for _, iface := range managedCandidates(snap, flashed) {
+		if !managerControlsInterface(manager, iface) {
+			continue
+		}
+		if err := restartInterfaceWithManager(manager, iface); err != nil {
+			fmt.Printf(colorYellow+"[WARNING] %s could not restart %s: %v\n"+colorReset, manager, iface, err)
+			continue
+		}
+		fmt.Printf("[INFO] Interface %s handed to %s\n", iface, manager)
+		handed = append(handed, iface)
+	}
+
+	if len(handed) == 0 {
+		return restoreNetworkSnapshot(snap, flashed)
+	}
+
+	// Ждём, пока служба поднимет интерфейсы, и сравниваем результат со снимком
+	renames := snap.interfaceRenames(flashed)
+	rename := func(name string) string {
+		if n, ok := renames[name]; ok {
+			return n
+		}
+		return name
+	}
+	deadline := time.Now().Add(netManagerSettleMax)
+	var diffs []string
+	for {
+		current, err := takeNetworkSnapshot()
+		if err != nil {
+			return []string{"could not verify restored configuration: " + err.Error()}
+		}
+		diffs = diffNetworkSnapshots(snap, current, rename)
+		if len(diffs) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+	return diffs
+}
+
+// managedCandidates возвращает текущие имена интерфейсов, которые были активны до прошивки,
+// а также интерфейсы с новым адресом
+func managedCandidates(snap *NetworkSnapshot, flashed []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	add := func(name string) {
+		if name != "" && !seen[name] && interfaceExists(name) {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	for _, iface := range flashed {
+		add(iface)
+	}
+	if snap != nil {
+		renames := snap.interfaceRenames(flashed)
+		for _, l := range snap.activeLinks() {
+			if n, ok := renames[l.Name]; ok {
+				add(n)
+			} else {
+				add(l.Name)
+			}
+		}
+	}
+	return result
+}
+
+// previousMACs возвращает заводские адреса прошитых интерфейсов, ключ - новое имя интерфейса
+func previousMACs(flashed []string) map[string]string {
+	result := make(map[string]string)
+	current := listPCINICs()
+	for _, iface := range flashed {
+		nic, ok := findNICByInterface(current, iface)
+		if !ok {
+			continue
+		}
+		before, ok := nicsBeforeFlash[nic.PCIAddress]
+		if !ok || before.MAC == "" || strings.EqualFold(before.MAC, nic.MAC) {
+			continue
+		}
+		result[iface] = strings.ToLower(before.MAC)
+	}
+	return result
+}
+
+// findMACBoundProfiles ищет профили и правила, привязанные к адресу oldMAC
+func findMACBoundProfiles(manager, oldMAC string) []MACBoundProfile {
+	var profiles []MACBoundProfile
+
+	if manager == netManagerNM {
+		output, err := runCommand("nmcli", "-t", "-f", "UUID,NAME,TYPE", "connection", "show")
+		if err == nil {
+			for _, line := range strings.Split(output, "\n") {
+				fields := strings.SplitN(strings.TrimSpace(line), ":", 3)
+				if len(fields) < 3 || !strings.Contains(fields[2], "ethernet") {
+					continue
+				}
+				bound, err := runCommand("nmcli", "-g", "802-3-ethernet.mac-address", "connection", "show", fields[0])
+				if err != nil {
+					continue
+				}
+				if strings.EqualFold(strings.ReplaceAll(strings.TrimSpace(bound), `\:`, ":"), oldMAC) {
+					profiles = append(profiles, MACBoundProfile{
+						Kind:        "nmcli",
+						Name:        fields[0],
+						Description: fmt.Sprintf("NetworkManager connection %q", fields[1]),
+					})
+				}
+			}
+		}
+	}
+
+	var files []string
+	for _, dir := range networkdConfigDirs {
+		for _, pattern := range []string{"*.network", "*.link", "*.netdev"} {
+			matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+			files = append(files, matches...)
+		}
+	}
+	udevRules, _ := filepath.Glob(filepath.Join(udevRulesDir, "*.rules"))
+	netplanFiles, _ := filepath.Glob(filepath.Join(netplanConfigDir, "*.yaml"))
+
+	for _, group := range []struct {
+		kind  string
+		files []string
+	}{
+		{"networkd", files},
+		{"udev", udevRules},
+		{"netplan", netplanFiles},
+	} {
+		for _, path := range group.files {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			if macPattern(oldMAC).Match(data) {
+				profiles = append(profiles, MACBoundProfile{
+					Kind:        group.kind,
+					Name:        path,
+					Description: fmt.Sprintf("%s file %s", group.kind, path),
+				})
+			}
+		}
+	}
+
+	return profiles
+}
+
+// macPattern возвращает регулярное выражение для адреса без учёта регистра и вида разделителей
+func macPattern(mac string) *regexp.Regexp {
+	octets := strings.FieldsFunc(mac, func(r rune) bool { return r == ':' || r == '-' })
+	return regexp.MustCompile(`(?i)\b` + strings.Join(octets, `[:-]`) + `\b`)
+}
+
+// rewriteMACBoundProfile заменяет старый адрес на новый в профиле
+func rewriteMACBoundProfile(profile MACBoundProfile, oldMAC, newMAC string) error {
+	if profile.Kind == "nmcli" {
+		return runCommandNoOutput("nmcli", "connection", "modify", profile.Name, "802-3-ethernet.mac-address", newMAC)
+	}
+
+	info, err := os.Stat(profile.Name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(profile.Name)
+	if err != nil {
+		return err
+	}
+	updated := macPattern(oldMAC).ReplaceAll(data, []byte(newMAC))
+
+	// Сохраняем резервную копию рядом с файлом
+	if err := os.WriteFile(profile.Name+".before-mac-flash", data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("could not save backup: %v", err)
+	}
+	return os.WriteFile(profile.Name, updated, info.Mode().Perm())
+}
+
+// offerProfileRewrite находит профили, привязанные к заводским адресам, и предлагает
+// перевести их на новый адрес в соответствии с флагом -rewrite-profiles
+func offerProfileRewrite(manager string, flashed []string) {
+	for iface, oldMAC := range previousMACs(flashed) {
+		newMAC, err := permanentMAC(iface)
+		if err != nil {
+			newMAC = strings.ToLower(readSysfsValue(filepath.Join(sysClassNet, iface, "address")))
+		}
+
+		profiles := findMACBoundProfiles(manager, oldMAC)
+		if len(profiles) == 0 {
+			continue
+		}
+
+		fmt.Printf(colorYellow+"[WARNING] The following profiles are bound to the previous MAC %s of %s:\n"+colorReset, oldMAC, iface)
+		for _, p := range profiles {
+			fmt.Printf("  - %s\n", p.Description)
+		}
+
+		if !confirmProfileRewrite(newMAC) {
+			fmt.Println("[INFO] Profiles left unchanged.")
+			continue
+		}
+
+		for _, p := range profiles {
+			if err := rewriteMACBoundProfile(p, oldMAC, newMAC); err != nil {
+				fmt.Printf(colorYellow+"[WARNING] Could not update %s: %v\n"+colorReset, p.Description, err)
+				continue
+			}
+			fmt.Printf(colorGreen+"[INFO] %s now uses %s\n"+colorReset, p.Description, newMAC)
+			if p.Kind == "udev" {
+				_ = runCommandNoOutput("udevadm", "control", "--reload-rules")
+			}
+			if p.Kind == "netplan" {
+				fmt.Println("[INFO] Run 'netplan apply' or reboot to apply the updated netplan configuration.")
+			}
+		}
+	}
+}
+
+// confirmProfileRewrite спрашивает подтверждение на обновление профилей
+func confirmProfileRewrite(newMAC string) bool {
+	switch rewriteProfiles {
+	case "yes":
+		return true
+	case "no":
+		return false
+	}
+	if !term.IsTerminal(int(syscall.Stdin)) {
+		fmt.Println(colorYellow + "[WARNING] Not running interactively, use -rewrite-profiles=yes to update profiles." + colorReset)
+		return false
+	}
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("Rewrite these profiles to %s? (Y/n): ", newMAC)
+	choice, _ := reader.ReadString('\n')
+	return !strings.EqualFold(strings.TrimSpace(choice), "n")
+}
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resolvConfPath - файл настроек DNS
+const resolvConfPath = "/etc/resolv.conf"
+
+// NetworkSnapshot - полная сетевая конфигурация системы перед сменой драйверов
+type NetworkSnapshot struct {
+	TakenAt    time.Time       `json:"taken_at"`
+	Links      []SnapshotLink  `json:"links"`
+	Routes     []SnapshotRoute `json:"routes"`
+	Rules      []SnapshotRule  `json:"rules"`
+	ResolvConf string          `json:"resolv_conf,omitempty"`
+	ResolvLink string          `json:"resolv_link,omitempty"` // цель, если resolv.conf - символическая ссылка
+}
+
+// SnapshotLink - сетевой интерфейс и его адреса
+type SnapshotLink struct {
+	Name       string            `json:"name"`
+	MAC        string            `json:"mac,omitempty"`
+	MTU        int               `json:"mtu,omitempty"`
+	Up         bool              `json:"up"`
+	Master     string            `json:"master,omitempty"`      // bond или bridge, в который входит интерфейс
+	Kind       string            `json:"kind,omitempty"`        // тип виртуального интерфейса (vlan, bond, bridge...)
+	Parent     string            `json:"parent,omitempty"`      // родительский интерфейс VLAN
+	VLANID     int               `json:"vlan_id,omitempty"`     // номер VLAN
+	PCIAddress string            `json:"pci_address,omitempty"` // PCI-устройство физического интерфейса
+	Addresses  []SnapshotAddress `json:"addresses,omitempty"`
+}
+
+// SnapshotAddress - IP-адрес интерфейса
+type SnapshotAddress struct {
+	Family    string `json:"family"`
+	Local     string `json:"local"`
+	PrefixLen int    `json:"prefixlen"`
+	Broadcast string `json:"broadcast,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Dynamic   bool   `json:"dynamic,omitempty"`
+}
+
+// SnapshotRoute - маршрут из любой таблицы
+type SnapshotRoute struct {
+	Family   string `json:"family"`
+	Type     string `json:"type,omitempty"`
+	Dst      string `json:"dst"`
+	Gateway  string `json:"gateway,omitempty"`
+	Dev      string `json:"dev,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	PrefSrc  string `json:"prefsrc,omitempty"`
+	Metric   int    `json:"metric,omitempty"`
+	Table    string `json:"table,omitempty"`
+}
+
+// SnapshotRule - правило маршрутизации
+type SnapshotRule struct {
+	Family   string `json:"family"`
+	Priority int    `json:"priority"`
+	Src      string `json:"src,omitempty"`
+	SrcLen   int    `json:"srclen,omitempty"`
+	Dst      string `json:"dst,omitempty"`
+	DstLen   int    `json:"dstlen,omitempty"`
+	IIF      string `json:"iif,omitempty"`
+	OIF      string `json:"oif,omitempty"`
+	FwMark   string `json:"fwmark,omitempty"`
+	Table    string `json:"table,omitempty"`
+}
+
+// ipLinkJSON - интерфейс в выводе ip -j -d link show
+type ipLinkJSON struct {
+	IfName   string   `json:"ifname"`
+	Flags    []string `json:"flags"`
+	MTU      int      `json:"mtu"`
+	Address  string   `json:"address"`
+	LinkType string   `json:"link_type"`
+	Master   string   `json:"master"`
+	Link     string   `json:"link"`
+	LinkInfo struct {
+		InfoKind string `json:"info_kind"`
+		InfoData struct {
+			ID int `json:"id"`
+		} `json:"info_data"`
+	} `json:"linkinfo"`
+}
+
+// ipAddrJSON - адреса интерфейса в выводе ip -j addr show
+type ipAddrJSON struct {
+	IfName   string `json:"ifname"`
+	AddrInfo []struct {
+		Family    string `json:"family"`
+		Local     string `json:"local"`
+		PrefixLen int    `json:"prefixlen"`
+		Broadcast string `json:"broadcast"`
+		Scope     string `json:"scope"`
+		Dynamic   bool   `json:"dynamic"`
+	} `json:"addr_info"`
+}
+
+// ipRuleJSON - правило в выводе ip -j rule show
+type ipRuleJSON struct {
+	Priority int    `json:"priority"`
+	Src      string `json:"src"`
+	SrcLen   int    `json:"srclen"`
+	Dst      string `json:"dst"`
+	DstLen   int    `json:"dstlen"`
+	IIF      string `json:"iif"`
+	OIF      string `json:"oif"`
+	FwMark   string `json:"fwmark"`
+	Table    string `json:"table"`
+}
+
+// runIPJSON выполняет команду ip с выводом в JSON и разбирает результат
+func runIPJSON(v interface{}, args ...string) error {
+	output, err := runCommand("ip", append([]string{"-j"}, args...)...)
+	if err != nil {
+		return fmt.Errorf("ip %s failed: %v", strings.Join(args, " "), err)
+	}
+	if strings.TrimSpace(output) == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(output), v)
+}
+
+// takeNetworkSnapshot сохраняет интерфейсы, адреса, маршруты, правила и настройки DNS
+func takeNetworkSnapshot() (*NetworkSnapshot, error) {
+	snap := &NetworkSnapshot{TakenAt: time.Now()}
+
+	var links []ipLinkJSON
+	if err := runIPJSON(&links, "-d", "link", "show"); err != nil {
+		return nil, err
+	}
+	var addrs []ipAddrJSON
+	if err := runIPJSON(&addrs, "addr", "show"); err != nil {
+		return nil, err
+	}
+	addrsByLink := make(map[string][]SnapshotAddress)
+	for _, a := range addrs {
+		for _, info := range a.AddrInfo {
+			addrsByLink[a.IfName] = append(addrsByLink[a.IfName], SnapshotAddress{
+				Family:    info.Family,
+				Local:     info.Local,
+				PrefixLen: info.PrefixLen,
+				Broadcast: info.Broadcast,
+				Scope:     info.Scope,
+				Dynamic:   info.Dynamic,
+			})
+		}
+	}
+
+	for _, l := range links {
+		if l.LinkType == "loopback" {
+			continue
+		}
+		link := SnapshotLink{
+			Name:      l.IfName,
+			MAC:       strings.ToLower(l.Address),
+			MTU:       l.MTU,
+			Up:        containsString(l.Flags, "UP"),
+			Master:    l.Master,
+			Kind:      l.LinkInfo.InfoKind,
+			Addresses: addrsByLink[l.IfName],
+		}
+		if link.Kind == "vlan" {
+			link.Parent = l.Link
+			link.VLANID = l.LinkInfo.InfoData.ID
+		}
+		if devicePath, err := filepath.EvalSymlinks(filepath.Join(sysClassNet, l.IfName, "device")); err == nil {
+			link.PCIAddress = filepath.Base(devicePath)
+		}
+		snap.Links = append(snap.Links, link)
+	}
+
+	for _, family := range []string{"inet", "inet6"} {
+		flag := "-4"
+		if family == "inet6" {
+			flag = "-6"
+		}
+		var routes []SnapshotRoute
+		if err := runIPJSON(&routes, flag, "route", "show", "table", "all"); err != nil {
+			return nil, err
+		}
+		for _, r := range routes {
+			r.Family = family
+			snap.Routes = append(snap.Routes, r)
+		}
+
+		var rules []ipRuleJSON
+		if err := runIPJSON(&rules, flag, "rule", "show"); err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			snap.Rules = append(snap.Rules, SnapshotRule{
+				Family:   family,
+				Priority: r.Priority,
+				Src:      r.Src,
+				SrcLen:   r.SrcLen,
+				Dst:      r.Dst,
+				DstLen:   r.DstLen,
+				IIF:      r.IIF,
+				OIF:      r.OIF,
+				FwMark:   r.FwMark,
+				Table:    r.Table,
+			})
+		}
+	}
+
+	if target, err := os.Readlink(resolvConfPath); err == nil {
+		snap.ResolvLink = target
+	}
+	if data, err := os.ReadFile(resolvConfPath); err == nil {
+		snap.ResolvConf = string(data)
+	}
+
+	return snap, nil
+}
+
+// activeLinks возвращает интерфейсы, которые были подняты и имели адреса
+func (s *NetworkSnapshot) activeLinks() []SnapshotLink {
+	var result []SnapshotLink
+	for _, l := range s.Links {
+		if l.Up && len(l.Addresses) > 0 {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+// interfaceRenames сопоставляет имена физических интерфейсов до и после смены драйвера по адресу PCI.
+// Если устройство не найдено, исчезнувший активный интерфейс переносится на интерфейс с новым адресом
+func (s *NetworkSnapshot) interfaceRenames(flashed []string) map[string]string {
+	renames := make(map[string]string)
+	current := listPCINICs()
+	for _, l := range s.Links {
+		if l.PCIAddress == "" {
+			continue
+		}
+		if nic, ok := current[l.PCIAddress]; ok {
+			renames[l.Name] = nic.Interface
+		}
+	}
+
+	if len(flashed) == 0 {
+		return renames
+	}
+	claimed := make(map[string]bool)
+	for _, newName := range renames {
+		claimed[newName] = true
+	}
+	for _, l := range s.activeLinks() {
+		if _, ok := renames[l.Name]; ok || l.Kind != "" || interfaceExists(l.Name) {
+			continue
+		}
+		for _, iface := range flashed {
+			if !claimed[iface] {
+				renames[l.Name] = iface
+				claimed[iface] = true
+				break
+			}
+		}
+	}
+	return renames
+}
+
+// restoreNetworkSnapshot восстанавливает сохранённую конфигурацию на интерфейсах, которые
+// теперь могут называться иначе (flashed - интерфейсы с новым адресом), и возвращает
+// список того, что восстановить не удалось
+func restoreNetworkSnapshot(snap *NetworkSnapshot, flashed []string) []string {
+	if snap == nil {
+		return nil
+	}
+
+	renames := snap.interfaceRenames(flashed)
+	rename := func(name string) string {
+		if n, ok := renames[name]; ok {
+			return n
+		}
+		return name
+	}
+	for oldName, newName := range renames {
+		if oldName != newName {
+			fmt.Printf("[INFO] Interface %s is now %s\n", oldName, newName)
+		}
+	}
+
+	// Сначала физические интерфейсы, затем VLAN, которые на них создаются
+	for _, pass := range []func(SnapshotLink) bool{
+		func(l SnapshotLink) bool { return l.Kind != "vlan" },
+		func(l SnapshotLink) bool { return l.Kind == "vlan" },
+	} {
+		for _, link := range snap.Links {
+			if !pass(link) {
+				continue
+			}
+			name := rename(link.Name)
+
+			if link.Kind == "vlan" && !interfaceExists(name) {
+				parent := rename(link.Parent)
+				if interfaceExists(parent) {
+					_ = runCommandNoOutput("ip", "link", "add", "link", parent, "name", name, "type", "vlan", "id", strconv.Itoa(link.VLANID))
+				}
+			}
+			if !interfaceExists(name) {
+				continue
+			}
+
+			if link.MTU > 0 {
+				_ = runCommandNoOutput("ip", "link", "set", "dev", name, "mtu", strconv.Itoa(link.MTU))
+			}
+			if link.Master != "" && interfaceExists(link.Master) {
+				_ = runCommandNoOutput("ip", "link", "set", "dev", name, "master", link.Master)
+			}
+			if link.Up {
+				_ = runCommandNoOutput("ip", "link", "set", "dev", name, "up")
+			}
+
+			for _, addr := range link.Addresses {
+				if addr.Scope == "link" || addr.Scope == "host" {
+					continue // создаются ядром автоматически
+				}
+				if addr.Dynamic {
+					// Статический адрес вместо аренды DHCP пережил бы её срок, адрес снова получит DHCP-клиент
+					fmt.Printf("[INFO] Address %s/%d on %s was assigned by DHCP, leaving it to the DHCP client\n", addr.Local, addr.PrefixLen, name)
+					continue
+				}
+				args := []string{"addr", "replace", fmt.Sprintf("%s/%d", addr.Local, addr.PrefixLen), "dev", name}
+				if addr.Broadcast != "" {
+					args = append(args, "broadcast", addr.Broadcast)
+				}
+				if err := runCommandNoOutput("ip", args...); err == nil {
+					fmt.Printf("[INFO] Address %s/%d restored on %s\n", addr.Local, addr.PrefixLen, name)
+				}
+			}
+		}
+	}
+
+	for _, route := range snap.Routes {
+		if !route.restorable() {
+			continue
+		}
+		args := route.ipArgs(rename(route.Dev))
+		_ = runCommandNoOutput("ip", args...)
+	}
+
+	current, err := takeNetworkSnapshot()
+	if err != nil {
+		return []string{"could not verify restored configuration: " + err.Error()}
+	}
+
+	for _, rule := range snap.Rules {
+		if !current.hasRule(rule) {
+			_ = runCommandNoOutput("ip", rule.ipArgs("add", rename)...)
+		}
+	}
+
+	restoreResolvConf(snap)
+
+	// DHCP-клиенту нужно время, чтобы снова получить адрес после подъёма интерфейса
+	deadline := time.Now().Add(netManagerSettleMax)
+	for {
+		current, err = takeNetworkSnapshot()
+		if err != nil {
+			return []string{"could not verify restored configuration: " + err.Error()}
+		}
+		diffs := diffNetworkSnapshots(snap, current, rename)
+		if len(diffs) == 0 || !snap.hasDynamicAddresses() || time.Now().After(deadline) {
+			return diffs
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// hasDynamicAddresses сообщает, были ли в снимке адреса, полученные по DHCP
+func (s *NetworkSnapshot) hasDynamicAddresses() bool {
+	for _, link := range s.Links {
+		for _, addr := range link.Addresses {
+			if addr.Dynamic {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restorable проверяет, нужно ли восстанавливать маршрут вручную
+func (r SnapshotRoute) restorable() bool {
+	// Маршруты ядра появляются сами при назначении адресов, а таблица local управляется ядром.
+	// Маршруты DHCP и объявлений маршрутизаторов приходят вместе с арендой
+	if r.Protocol == "kernel" || r.Protocol == "dhcp" || r.Protocol == "ra" || r.Table == "local" {
+		return false
+	}
+	if r.Type != "" && r.Type != "unicast" {
+		return false
+	}
+	if r.Family == "inet6" && (strings.HasPrefix(r.Dst, "fe80") || strings.HasPrefix(r.Dst, "ff00")) {
+		return false
+	}
+	return true
+}
+
+// ipArgs формирует аргументы ip route replace для маршрута
+func (r SnapshotRoute) ipArgs(dev string) []string {
+	family := "-4"
+	if r.Family == "inet6" {
+		family = "-6"
+	}
+	args := []string{family, "route", "replace", r.Dst}
+	if r.Gateway != "" {
+		args = append(args, "via", r.Gateway)
+	}
+	if dev != "" {
+		args = append(args, "dev", dev)
+	}
+	if r.Protocol != "" {
+		args = append(args, "proto", r.Protocol)
+	}
+	if r.Scope != "" {
+		args = append(args, "scope", r.Scope)
+	}
+	if r.PrefSrc != "" {
+		args = append(args, "src", r.PrefSrc)
+	}
+	if r.Metric > 0 {
+		args = append(args, "metric", strconv.Itoa(r.Metric))
+	}
+	if r.Table != "" && r.Table != "main" {
+		args = append(args, "table", r.Table)
+	}
+	return args
+}
+
+// key возвращает ключ маршрута для сравнения снимков
+func (r SnapshotRoute) key(dev string) string {
+	table := r.Table
+	if table == "" {
+		table = "main"
+	}
+	return strings.Join([]string{r.Family, table, r.Dst, r.Gateway, dev, strconv.Itoa(r.Metric)}, "|")
+}
+
+// ipArgs формирует аргументы ip rule для правила
+func (r SnapshotRule) ipArgs(action string, rename func(string) string) []string {
+	family := "-4"
+	if r.Family == "inet6" {
+		family = "-6"
+	}
+	args := []string{family, "rule", action, "priority", strconv.Itoa(r.Priority)}
+	if r.Src != "" && r.Src != "all" {
+		args = append(args, "from", fmt.Sprintf("%s/%d", r.Src, r.SrcLen))
+	}
+	if r.Dst != "" && r.Dst != "all" {
+		args = append(args, "to", fmt.Sprintf("%s/%d", r.Dst, r.DstLen))
+	}
+	if r.IIF != "" {
+		args = append(args, "iif", rename(r.IIF))
+	}
+	if r.OIF != "" {
+		args = append(args, "oif", rename(r.OIF))
+	}
+	if r.FwMark != "" {
+		args = append(args, "fwmark", r.FwMark)
+	}
+	if r.Table != "" {
+		args = append(args, "table", r.Table)
+	}
+	return args
+}
+
+// hasRule проверяет наличие правила в снимке
+func (s *NetworkSnapshot) hasRule(rule SnapshotRule) bool {
+	for _, r := range s.Rules {
+		if r.Family == rule.Family && r.Priority == rule.Priority && r.Table == rule.Table &&
+			r.Src == rule.Src && r.Dst == rule.Dst && r.FwMark == rule.FwMark {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreResolvConf возвращает прежнее содержимое resolv.conf, если его переписал DHCP-клиент.
+// Символические ссылки (systemd-resolved) не трогаем
+func restoreResolvConf(snap *NetworkSnapshot) {
+	if snap.ResolvConf == "" || snap.ResolvLink != "" {
+		return
+	}
+	if _, err := os.Readlink(resolvConfPath); err == nil {
+		return
+	}
+	data, err := os.ReadFile(resolvConfPath)
+	if err == nil && string(data) == snap.ResolvConf {
+		return
+	}
+	if err := os.WriteFile(resolvConfPath, []byte(snap.ResolvConf), 0644); err == nil {
+		fmt.Println("[INFO] DNS configuration restored")
+	}
+}
+
+// diffNetworkSnapshots сравнивает исходную конфигурацию с текущей и перечисляет расхождения
+func diffNetworkSnapshots(before, after *NetworkSnapshot, rename func(string) string) []string {
+	var diffs []string
+
+	afterLinks := make(map[string]SnapshotLink)
+	for _, l := range after.Links {
+		afterLinks[l.Name] = l
+	}
+
+	for _, link := range before.Links {
+		name := rename(link.Name)
+		current, ok := afterLinks[name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("interface %s is missing", name))
+			continue
+		}
+		if link.Up && !current.Up {
+			diffs = append(diffs, fmt.Sprintf("interface %s is down", name))
+		}
+		if link.MTU > 0 && link.MTU != current.MTU {
+			diffs = append(diffs, fmt.Sprintf("interface %s MTU is %d, was %d", name, current.MTU, link.MTU))
+		}
+		if link.Master != "" && link.Master != current.Master {
+			diffs = append(diffs, fmt.Sprintf("interface %s is no longer a member of %s", name, link.Master))
+		}
+		dhcpChecked := make(map[string]bool)
+		for _, addr := range link.Addresses {
+			if addr.Scope == "link" || addr.Scope == "host" {
+				continue
+			}
+			found := false
+			for _, a := range current.Addresses {
+				// Новая аренда DHCP может выдать другой адрес - достаточно любой аренды того же семейства
+				if addr.Dynamic && a.Dynamic && a.Family == addr.Family && a.Scope != "link" && a.Scope != "host" {
+					found = true
+					break
+				}
+				if a.Local == addr.Local && a.PrefixLen == addr.PrefixLen {
+					found = true
+					break
+				}
+			}
+			switch {
+			case found:
+			case addr.Dynamic:
+				if !dhcpChecked[addr.Family] {
+					dhcpChecked[addr.Family] = true
+					diffs = append(diffs, fmt.Sprintf("no %s address from DHCP on %s (had %s/%d)", addr.Family, name, addr.Local, addr.PrefixLen))
+				}
+			default:
+				diffs = append(diffs, fmt.Sprintf("address %s/%d is missing on %s", addr.Local, addr.PrefixLen, name))
+			}
+		}
+	}
+
+	afterRoutes := make(map[string]bool)
+	for _, r := range after.Routes {
+		afterRoutes[r.key(r.Dev)] = true
+	}
+	for _, r := range before.Routes {
+		if r.restorable() && !afterRoutes[r.key(rename(r.Dev))] {
+			desc := r.Dst
+			if r.Gateway != "" {
+				desc += " via " + r.Gateway
+			}
+			diffs = append(diffs, fmt.Sprintf("route %s (table %s) is missing", desc, r.Table))
+		}
+	}
+
+	for _, rule := range before.Rules {
+		if !after.hasRule(rule) {
+			diffs = append(diffs, fmt.Sprintf("%s rule with priority %d (table %s) is missing", rule.Family, rule.Priority, rule.Table))
+		}
+	}
+
+	if before.ResolvConf != after.ResolvConf {
+		diffs = append(diffs, "DNS configuration in "+resolvConfPath+" differs")
+	}
+
+	return diffs
+}
+
+// printNetworkRestoreReport выводит расхождения после восстановления сети
+func printNetworkRestoreReport(diffs []string) {
+	if len(diffs) == 0 {
+		fmt.Println(colorGreen + "[INFO] Network configuration fully restored" + colorReset)
+		return
+	}
+	fmt.Println(colorYellow + "[WARNING] Network configuration could not be fully restored:" + colorReset)
+	for _, d := range diffs {
+		fmt.Printf(colorYellow+"  - %s\n"+colorReset, d)
+	}
+}
+
+// containsString проверяет наличие строки в срезе
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
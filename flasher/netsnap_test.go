@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffNetworkSnapshotsDHCP(t *testing.T) {
+	before := &NetworkSnapshot{
+		Links: []SnapshotLink{{
+			Name: "enp3s0",
+			Up:   true,
+			Addresses: []SnapshotAddress{
+				{Family: "inet", Local: "192.168.1.50", PrefixLen: 24, Scope: "global", Dynamic: true},
+				{Family: "inet", Local: "10.0.0.5", PrefixLen: 8, Scope: "global"},
+				{Family: "inet6", Local: "fe80::1", PrefixLen: 64, Scope: "link"},
+			},
+		}},
+		Routes: []SnapshotRoute{
+			{Family: "inet", Dst: "default", Gateway: "192.168.1.1", Dev: "enp3s0", Protocol: "dhcp", Metric: 100, Table: "main"},
+			{Family: "inet", Dst: "172.16.0.0/12", Gateway: "10.0.0.1", Dev: "enp3s0", Protocol: "static", Table: "main"},
+		},
+	}
+	static := SnapshotAddress{Family: "inet", Local: "10.0.0.5", PrefixLen: 8, Scope: "global"}
+	staticRoute := SnapshotRoute{Family: "inet", Dst: "172.16.0.0/12", Gateway: "10.0.0.1", Dev: "enp3s1", Protocol: "static", Table: "main"}
+	rename := func(name string) string {
+		if name == "enp3s0" {
+			return "enp3s1"
+		}
+		return name
+	}
+
+	tests := []struct {
+		name  string
+		after *NetworkSnapshot
+		want  []string
+	}{
+		{
+			name: "new lease with another address",
+			after: &NetworkSnapshot{
+				Links:  []SnapshotLink{{Name: "enp3s1", Up: true, Addresses: []SnapshotAddress{static, {Family: "inet", Local: "192.168.1.77", PrefixLen: 24, Scope: "global", Dynamic: true}}}},
+				Routes: []SnapshotRoute{staticRoute},
+			},
+		},
+		{
+			name: "lease not renewed yet",
+			after: &NetworkSnapshot{
+				Links:  []SnapshotLink{{Name: "enp3s1", Up: true, Addresses: []SnapshotAddress{static}}},
+				Routes: []SnapshotRoute{staticRoute},
+			},
+			want: []string{"no inet address from DHCP on enp3s1 (had 192.168.1.50/24)"},
+		},
+		{
+			name: "static address and route are still compared exactly",
+			after: &NetworkSnapshot{
+				Links: []SnapshotLink{{Name: "enp3s1", Up: true, Addresses: []SnapshotAddress{{Family: "inet", Local: "192.168.1.50", PrefixLen: 24, Scope: "global", Dynamic: true}}}},
+			},
+			want: []string{"address 10.0.0.5/8 is missing on enp3s1", "route 172.16.0.0/12 via 10.0.0.1 (table main) is missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffNetworkSnapshots(before, tt.after, rename); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteRestorable(t *testing.T) {
+	tests := []struct {
+		route SnapshotRoute
+		want  bool
+	}{
+		{SnapshotRoute{Family: "inet", Dst: "default", Gateway: "10.0.0.1", Protocol: "static"}, true},
+		{SnapshotRoute{Family: "inet", Dst: "default", Gateway: "192.168.1.1", Protocol: "dhcp"}, false},
+		{SnapshotRoute{Family: "inet6", Dst: "default", Gateway: "fe80::1", Protocol: "ra"}, false},
+		{SnapshotRoute{Family: "inet", Dst: "10.0.0.0/8", Protocol: "kernel"}, false},
+		{SnapshotRoute{Family: "inet", Dst: "10.0.0.5", Table: "local"}, false},
+		{SnapshotRoute{Family: "inet6", Dst: "fe80::/64", Protocol: "boot"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.route.restorable(); got != tt.want {
+			t.Errorf("restorable(%+v) = %v, want %v", tt.route, got, tt.want)
+		}
+	}
+}
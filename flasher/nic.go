@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sysClassNet - каталог sysfs с сетевыми интерфейсами
+const sysClassNet = "/sys/class/net"
+
+// NICInfo описывает физическую сетевую карту, найденную через sysfs
+type NICInfo struct {
+	Interface          string
+	MAC                string
+	PCIAddress         string
+	PCIVendor          string
+	PCIDevice          string
+	PCISubsystemVendor string
+	PCISubsystemDevice string
+	Driver             string
+	PermanentMAC       string // аппаратный адрес, заполняется только в снимке до прошивки
+}
+
+// nicsBeforeFlash - состояние сетевых карт до прошивки, ключ - адрес PCI
+var nicsBeforeFlash map[string]NICInfo
+
+// listPCINICs возвращает сетевые интерфейсы, за которыми стоит PCI-устройство
+func listPCINICs() map[string]NICInfo {
+	result := make(map[string]NICInfo)
+
+	entries, err := os.ReadDir(sysClassNet)
+	if err != nil {
+		return result
+	}
+
+	for _, entry := range entries {
+		iface := entry.Name()
+		deviceLink := filepath.Join(sysClassNet, iface, "device")
+		devicePath, err := filepath.EvalSymlinks(deviceLink)
+		if err != nil {
+			continue // виртуальный интерфейс
+		}
+
+		vendor := readSysfsValue(filepath.Join(devicePath, "vendor"))
+		if vendor == "" {
+			continue // не PCI-устройство
+		}
+
+		nic := NICInfo{
+			Interface:          iface,
+			MAC:                strings.ToLower(readSysfsValue(filepath.Join(sysClassNet, iface, "address"))),
+			PCIAddress:         filepath.Base(devicePath),
+			PCIVendor:          vendor,
+			PCIDevice:          readSysfsValue(filepath.Join(devicePath, "device")),
+			PCISubsystemVendor: readSysfsValue(filepath.Join(devicePath, "subsystem_vendor")),
+			PCISubsystemDevice: readSysfsValue(filepath.Join(devicePath, "subsystem_device")),
+		}
+		if driverPath, err := filepath.EvalSymlinks(filepath.Join(devicePath, "driver")); err == nil {
+			nic.Driver = filepath.Base(driverPath)
+		}
+
+		result[nic.PCIAddress] = nic
+	}
+
+	return result
+}
+
+// snapshotNICs возвращает сетевые карты вместе с аппаратными адресами для снимка до прошивки
+func snapshotNICs() map[string]NICInfo {
+	nics := listPCINICs()
+	for addr, nic := range nics {
+		if perm, err := permanentMAC(nic.Interface); err == nil {
+			nic.PermanentMAC = perm
+			nics[addr] = nic
+		}
+	}
+	return nics
+}
+
+// findNICByInterface ищет сетевую карту по имени интерфейса
+func findNICByInterface(nics map[string]NICInfo, iface string) (NICInfo, bool) {
+	for _, nic := range nics {
+		if nic.Interface == iface {
+			return nic, true
+		}
+	}
+	return NICInfo{}, false
+}
+
+// readSysfsValue читает однострочный атрибут sysfs
+func readSysfsValue(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// buildHardwareBinding собирает данные о плате и сетевой карте, получившей адрес
+func buildHardwareBinding(interfaces []string) *HardwareBinding {
+	binding := &HardwareBinding{}
+
+	if isUsableDMIValue(dmiInfo.SystemUUID) {
+		binding.SystemUUID = dmiInfo.SystemUUID
+	}
+	if isUsableDMIValue(dmiInfo.SystemSerial) {
+		binding.SystemSerial = dmiInfo.SystemSerial
+	}
+	if isUsableDMIValue(dmiInfo.BoardSerial) {
+		binding.BoardSerial = dmiInfo.BoardSerial
+	}
+
+	if len(interfaces) > 0 {
+		binding.Interface = interfaces[0]
+		if nic, ok := findNICByInterface(listPCINICs(), interfaces[0]); ok {
+			binding.PCIAddress = nic.PCIAddress
+			binding.PCIVendor = nic.PCIVendor
+			binding.PCIDevice = nic.PCIDevice
+			binding.PCISubsystemVendor = nic.PCISubsystemVendor
+			binding.PCISubsystemDevice = nic.PCISubsystemDevice
+
+			// Заводской адрес - аппаратный адрес карты из снимка до прошивки: адрес интерфейса
+			// мог быть назначен поверх и не совпадать с записанным в efuse
+			if before, ok := nicsBeforeFlash[nic.PCIAddress]; ok && before.PermanentMAC != "" {
+				if perm, err := permanentMAC(nic.Interface); err != nil || !strings.EqualFold(before.PermanentMAC, perm) {
+					binding.PreviousMAC = before.PermanentMAC
+				}
+			}
+		}
+	}
+
+	if *binding == (HardwareBinding{}) {
+		return nil
+	}
+	return binding
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCapturedOutput - сколько последних байт stdout и stderr команды сохраняется в логе
+const maxCapturedOutput = 4096
+
+// OperationStage - этап операции: время, результат и запущенные команды
+type OperationStage struct {
+	Name       string          `json:"name"`
+	StartedAt  time.Time       `json:"started_at"`
+	DurationMs int64           `json:"duration_ms"`
+	Success    bool            `json:"success"`
+	Detail     string          `json:"detail,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Commands   []CommandRecord `json:"commands,omitempty"`
+}
+
+// CommandRecord - запуск внешней команды внутри этапа
+type CommandRecord struct {
+	Command    string `json:"command"`
+	DurationMs int64  `json:"duration_ms"`
+	ExitCode   int    `json:"exit_code"` // -1, если команда не запустилась или была прервана сигналом
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"` // вывод обрезан до последних maxCapturedOutput байт
+}
+
+// InterfaceRecord - сетевая карта до и после операции
+type InterfaceRecord struct {
+	Interface   string `json:"interface"`
+	PCIAddress  string `json:"pci_address"`
+	PCIVendor   string `json:"pci_vendor,omitempty"`
+	PCIDevice   string `json:"pci_device,omitempty"`
+	Driver      string `json:"driver,omitempty"`
+	PreviousMAC string `json:"previous_mac,omitempty"`
+	CurrentMAC  string `json:"current_mac,omitempty"`
+}
+
+// PoolFileFingerprint - отпечаток зашифрованного файла пула до и после операции
+type PoolFileFingerprint struct {
+	Path         string `json:"path"`
+	SHA256Before string `json:"sha256_before,omitempty"`
+	SHA256After  string `json:"sha256_after,omitempty"`
+}
+
+// operationRecorder собирает этапы текущей операции для лога
+type operationRecorder struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	stages    []*OperationStage
+	open      []*OperationStage // незавершённые этапы, последний получает команды
+	attempts  int
+	backend   string
+	poolFile  PoolFileFingerprint
+}
+
+// opRecorder - записи операции текущего запуска
+var opRecorder = &operationRecorder{startedAt: time.Now()}
+
+// stageHandle завершает этап, начатый beginStage
+type stageHandle struct {
+	stage *OperationStage
+}
+
+// beginStage начинает этап операции. Команды, запущенные до его завершения, попадают в этот этап
+func beginStage(name string) *stageHandle {
+	stage := &OperationStage{Name: name, StartedAt: time.Now()}
+	opRecorder.mu.Lock()
+	opRecorder.stages = append(opRecorder.stages, stage)
+	opRecorder.open = append(opRecorder.open, stage)
+	opRecorder.mu.Unlock()
+	return &stageHandle{stage: stage}
+}
+
+// detail добавляет пояснение к этапу
+func (h *stageHandle) detail(text string) {
+	opRecorder.mu.Lock()
+	defer opRecorder.mu.Unlock()
+	if h.stage.Detail != "" {
+		h.stage.Detail += "; "
+	}
+	h.stage.Detail += text
+}
+
+// finish завершает этап с результатом err
+func (h *stageHandle) finish(err error) {
+	opRecorder.mu.Lock()
+	defer opRecorder.mu.Unlock()
+
+	h.stage.DurationMs = time.Since(h.stage.StartedAt).Milliseconds()
+	h.stage.Success = err == nil
+	if err != nil {
+		h.stage.Error = err.Error()
+	}
+	for i, s := range opRecorder.open {
+		if s == h.stage {
+			opRecorder.open = append(opRecorder.open[:i], opRecorder.open[i+1:]...)
+			break
+		}
+	}
+}
+
+// recordCommand добавляет запуск команды в текущий этап. Вне этапов команды не записываются
+func recordCommand(rec CommandRecord) {
+	opRecorder.mu.Lock()
+	defer opRecorder.mu.Unlock()
+	if len(opRecorder.open) == 0 {
+		return
+	}
+	stage := opRecorder.open[len(opRecorder.open)-1]
+	stage.Commands = append(stage.Commands, rec)
+}
+
+// newCommandRecord заполняет запись о команде по результату её выполнения
+func newCommandRecord(cmd *exec.Cmd, started time.Time, stdout, stderr *tailBuffer, runErr error) CommandRecord {
+	rec := CommandRecord{
+		Command:    strings.Join(cmd.Args, " "),
+		DurationMs: time.Since(started).Milliseconds(),
+		Stdout:     strings.TrimSpace(stdout.String()),
+		Stderr:     strings.TrimSpace(stderr.String()),
+		Truncated:  stdout.truncated || stderr.truncated,
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+		rec.ExitCode = 0
+	case errors.As(runErr, &exitErr):
+		rec.ExitCode = exitErr.ExitCode()
+	default:
+		rec.ExitCode = -1
+		if rec.Stderr == "" {
+			rec.Stderr = runErr.Error()
+		}
+	}
+	return rec
+}
+
+// runRecorded запускает команду: общий вывод пишется в combined, а запуск с кодом возврата
+// и отдельными stdout и stderr попадает в текущий этап операции
+func runRecorded(cmd *exec.Cmd, combined io.Writer) error {
+	shared := &lockedWriter{w: combined}
+	stdout, stderr := &tailBuffer{}, &tailBuffer{}
+	cmd.Stdout = io.MultiWriter(shared, stdout)
+	cmd.Stderr = io.MultiWriter(shared, stderr)
+
+	started := time.Now()
+	err := cmd.Run()
+	recordCommand(newCommandRecord(cmd, started, stdout, stderr, err))
+	return err
+}
+
+// recordWriteAttempt запоминает номер последней попытки записи
+func recordWriteAttempt(attempt int) {
+	opRecorder.mu.Lock()
+	opRecorder.attempts = attempt
+	opRecorder.mu.Unlock()
+}
+
+// recordBackend запоминает выбранный способ прошивки
+func recordBackend(name string) {
+	opRecorder.mu.Lock()
+	opRecorder.backend = name
+	opRecorder.mu.Unlock()
+}
+
+// recordPoolFile запоминает отпечаток файла пула: до операции при загрузке, после - при сохранении
+func recordPoolFile(path string, after bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+
+	opRecorder.mu.Lock()
+	defer opRecorder.mu.Unlock()
+	opRecorder.poolFile.Path = path
+	if after {
+		opRecorder.poolFile.SHA256After = hex.EncodeToString(sum[:])
+	} else {
+		opRecorder.poolFile.SHA256Before = hex.EncodeToString(sum[:])
+		opRecorder.poolFile.SHA256After = opRecorder.poolFile.SHA256Before
+	}
+}
+
+// fillOperationDetails переносит собранные этапы в лог. Этапы передаются только в один лог:
+// следующий лог того же запуска получает этапы, начатые после предыдущего
+func fillOperationDetails(logData *LogData) {
+	opRecorder.mu.Lock()
+	defer opRecorder.mu.Unlock()
+
+	logData.StartedAt = opRecorder.startedAt.Format(time.RFC3339)
+	logData.DurationMs = time.Since(opRecorder.startedAt).Milliseconds()
+	logData.Backend = opRecorder.backend
+	logData.WriteAttempts = opRecorder.attempts
+	if opRecorder.poolFile.Path != "" {
+		pf := opRecorder.poolFile
+		logData.PoolFile = &pf
+		opRecorder.poolFile.SHA256Before = pf.SHA256After
+	}
+
+	for _, s := range opRecorder.stages {
+		logData.Stages = append(logData.Stages, *s)
+	}
+	opRecorder.stages = nil
+	opRecorder.attempts = 0
+}
+
+// interfaceRecords сопоставляет сетевые карты до операции и сейчас по адресу PCI
+func interfaceRecords() []InterfaceRecord {
+	current := listPCINICs()
+
+	addresses := make(map[string]bool)
+	for addr := range nicsBeforeFlash {
+		addresses[addr] = true
+	}
+	for addr := range current {
+		addresses[addr] = true
+	}
+
+	var records []InterfaceRecord
+	for addr := range addresses {
+		before, hadBefore := nicsBeforeFlash[addr]
+		now, hasNow := current[addr]
+
+		nic := now
+		if !hasNow {
+			nic = before
+		}
+		rec := InterfaceRecord{
+			Interface:  nic.Interface,
+			PCIAddress: addr,
+			PCIVendor:  nic.PCIVendor,
+			PCIDevice:  nic.PCIDevice,
+			Driver:     nic.Driver,
+		}
+		if hadBefore {
+			rec.PreviousMAC = before.MAC
+		}
+		if hasNow {
+			rec.CurrentMAC = now.MAC
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].PCIAddress < records[j].PCIAddress })
+	return records
+}
+
+// tailBuffer хранит последние maxCapturedOutput байт записанного вывода
+type tailBuffer struct {
+	mu        sync.Mutex
+	data      []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > maxCapturedOutput {
+		b.data = append([]byte(nil), b.data[len(b.data)-maxCapturedOutput:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
+
+// lockedWriter позволяет писать stdout и stderr команды в один буфер из разных горутин
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
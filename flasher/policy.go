@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AllocationPolicy описывает правила выбора MAC-адресов в зависимости от данных DMI
+type AllocationPolicy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule сопоставляет поля DMI с диапазоном адресов, количеством портов и драйвером.
+// Пустое поле совпадает с любым значением, в непустых допускаются шаблоны вида "X570*"
+// и регулярные выражения между косыми чертами: "/^X5[57]0/"
+type PolicyRule struct {
+	Name                  string `json:"name"`
+	SystemManufacturer    string `json:"system_manufacturer,omitempty"`
+	ProductName           string `json:"product_name,omitempty"`
+	BaseboardManufacturer string `json:"baseboard_manufacturer,omitempty"`
+	BaseboardProduct      string `json:"baseboard_product,omitempty"`
+	SKU                   string `json:"sku,omitempty"`
+	RangeStart            string `json:"range_start,omitempty"`
+	RangeEnd              string `json:"range_end,omitempty"`
+	Ports                 int    `json:"ports,omitempty"`
+	Driver                string `json:"driver,omitempty"`
+}
+
+// Allocation - результат выбора адресов для платы
+type Allocation struct {
+	Rule      *PolicyRule // сработавшее правило (nil, если политика не задана)
+	Addresses []string    // выделенные адреса, первый прошивается в сетевую карту
+}
+
+// matches проверяет, подходит ли правило к данным DMI платы
+func (r *PolicyRule) matches(dmi DMIInfo) bool {
+	return matchDMIField(r.SystemManufacturer, dmi.SystemManufacturer) &&
+		matchDMIField(r.ProductName, dmi.ProductName) &&
+		matchDMIField(r.BaseboardManufacturer, dmi.BaseboardManufacturer) &&
+		matchDMIField(r.BaseboardProduct, dmi.BaseboardProduct) &&
+		matchDMIField(r.SKU, dmi.SKU)
+}
+
+// portCount возвращает количество адресов, которое требуется плате
+func (r *PolicyRule) portCount() int {
+	if r.Ports <= 0 {
+		return 1
+	}
+	return r.Ports
+}
+
+// matchDMIField сравнивает значение поля DMI с шаблоном или регулярным выражением без учёта регистра
+func matchDMIField(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	if expr, isRegexp := dmiRegexp(pattern); isRegexp {
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(strings.TrimSpace(value))
+	}
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(strings.TrimSpace(value)))
+	if err != nil {
+		// Некорректный шаблон сравниваем как обычную строку
+		return strings.EqualFold(pattern, value)
+	}
+	return ok
+}
+
+// dmiRegexp возвращает регулярное выражение, если шаблон записан между косыми чертами
+func dmiRegexp(pattern string) (string, bool) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return pattern[1 : len(pattern)-1], true
+	}
+	return "", false
+}
+
+// findPolicyRule возвращает первое правило политики, подходящее к плате
+func findPolicyRule(policy *AllocationPolicy, dmi DMIInfo) (*PolicyRule, error) {
+	for i := range policy.Rules {
+		if policy.Rules[i].matches(dmi) {
+			return &policy.Rules[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no allocation policy rule matches this board (manufacturer %q, product %q, baseboard %q %q, SKU %q)",
+		dmi.SystemManufacturer, dmi.ProductName, dmi.BaseboardManufacturer, dmi.BaseboardProduct, dmi.SKU)
+}
+
+// selectAllocation выбирает адреса для платы с учётом политики пула.
+// Если политика не задана, используется первый свободный адрес, как и раньше
+func selectAllocation(pool MACPool, dmi DMIInfo) (Allocation, error) {
+	if pool.Policy == nil || len(pool.Policy.Rules) == 0 {
+		address, err := getAvailableMACFromPool(pool)
+		if err != nil {
+			return Allocation{}, err
+		}
+		return Allocation{Addresses: []string{address}}, nil
+	}
+
+	rule, err := findPolicyRule(pool.Policy, dmi)
+	if err != nil {
+		return Allocation{}, err
+	}
+
+	// Прошивается только первый адрес выделения: остальные попали бы в пул как использованные,
+	// не будучи записаны ни в одну карту
+	if rule.Ports > 1 {
+		return Allocation{}, fmt.Errorf("policy rule %q requests %d ports, but only one port per board can be flashed", rule.Name, rule.Ports)
+	}
+
+	if rule.Driver != "" {
+		if _, err := findBackend(rule.Driver); err != nil {
+			return Allocation{}, fmt.Errorf("policy rule %q: %v", rule.Name, err)
+		}
+	}
+
+	addresses, err := getAvailableMACsInRange(pool, rule.RangeStart, rule.RangeEnd, rule.portCount())
+	if err != nil {
+		return Allocation{}, fmt.Errorf("policy rule %q: %v", rule.Name, err)
+	}
+
+	return Allocation{Rule: rule, Addresses: addresses}, nil
+}
+
+// getAvailableMACsInRange возвращает count свободных адресов из диапазона [start, end]
+func getAvailableMACsInRange(pool MACPool, start, end string, count int) ([]string, error) {
+	var low, high uint64 = 0, 0xFFFFFFFFFFFF
+	var err error
+
+	if start != "" {
+		if low, err = macToUint64(start); err != nil {
+			return nil, fmt.Errorf("invalid range start %q: %v", start, err)
+		}
+	}
+	if end != "" {
+		if high, err = macToUint64(end); err != nil {
+			return nil, fmt.Errorf("invalid range end %q: %v", end, err)
+		}
+	}
+
+	var addresses []string
+	for _, addr := range pool.Addresses {
+		if !isAddressAvailable(addr) {
+			continue
+		}
+		value, err := macToUint64(addr.Address)
+		if err != nil || value < low || value > high {
+			continue
+		}
+		addresses = append(addresses, addr.Address)
+		if len(addresses) == count {
+			return addresses, nil
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil, errors.New("no available MAC addresses in the configured range")
+	}
+	return nil, fmt.Errorf("only %d of %d required MAC addresses are available in the configured range", len(addresses), count)
+}
+
+// macToUint64 преобразует MAC-адрес в число для сравнения диапазонов
+func macToUint64(mac string) (uint64, error) {
+	hexStr := strings.NewReplacer(":", "", "-", "").Replace(mac)
+	if len(hexStr) != 12 {
+		return 0, errors.New("MAC address must contain 12 hex digits")
+	}
+	return strconv.ParseUint(hexStr, 16, 64)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixtureDMI возвращает данные DMI платы из вывода dmidecode в testdata
+func fixtureDMI(t *testing.T, name string) DMIInfo {
+	t.Helper()
+	return dmiInfoFromSMBIOS(parseSMBIOS(string(readFixture(t, "dmidecode/"+name))))
+}
+
+// testPool возвращает пул из адресов 00:e0:4c:00:00:01..count, занятые помечены used
+func testPool(count int, used ...int) MACPool {
+	var pool MACPool
+	for i := 1; i <= count; i++ {
+		addr := MACAddress{Address: fmt.Sprintf("00:e0:4c:00:00:%02x", i)}
+		for _, u := range used {
+			if u == i {
+				addr.Used = true
+				addr.State = stateUsed
+			}
+		}
+		pool.Addresses = append(pool.Addresses, addr)
+	}
+	return pool
+}
+
+func TestMatchDMIField(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"", "anything", true},
+		{"Supermicro", "Supermicro", true},
+		{"supermicro", "SUPERMICRO ", true},
+		{"Supermicro", "Supermicro Inc.", false},
+		{"X11*", "X11DDW-L", true},
+		{"X11D?W-L", "x11ddw-l", true},
+		{"X12*", "X11DDW-L", false},
+		{"MS-7C[0-5]?", "MS-7C56", true},
+		{"MS-7C[0-4]?", "MS-7C56", false},
+		{"/^SYS-10[0-9]{2}P/", "SYS-1029P-WTR", true},
+		{"/^sys-10/", "SYS-1029P-WTR", true},
+		{"/WTR$/", "SYS-1029P-WTR-X", false},
+		{"/B[45]50-A/", "B550-A PRO (MS-7C56)", true},
+		{"/[unclosed/", "[unclosed", false},
+		{"[unclosed", "[unclosed", true},
+		{"/", "/", true},
+	}
+	for _, tt := range tests {
+		if got := matchDMIField(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("matchDMIField(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSelectAllocationRules(t *testing.T) {
+	desktop := fixtureDMI(t, "desktop.txt")
+	server := fixtureDMI(t, "server-2cpu.txt")
+
+	rules := []PolicyRule{
+		{Name: "supermicro X11", SystemManufacturer: "Supermicro", BaseboardProduct: "/^X11/", RangeStart: "00:e0:4c:00:00:05", Ports: 1},
+		{Name: "supermicro", SystemManufacturer: "Supermicro*", RangeStart: "00:e0:4c:00:00:03"},
+		{Name: "msi", SystemManufacturer: "Micro-Star*", ProductName: "MS-7C5?", RangeEnd: "00:e0:4c:00:00:02", Driver: "fake"},
+	}
+
+	tests := []struct {
+		name      string
+		rules     []PolicyRule
+		dmi       DMIInfo
+		rule      string
+		addresses []string
+	}{
+		{
+			name:      "first matching rule wins",
+			rules:     rules,
+			dmi:       server,
+			rule:      "supermicro X11",
+			addresses: []string{"00:e0:4c:00:00:05"},
+		},
+		{
+			name:      "broader rule listed first shadows the specific one",
+			rules:     []PolicyRule{rules[1], rules[0]},
+			dmi:       server,
+			rule:      "supermicro",
+			addresses: []string{"00:e0:4c:00:00:03"},
+		},
+		{
+			name:      "glob rule with driver",
+			rules:     rules,
+			dmi:       desktop,
+			rule:      "msi",
+			addresses: []string{"00:e0:4c:00:00:02"},
+		},
+		{
+			name:      "catch-all rule after specific ones",
+			rules:     append(append([]PolicyRule(nil), rules[0]), PolicyRule{Name: "default"}),
+			dmi:       desktop,
+			rule:      "default",
+			addresses: []string{"00:e0:4c:00:00:02"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := testPool(7, 1)
+			pool.Policy = &AllocationPolicy{Rules: tt.rules}
+
+			allocation, err := selectAllocation(pool, tt.dmi)
+			if err != nil {
+				t.Fatalf("selectAllocation: %v", err)
+			}
+			if allocation.Rule == nil || allocation.Rule.Name != tt.rule {
+				t.Errorf("rule = %+v, want %q", allocation.Rule, tt.rule)
+			}
+			if !reflect.DeepEqual(allocation.Addresses, tt.addresses) {
+				t.Errorf("addresses = %v, want %v", allocation.Addresses, tt.addresses)
+			}
+		})
+	}
+}
+
+func TestSelectAllocationRefusesBoard(t *testing.T) {
+	desktop := fixtureDMI(t, "desktop.txt")
+
+	tests := []struct {
+		name  string
+		rules []PolicyRule
+		err   string
+	}{
+		{
+			name:  "no rule matches",
+			rules: []PolicyRule{{Name: "supermicro", SystemManufacturer: "Supermicro"}, {Name: "x570", BaseboardProduct: "/X570/"}},
+			err:   "no allocation policy rule matches this board",
+		},
+		{
+			name:  "range exhausted",
+			rules: []PolicyRule{{Name: "msi", ProductName: "MS-7C56", RangeStart: "00:e0:4c:00:00:07"}},
+			err:   "no available MAC addresses in the configured range",
+		},
+		{
+			name:  "more than one port",
+			rules: []PolicyRule{{Name: "msi", ProductName: "MS-7C56", Ports: 2}},
+			err:   "only one port per board can be flashed",
+		},
+		{
+			name:  "unknown driver",
+			rules: []PolicyRule{{Name: "msi", ProductName: "MS-7C56", Driver: "e1000flash"}},
+			err:   "unknown flashing backend",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := testPool(6)
+			pool.Policy = &AllocationPolicy{Rules: tt.rules}
+
+			allocation, err := selectAllocation(pool, desktop)
+			if err == nil {
+				t.Fatalf("expected an error, got %+v", allocation)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSelectAllocationWithoutPolicy(t *testing.T) {
+	pool := testPool(3, 1)
+	allocation, err := selectAllocation(pool, DMIInfo{})
+	if err != nil {
+		t.Fatalf("selectAllocation: %v", err)
+	}
+	if allocation.Rule != nil || !reflect.DeepEqual(allocation.Addresses, []string{"00:e0:4c:00:00:02"}) {
+		t.Errorf("allocation = %+v, want the first free address without a rule", allocation)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Результаты отдельных проверок
+const (
+	preflightPass = "PASS"
+	preflightWarn = "WARN"
+	preflightFail = "FAIL"
+)
+
+// Файлы ядра, по которым определяется режим Secure Boot и блокировки
+const (
+	secureBootEFIVar = "/sys/firmware/efi/efivars/SecureBoot-8be4df61-93ca-11d2-aa0d-e398b9e5c5b8"
+	lockdownFile     = "/sys/kernel/security/lockdown"
+	sigEnforceParam  = "/sys/module/module/parameters/sig_enforce"
+)
+
+// PreflightResult - результат одной проверки перед прошивкой
+type PreflightResult struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// preflightResult формирует результат проверки по ошибке: nil - успех, иначе провал
+func preflightResult(name string, err error, detail string) PreflightResult {
+	if err != nil {
+		return PreflightResult{Name: name, Status: preflightFail, Detail: err.Error()}
+	}
+	return PreflightResult{Name: name, Status: preflightPass, Detail: detail}
+}
+
+// runPreflight выполняет общие проверки окружения и проверки выбранного способа прошивки
+func runPreflight(backend FlashBackend) []PreflightResult {
+	var results []PreflightResult
+
+	if os.Geteuid() == 0 {
+		results = append(results, PreflightResult{Name: "Root privileges", Status: preflightPass})
+	} else {
+		results = append(results, PreflightResult{Name: "Root privileges", Status: preflightFail, Detail: "run the flasher as root"})
+	}
+
+	results = append(results, checkPoolReadable(poolFilePath))
+	return append(results, backend.Preflight()...)
+}
+
+// printPreflightTable выводит таблицу результатов и возвращает false, если есть проваленные проверки
+func printPreflightTable(results []PreflightResult) bool {
+	fmt.Println(colorBlue + "Pre-flight checks:" + colorReset)
+	ok := true
+	for _, r := range results {
+		color := colorGreen
+		switch r.Status {
+		case preflightWarn:
+			color = colorYellow
+		case preflightFail:
+			color = colorRed
+			ok = false
+		}
+		fmt.Printf("  %s%-4s%s  %-28s %s\n", color, r.Status, colorReset, r.Name, r.Detail)
+	}
+	return ok
+}
+
+// runPreflightCommand выполняет подкоманду preflight и возвращает код завершения
+func runPreflightCommand() int {
+	var err error
+	cDir, err = os.Getwd()
+	if err != nil {
+		criticalError("Could not get current directory: " + err.Error())
+		return 1
+	}
+
+	// Если карта не найдена, проверяем окружение для способа прошивки по умолчанию
+	backend := flashBackends[0]
+	if backendName != "" {
+		if backend, err = findBackend(backendName); err != nil {
+			criticalError(err.Error())
+			return 1
+		}
+	} else {
+		nics := listPCINICs()
+		for _, b := range flashBackends {
+			if len(b.Detect(nics)) > 0 {
+				backend = b
+				break
+			}
+		}
+	}
+
+	if !printPreflightTable(runPreflight(backend)) {
+		fmt.Println(colorRed + "Pre-flight checks failed." + colorReset)
+		return 1
+	}
+	successMessage("All pre-flight checks passed")
+	return 0
+}
+
+// checkPoolReadable проверяет, что файл пула существует, читается и похож на зашифрованный пул.
+// Пароль не запрашивается, поэтому содержимое пула здесь не проверяется
+func checkPoolReadable(path string) PreflightResult {
+	name := "MAC pool file"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return preflightResult(name, fmt.Errorf("cannot read %s: %v", path, err), "")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil || len(decoded) <= saltSize {
+		return preflightResult(name, fmt.Errorf("%s is not an encrypted MAC pool", path), "")
+	}
+
+	// Рядом с пулом сохраняется резервная копия, поэтому каталог должен быть доступен для записи
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return preflightResult(name, fmt.Errorf("directory %s is not writable: %v", dir, err), "")
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	return preflightResult(name, nil, path)
+}
+
+// checkModuleLoading проверяет, позволит ли ядро загрузить модуль: без подписи или
+// с подписью настроенным ключом
+func checkModuleLoading() PreflightResult {
+	name := "Secure Boot / lockdown"
+
+	var enforced string
+	if data, err := os.ReadFile(lockdownFile); err == nil {
+		// Текущий режим указан в квадратных скобках: "none [integrity] confidentiality"
+		mode := string(data)
+		if start, end := strings.Index(mode, "["), strings.Index(mode, "]"); start != -1 && end > start {
+			mode = mode[start+1 : end]
+		}
+		if mode != "none" {
+			enforced = fmt.Sprintf("kernel lockdown is %q", mode)
+		}
+	}
+	if enforced == "" && readSysfsValue(sigEnforceParam) == "Y" {
+		enforced = "module signature enforcement is enabled"
+	}
+
+	if signingConfigured() {
+		return checkSigningSetup(name, enforced)
+	}
+
+	if enforced != "" {
+		return PreflightResult{Name: name, Status: preflightFail,
+			Detail: enforced + ", unsigned modules will be rejected; use -sign-key and -sign-cert"}
+	}
+	if secureBootEnabled() {
+		return PreflightResult{Name: name, Status: preflightWarn,
+			Detail: "Secure Boot is enabled; the kernel may reject unsigned modules"}
+	}
+	return PreflightResult{Name: name, Status: preflightPass, Detail: "unsigned modules can be loaded"}
+}
+
+// checkSigningSetup проверяет ключ, сертификат и утилиту подписи, а при обязательной
+// проверке подписей - что сертификат зарегистрирован в MOK
+func checkSigningSetup(name, enforced string) PreflightResult {
+	for _, path := range []string{signKeyPath, signCertPath} {
+		if _, err := os.ReadFile(path); err != nil {
+			return preflightResult(name, fmt.Errorf("cannot read %s: %v", path, err), "")
+		}
+	}
+	kernel, err := kernelRelease()
+	if err != nil {
+		return preflightResult(name, err, "")
+	}
+	if _, err := findSignFile(kernel); err != nil {
+		return preflightResult(name, err, "")
+	}
+
+	if enforced == "" && !secureBootEnabled() {
+		return PreflightResult{Name: name, Status: preflightPass, Detail: "modules will be signed with " + signCertPath}
+	}
+	enrolled, err := certificateEnrolled()
+	switch {
+	case err != nil:
+		return PreflightResult{Name: name, Status: preflightWarn,
+			Detail: fmt.Sprintf("could not check MOK enrolment of %s: %v", signCertPath, err)}
+	case !enrolled:
+		return PreflightResult{Name: name, Status: preflightFail,
+			Detail: signCertPath + " is not enrolled as a MOK; run mokutil --import and reboot"}
+	}
+	return PreflightResult{Name: name, Status: preflightPass, Detail: "modules will be signed with enrolled " + signCertPath}
+}
+
+// secureBootEnabled проверяет состояние Secure Boot по переменной EFI
+func secureBootEnabled() bool {
+	data, err := os.ReadFile(secureBootEFIVar)
+	if err != nil || len(data) == 0 {
+		return false
+	}
+	// Первые 4 байта - атрибуты переменной, за ними значение
+	return data[len(data)-1] == 1
+}
+
+// checkKernelBuildEnv проверяет наличие заголовков ядра и компилятора. Если в кэше или в пакете
+// драйверов уже есть сборка модуля для текущего ядра, их отсутствие не мешает прошивке
+func checkKernelBuildEnv(srcDir, moduleName string) []PreflightResult {
+	var results []PreflightResult
+
+	bundled := false
+	if location := findDriverBundle(); location != "" {
+		result := checkDriverBundle(location, moduleName)
+		bundled = result.Status == preflightPass
+		results = append(results, result)
+	}
+	cached := bundled || hasCachedDriver(srcDir, moduleName)
+	missing := preflightFail
+	if cached {
+		missing = preflightWarn
+	}
+
+	kernel, err := kernelRelease()
+	if err != nil {
+		return append(results, preflightResult("Kernel headers", err, ""))
+	}
+	buildDir := filepath.Join("/lib/modules", kernel, "build")
+	if _, err := os.Stat(filepath.Join(buildDir, "Makefile")); err != nil {
+		results = append(results, PreflightResult{Name: "Kernel headers", Status: missing,
+			Detail: fmt.Sprintf("%s not found (install headers for %s)", buildDir, kernel)})
+	} else {
+		results = append(results, PreflightResult{Name: "Kernel headers", Status: preflightPass, Detail: kernel})
+	}
+
+	var absent []string
+	for _, tool := range []string{"make", "gcc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			absent = append(absent, tool)
+		}
+	}
+	if len(absent) > 0 {
+		results = append(results, PreflightResult{Name: "Compiler", Status: missing,
+			Detail: "missing " + strings.Join(absent, ", ")})
+	} else {
+		results = append(results, PreflightResult{Name: "Compiler", Status: preflightPass, Detail: "make, gcc"})
+	}
+
+	if cached && !bundled {
+		results = append(results, PreflightResult{Name: "Cached driver", Status: preflightPass, Detail: moduleName + " built for " + kernel})
+	}
+	return results
+}
+
+// hasCachedDriver проверяет, есть ли в кэше сборка модуля для работающего ядра
+func hasCachedDriver(srcDir, moduleName string) bool {
+	key, err := currentDriverCacheKey(srcDir)
+	if err != nil {
+		return false
+	}
+	modulePath := filepath.Join(driverCacheRoot(), key.dirName(), moduleName+".ko")
+	return checkModuleVermagic(modulePath, key.Kernel) == nil
+}
+
+// checkDriverBundle проверяет, есть ли в пакете драйверов модуль для работающего ядра
+func checkDriverBundle(location, moduleName string) PreflightResult {
+	name := "Driver bundle"
+	bundle, err := openDriverBundle(location)
+	if err != nil {
+		return PreflightResult{Name: name, Status: preflightWarn, Detail: err.Error()}
+	}
+	kernel, err := kernelRelease()
+	if err != nil {
+		return preflightResult(name, err, "")
+	}
+	arch, err := machineArch()
+	if err != nil {
+		return preflightResult(name, err, "")
+	}
+	if _, ok := bundle.findEntry(kernel, arch); !ok || bundle.manifest.Module != moduleName {
+		return PreflightResult{Name: name, Status: preflightWarn,
+			Detail: fmt.Sprintf("no %s module for kernel %s (%s) in %s", moduleName, kernel, arch, location)}
+	}
+	return PreflightResult{Name: name, Status: preflightPass, Detail: fmt.Sprintf("%s for %s in %s", moduleName, kernel, location)}
+}
+
+// preflightSummary перечисляет для лога проверки с предупреждениями и провалами
+func preflightSummary(results []PreflightResult) string {
+	var notes []string
+	for _, r := range results {
+		if r.Status != preflightPass {
+			notes = append(notes, fmt.Sprintf("%s %s: %s", r.Status, r.Name, r.Detail))
+		}
+	}
+	if len(notes) == 0 {
+		return fmt.Sprintf("all %d checks passed", len(results))
+	}
+	return strings.Join(notes, "; ")
+}
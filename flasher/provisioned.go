@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// ProvisionedBoard описывает ранее выделенный этой плате адрес из пула
+type ProvisionedBoard struct {
+	Address    string   // адрес из пула
+	State      string   // состояние адреса в пуле
+	Interfaces []string // локальные интерфейсы, на которых найден адрес
+	MatchedBy  string   // признак, по которому опознана плата
+}
+
+// isProvisionedState сообщает, мог ли адрес в этом состоянии уже попасть в плату: кроме
+// использованных это адреса незавершённых и прерванных прошивок
+func isProvisionedState(state string) bool {
+	return state == stateUsed || state == statePending || state == stateQuarantined
+}
+
+// findProvisionedBoard ищет в пуле адрес, уже выданный этой плате: сначала по аппаратным
+// MAC-адресам локальных сетевых карт, затем по UUID и серийному номеру системы из DMI
+func findProvisionedBoard(pool MACPool, dmi DMIInfo) *ProvisionedBoard {
+	return matchProvisionedBoard(pool, dmi, listPermanentMACs())
+}
+
+// matchProvisionedBoard ищет адрес платы в пуле по аппаратным адресам интерфейсов
+// (ключ - интерфейс) и данным DMI
+func matchProvisionedBoard(pool MACPool, dmi DMIInfo, permanent map[string]string) *ProvisionedBoard {
+	for _, addr := range pool.Addresses {
+		state := addressState(addr)
+		if !isProvisionedState(state) {
+			continue
+		}
+		var ifaces []string
+		for iface, mac := range permanent {
+			if strings.EqualFold(mac, addr.Address) {
+				ifaces = append(ifaces, iface)
+			}
+		}
+		if len(ifaces) > 0 {
+			sort.Strings(ifaces)
+			return &ProvisionedBoard{Address: addr.Address, State: state, Interfaces: ifaces, MatchedBy: "permanent MAC"}
+		}
+	}
+
+	for _, addr := range pool.Addresses {
+		state := addressState(addr)
+		if !isProvisionedState(state) || addr.Binding == nil {
+			continue
+		}
+		if isUsableDMIValue(dmi.SystemUUID) && strings.EqualFold(addr.Binding.SystemUUID, dmi.SystemUUID) {
+			return &ProvisionedBoard{Address: addr.Address, State: state, MatchedBy: "system UUID " + dmi.SystemUUID}
+		}
+		if isUsableDMIValue(dmi.SystemSerial) && strings.EqualFold(addr.Binding.SystemSerial, dmi.SystemSerial) {
+			return &ProvisionedBoard{Address: addr.Address, State: state, MatchedBy: "system serial " + dmi.SystemSerial}
+		}
+	}
+
+	return nil
+}
+
+// listPermanentMACs возвращает аппаратные MAC-адреса сетевых карт, ключ - интерфейс.
+// Адрес интерфейса можно переназначить, поэтому плату опознаём только по аппаратному
+func listPermanentMACs() map[string]string {
+	result := make(map[string]string)
+	for _, nic := range listPCINICs() {
+		if perm, err := permanentMAC(nic.Interface); err == nil {
+			result[nic.Interface] = perm
+		}
+	}
+	return result
+}
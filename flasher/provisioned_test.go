@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchProvisionedBoard(t *testing.T) {
+	pool := MACPool{Addresses: []MACAddress{
+		{Address: "00:e0:4c:00:00:01", Used: true, State: stateUsed, Binding: &HardwareBinding{SystemUUID: "4c4c4544-0001"}},
+		{Address: "00:e0:4c:00:00:02", Used: true, State: statePending},
+		{Address: "00:e0:4c:00:00:03", Used: true, State: stateQuarantined, Binding: &HardwareBinding{SystemSerial: "SN-0003"}},
+		{Address: "00:e0:4c:00:00:04"},
+		{Address: "00:e0:4c:00:00:05", Used: true, State: stateRetired},
+	}}
+
+	tests := []struct {
+		name      string
+		permanent map[string]string
+		dmi       DMIInfo
+		address   string
+		state     string
+		ifaces    []string
+	}{
+		{
+			name:      "used address on a permanent MAC",
+			permanent: map[string]string{"eth1": "00:e0:4c:00:00:01", "eth0": "00:e0:4c:00:00:01"},
+			address:   "00:e0:4c:00:00:01",
+			state:     stateUsed,
+			ifaces:    []string{"eth0", "eth1"},
+		},
+		{
+			name:      "pending address already burned",
+			permanent: map[string]string{"eth0": "00:E0:4C:00:00:02"},
+			address:   "00:e0:4c:00:00:02",
+			state:     statePending,
+		},
+		{
+			name:    "quarantined address matched by serial",
+			dmi:     DMIInfo{SystemSerial: "SN-0003"},
+			address: "00:e0:4c:00:00:03",
+			state:   stateQuarantined,
+		},
+		{
+			name:    "used address matched by UUID",
+			dmi:     DMIInfo{SystemUUID: "4C4C4544-0001"},
+			address: "00:e0:4c:00:00:01",
+			state:   stateUsed,
+		},
+		{
+			name:      "free and retired addresses are not provisioned",
+			permanent: map[string]string{"eth0": "00:e0:4c:00:00:04", "eth1": "00:e0:4c:00:00:05"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board := matchProvisionedBoard(pool, tt.dmi, tt.permanent)
+			if tt.address == "" {
+				if board != nil {
+					t.Fatalf("board = %+v, want none", board)
+				}
+				return
+			}
+			if board == nil {
+				t.Fatalf("board not found, want %s", tt.address)
+			}
+			if board.Address != tt.address || board.State != tt.state {
+				t.Errorf("board = %s (%s), want %s (%s)", board.Address, board.State, tt.address, tt.state)
+			}
+			if tt.ifaces != nil && !reflect.DeepEqual(board.Interfaces, tt.ifaces) {
+				t.Errorf("interfaces = %v, want %v", board.Interfaces, tt.ifaces)
+			}
+		})
+	}
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sessionJournalFile - имя общего файла журнала: для плат без идентификаторов DMI и журналов прежних версий
+const sessionJournalFile = "flasher_session.json"
+
+// sessionJournalPrefix - начало имени журнала платы, за ним следует UUID или серийный номер платы
+const sessionJournalPrefix = "flasher_session_"
+
+// signalGracePeriod - сколько ждать штатного завершения после сигнала перед принудительной очисткой
+const signalGracePeriod = 10 * time.Second
+
+// Этапы сеанса, записываемые в журнал
+const (
+	stageStarted   = "started"   // адрес выбран, система ещё не изменялась
+	stagePrepared  = "prepared"  // штатные драйверы выгружены, служебный загружен
+	stageWriting   = "writing"   // идёт запись адреса в оборудование
+	stageWritten   = "written"   // утилита прошивки завершилась успешно
+	stageVerified  = "verified"  // аппаратный адрес перечитан и совпадает
+	stageCompleted = "completed" // пул сохранён, сеанс завершён
+)
+
+var (
+	runCtxMu sync.Mutex
+	runCtx   = context.Background() // контекст, прерываемый сигналами, для внешних команд
+)
+
+// commandContext возвращает контекст для запуска внешних команд
+func commandContext() context.Context {
+	runCtxMu.Lock()
+	defer runCtxMu.Unlock()
+	return runCtx
+}
+
+// setCommandContext задаёт контекст для запуска внешних команд
+func setCommandContext(ctx context.Context) {
+	runCtxMu.Lock()
+	defer runCtxMu.Unlock()
+	runCtx = ctx
+}
+
+// runUninterruptible выполняет возврат системы в исходное состояние с внешними командами,
+// которые не отменяет сигнал: иначе после Ctrl-C ни rmmod, ни modprobe не запустились бы
+func runUninterruptible(fn func() error) error {
+	runCtxMu.Lock()
+	prev := runCtx
+	live := context.WithoutCancel(prev)
+	runCtx = live
+	runCtxMu.Unlock()
+
+	defer func() {
+		runCtxMu.Lock()
+		// CleanupStack.Run мог уже заменить контекст, его не возвращаем
+		if runCtx == live {
+			runCtx = prev
+		}
+		runCtxMu.Unlock()
+	}()
+	return fn()
+}
+
+// networkRestorePending - последний возврат сетевой конфигурации оставил расхождения со снимком
+var networkRestorePending atomic.Bool
+
+// restoreNetworkUninterruptible восстанавливает сеть из снимка, не прерываясь сигналом,
+// и запоминает, совпала ли конфигурация со снимком
+func restoreNetworkUninterruptible(snap *NetworkSnapshot, flashed []string) []string {
+	var diffs []string
+	runUninterruptible(func() error {
+		diffs = restoreNetworkConfiguration(snap, flashed)
+		return nil
+	})
+	networkRestorePending.Store(len(diffs) > 0)
+	return diffs
+}
+
+// pendingSystemRestore описывает, что не удалось вернуть в исходное состояние.
+// Пустая строка - драйверы и сеть возвращены
+func pendingSystemRestore() string {
+	var parts []string
+	if mods := moduleState.Pending(); len(mods) > 0 {
+		parts = append(parts, "kernel modules "+strings.Join(mods, ", "))
+	}
+	if networkRestorePending.Load() {
+		parts = append(parts, "network configuration")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// cleanupStage - действие по возврату системы в исходное состояние
+type cleanupStage struct {
+	name string
+	fn   func() error
+}
+
+// CleanupStack выполняет зарегистрированные этапы очистки в обратном порядке ровно один раз
+type CleanupStack struct {
+	mu     sync.Mutex
+	stages []cleanupStage
+}
+
+// cleanup - этапы очистки текущего запуска
+var cleanup = &CleanupStack{}
+
+// Push регистрирует этап очистки
+func (c *CleanupStack) Push(name string, fn func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stages = append(c.stages, cleanupStage{name: name, fn: fn})
+}
+
+// Run выполняет этапы очистки в обратном порядке. Внешние команды при этом запускаются
+// без прерываемого контекста, чтобы возврат драйверов не отменялся тем же сигналом
+func (c *CleanupStack) Run() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	setCommandContext(context.Background())
+
+	for i := len(c.stages) - 1; i >= 0; i-- {
+		stage := c.stages[i]
+		if err := stage.fn(); err != nil {
+			fmt.Printf(colorYellow+"[WARNING] Cleanup stage '%s' failed: %v\n"+colorReset, stage.name, err)
+		}
+	}
+	c.stages = nil
+}
+
+// watchForSignal ждёт сигнала и, если программа не завершилась сама за отведённое время,
+// выполняет очистку и завершает процесс
+func watchForSignal(ctx context.Context, done <-chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	fmt.Println(colorYellow + "\n[WARNING] Interrupted, stopping and restoring the system..." + colorReset)
+
+	select {
+	case <-done:
+	case <-time.After(signalGracePeriod):
+		fmt.Println(colorYellow + "[WARNING] Operation did not stop in time, forcing cleanup" + colorReset)
+		cleanup.Run()
+		os.Exit(130)
+	}
+}
+
+// SessionJournal - состояние сеанса прошивки на диске, позволяющее следующему запуску
+// обнаружить прерванный сеанс и довести его до конца
+type SessionJournal struct {
+	PID            int              `json:"pid"`
+	BootID         string           `json:"boot_id,omitempty"`
+	StartedAt      time.Time        `json:"started_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	Stage          string           `json:"stage"`
+	PoolFile       string           `json:"pool_file"`
+	MAC            string           `json:"mac"`
+	Addresses      []string         `json:"addresses"`
+	SystemUUID     string           `json:"system_uuid,omitempty"`
+	SystemSerial   string           `json:"system_serial,omitempty"`
+	Network        *NetworkSnapshot `json:"network,omitempty"`
+	RemovedModules []RemovedModule  `json:"removed_modules,omitempty"`
+	Backend        string           `json:"backend,omitempty"`
+
+	path string // файл, из которого прочитан журнал
+}
+
+var (
+	journalMu      sync.Mutex
+	sessionJournal *SessionJournal // журнал текущего сеанса (nil до выбора адреса)
+)
+
+// boardJournalKey возвращает идентификатор платы для имени файла журнала: UUID, иначе серийный номер
+func boardJournalKey() string {
+	key := ""
+	if isUsableDMIValue(dmiInfo.SystemUUID) {
+		key = dmiInfo.SystemUUID
+	} else if isUsableDMIValue(dmiInfo.SystemSerial) {
+		key = dmiInfo.SystemSerial
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(key))
+}
+
+// sessionJournalPath возвращает путь к журналу сеанса этой платы. Каталог флешера может быть общим
+// для нескольких плат (например, на флешке), поэтому каждая плата ведёт свой журнал
+func sessionJournalPath() string {
+	if key := boardJournalKey(); key != "" {
+		return filepath.Join(cDir, sessionJournalPrefix+key+".json")
+	}
+	return filepath.Join(cDir, sessionJournalFile)
+}
+
+// sharedJournalPath возвращает путь к общему журналу
+func sharedJournalPath() string {
+	return filepath.Join(cDir, sessionJournalFile)
+}
+
+// absPath возвращает абсолютный путь, а при ошибке - исходный
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// currentBootID возвращает идентификатор текущей загрузки системы
+func currentBootID() string {
+	return readSysfsValue("/proc/sys/kernel/random/boot_id")
+}
+
+// startSessionJournal создаёт журнал нового сеанса
+func startSessionJournal(allocation Allocation) {
+	journalMu.Lock()
+	sessionJournal = &SessionJournal{
+		PID:          os.Getpid(),
+		BootID:       currentBootID(),
+		StartedAt:    time.Now(),
+		Stage:        stageStarted,
+		PoolFile:     absPath(poolFilePath),
+		MAC:          allocation.Addresses[0],
+		Addresses:    allocation.Addresses,
+		SystemUUID:   dmiInfo.SystemUUID,
+		SystemSerial: dmiInfo.SystemSerial,
+	}
+	journalMu.Unlock()
+
+	updateSessionJournal(func(j *SessionJournal) {})
+}
+
+// updateSessionJournal изменяет журнал текущего сеанса и сохраняет его на диск
+func updateSessionJournal(change func(j *SessionJournal)) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	if sessionJournal == nil {
+		return
+	}
+	change(sessionJournal)
+	sessionJournal.UpdatedAt = time.Now()
+	sessionJournal.RemovedModules = moduleState.RemovedModules()
+
+	if err := writeSessionJournal(sessionJournal); err != nil {
+		fmt.Printf(colorYellow+"[WARNING] Could not write session journal: %v\n"+colorReset, err)
+	}
+}
+
+// setSessionStage записывает в журнал переход к новому этапу
+func setSessionStage(stage string) {
+	updateSessionJournal(func(j *SessionJournal) { j.Stage = stage })
+}
+
+// sessionStage возвращает текущий этап сеанса
+func sessionStage() string {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if sessionJournal == nil {
+		return ""
+	}
+	return sessionJournal.Stage
+}
+
+// finishSessionJournal завершает журнал текущего сеанса после обновления пула
+func finishSessionJournal() {
+	journalMu.Lock()
+	j := sessionJournal
+	sessionJournal = nil
+	journalMu.Unlock()
+	closeJournal(j, sessionJournalPath())
+}
+
+// closeJournal удаляет журнал сеанса, если драйверы и сеть возвращены. Иначе журнал остаётся
+// на диске с этапом completed: пул уже обновлён, а следующий запуск повторит восстановление системы
+func closeJournal(j *SessionJournal, path string) {
+	pending := pendingSystemRestore()
+	if pending == "" || j == nil {
+		removeJournalFile(path)
+		return
+	}
+
+	kept := *j
+	kept.Stage = stageCompleted
+	kept.UpdatedAt = time.Now()
+	kept.RemovedModules = moduleState.RemovedModules()
+	if err := writeJournalFile(&kept, path); err != nil {
+		fmt.Printf(colorYellow+"[WARNING] Could not write session journal: %v\n"+colorReset, err)
+	}
+	fmt.Printf(colorYellow+"[WARNING] Not restored: %s. The session journal is kept, run the flasher again or reboot.\n"+colorReset, pending)
+}
+
+// removeJournalFile удаляет файл журнала
+func removeJournalFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf(colorYellow+"[WARNING] Could not remove session journal: %v\n"+colorReset, err)
+	}
+}
+
+// writeSessionJournal атомарно сохраняет журнал текущего сеанса
+func writeSessionJournal(j *SessionJournal) error {
+	return writeJournalFile(j, sessionJournalPath())
+}
+
+// writeJournalFile атомарно сохраняет журнал в файл path
+func writeJournalFile(j *SessionJournal, path string) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readSessionJournal читает журнал прерванного сеанса, если он есть
+func readSessionJournal(path string) (*SessionJournal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	j := SessionJournal{path: path}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("corrupt session journal %s: %v", path, err)
+	}
+	return &j, nil
+}
+
+// findSessionJournal ищет журнал прерванного сеанса этой платы: сначала собственный, затем общий.
+// Общий журнал другой платы не даёт начать сеанс, если новый журнал пришлось бы записать поверх него
+func findSessionJournal() (*SessionJournal, error) {
+	own := sessionJournalPath()
+	j, err := readSessionJournal(own)
+	if err != nil || j != nil {
+		return j, err
+	}
+	if own == sharedJournalPath() {
+		return nil, nil
+	}
+	return readSessionJournal(sharedJournalPath())
+}
+
+// isFlasherProcessRunning проверяет, работает ли ещё процесс, записавший журнал
+func isFlasherProcessRunning(pid int) bool {
+	if pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false
+	}
+	self, _ := os.Executable()
+	return strings.Contains(string(cmdline), filepath.Base(self))
+}
+
+// sameBoard проверяет, что журнал относится к этой плате
+func (j *SessionJournal) sameBoard() bool {
+	if isUsableDMIValue(j.SystemUUID) && isUsableDMIValue(dmiInfo.SystemUUID) {
+		return strings.EqualFold(j.SystemUUID, dmiInfo.SystemUUID)
+	}
+	if isUsableDMIValue(j.SystemSerial) && isUsableDMIValue(dmiInfo.SystemSerial) {
+		return strings.EqualFold(j.SystemSerial, dmiInfo.SystemSerial)
+	}
+	// Без идентификаторов DMI полагаемся на совпадение загрузки
+	return j.BootID != "" && j.BootID == currentBootID()
+}
+
+// recoverInterruptedSystem обнаруживает прерванный сеанс и возвращает систему в рабочее
+// состояние: выгружает служебный драйвер, загружает штатные и восстанавливает IP-адрес.
+// Возвращает журнал, если нужно довести до конца обновление пула
+func recoverInterruptedSystem() (*SessionJournal, error) {
+	j, err := findSessionJournal()
+	if err != nil || j == nil {
+		return nil, err
+	}
+
+	if isFlasherProcessRunning(j.PID) {
+		return nil, fmt.Errorf("another flashing session (PID %d) is still running", j.PID)
+	}
+
+	fmt.Println(colorYellow + "[WARNING] An interrupted flashing session was detected:" + colorReset)
+	fmt.Printf("  Started: %s\n", j.StartedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Stage:   %s\n", j.Stage)
+	fmt.Printf("  MAC:     %s\n", j.MAC)
+
+	if !j.sameBoard() {
+		// Журнал другой платы хранит её занятые адреса; перезапись оставила бы их в pending навсегда
+		if j.path == sessionJournalPath() {
+			return nil, fmt.Errorf("the session journal %s belongs to another board; finish that session on its board first", j.path)
+		}
+		fmt.Println(colorYellow + "[WARNING] The session belongs to another board. Run the flasher on that board to finish it." + colorReset)
+		return nil, nil
+	}
+
+	// Системные изменения имеет смысл откатывать только в рамках той же загрузки
+	if j.BootID == "" || j.BootID == currentBootID() {
+		// Модули прерванного сеанса возвращаются через moduleState: то, что вернуть не удалось,
+		// останется в нём и не даст удалить журнал
+		moduleState.Adopt(j.RemovedModules, "pgdrv")
+		if err := runUninterruptible(moduleState.Restore); err != nil {
+			fmt.Printf(colorYellow+"[WARNING] %v\n"+colorReset, err)
+		}
+		if j.Network != nil {
+			printNetworkRestoreReport(restoreNetworkUninterruptible(j.Network, nil))
+		}
+	}
+
+	return j, nil
+}
+
+// samePoolFile проверяет, что журнал сеанса ссылается на тот же файл пула, что и текущий запуск
+func samePoolFile(journalPool, current string) bool {
+	if journalPool == "" {
+		return true // журналы прежних версий не хранили путь к пулу
+	}
+	a, errA := os.Stat(journalPool)
+	b, errB := os.Stat(current)
+	if errA == nil && errB == nil {
+		return os.SameFile(a, b)
+	}
+	return absPath(journalPool) == absPath(current)
+}
+
+// finishInterruptedSession доводит до конца обновление пула после сеанса, завершившегося
+// без записи результата: прерванного сигналом, аварийно или с ошибкой прошивки (reason).
+// Если адрес успел попасть в оборудование, он помечается как использованный
+func finishInterruptedSession(pool MACPool, password string, j *SessionJournal, reason string) {
+	// Адреса сеанса заняты в другом пуле: изменять текущий нельзя, журнал остаётся до запуска с тем пулом
+	if !samePoolFile(j.PoolFile, poolFilePath) {
+		fmt.Printf(colorYellow+"[WARNING] The session (%s) claimed its addresses in %s, not in %s. Run the flasher with -pool %s to finish it.\n"+colorReset,
+			reason, j.PoolFile, poolFilePath, j.PoolFile)
+		return
+	}
+
+	defer func() {
+		journalMu.Lock()
+		sessionJournal = nil
+		journalMu.Unlock()
+		path := j.path
+		if path == "" {
+			path = sessionJournalPath()
+		}
+		closeJournal(j, path)
+	}()
+
+	switch j.Stage {
+	case stageWriting, stageWritten, stageVerified:
+	case stageCompleted:
+		// Пул уже обновлён, оставалось вернуть драйверы и сеть
+		return
+	default:
+		fmt.Printf("[INFO] The session (%s) did not reach the write stage, returning its addresses to the pool.\n", reason)
+		releaseAllocation(pool, password, j.Addresses, stateFree)
+		return
+	}
+
+	ifaces, err := verifyFlashedMAC(strings.ToLower(j.MAC))
+	if err != nil {
+		fmt.Printf(colorYellow+"[WARNING] MAC %s is not present in hardware after the session (%s): %v\n"+colorReset, j.MAC, reason, err)
+		// Запись начиналась, поэтому efuse мог быть записан частично: адрес нельзя выдавать снова без проверки
+		fmt.Println(colorYellow + "[WARNING] The write had started, the address is quarantined for manual checking." + colorReset)
+		releaseAllocation(pool, password, j.Addresses, stateQuarantined)
+		return
+	}
+
+	fmt.Printf(colorGreen+"[INFO] MAC %s is present on %s despite the session ending with %s, marking it as used.\n"+colorReset,
+		j.MAC, strings.Join(ifaces, ", "), reason)
+	markAllocationAsUsed(pool, Allocation{Addresses: j.Addresses}, &ifaces)
+	if err := updatePool(pool, password, poolFilePath); err != nil {
+		return
+	}
+
+	mac = j.MAC
+	createOperationLog("Recovered MAC address update after "+reason, true)
+}
+
+// errInterrupted возвращается операциями, прерванными сигналом
+var errInterrupted = errors.New("operation interrupted")
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCloseJournalKeepsUnrestoredSession(t *testing.T) {
+	savedModules := moduleState
+	t.Cleanup(func() {
+		moduleState = savedModules
+		networkRestorePending.Store(false)
+	})
+
+	path := filepath.Join(t.TempDir(), sessionJournalFile)
+	j := &SessionJournal{Stage: stageWritten, MAC: "00:e0:4c:00:00:01", Addresses: []string{"00:e0:4c:00:00:01"}}
+
+	// Штатный драйвер не вернулся: журнал остаётся с этапом completed и списком модулей
+	moduleState = &ModuleManager{removed: []RemovedModule{{Name: "r8169"}}}
+	closeJournal(j, path)
+	kept, err := readSessionJournal(path)
+	if err != nil || kept == nil {
+		t.Fatalf("journal was not kept: %v", err)
+	}
+	if kept.Stage != stageCompleted || len(kept.RemovedModules) != 1 || kept.RemovedModules[0].Name != "r8169" {
+		t.Errorf("kept journal = %+v", kept)
+	}
+
+	// Сеть не совпала со снимком
+	moduleState = &ModuleManager{}
+	networkRestorePending.Store(true)
+	closeJournal(j, path)
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("journal removed while the network is not restored: %v", err)
+	}
+
+	// Всё возвращено - журнал удаляется
+	networkRestorePending.Store(false)
+	closeJournal(j, path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal still present after a full restore: %v", err)
+	}
+}
+
+func TestSamePoolFile(t *testing.T) {
+	dir := t.TempDir()
+	pool := filepath.Join(dir, "mac_pool.enc")
+	other := filepath.Join(dir, "other_pool.enc")
+	for _, p := range []string{pool, other} {
+		if err := os.WriteFile(p, []byte("pool"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "link.enc")
+	if err := os.Symlink(pool, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		journal, current string
+		want             bool
+	}{
+		{"", pool, true},
+		{pool, pool, true},
+		{pool, link, true},
+		{pool, filepath.Join(dir, ".", "mac_pool.enc"), true},
+		{pool, other, false},
+		{filepath.Join(dir, "gone.enc"), pool, false},
+	}
+	for _, tt := range tests {
+		if got := samePoolFile(tt.journal, tt.current); got != tt.want {
+			t.Errorf("samePoolFile(%q, %q) = %v, want %v", tt.journal, tt.current, got, tt.want)
+		}
+	}
+}
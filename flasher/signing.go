@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// moduleSignatureMarker - строка, которой заканчивается подписанный модуль ядра
+const moduleSignatureMarker = "~Module signature appended~\n"
+
+// moduleSignatureInfoSize - размер структуры module_signature перед маркером подписи
+const moduleSignatureInfoSize = 12
+
+// Параметры подписи модулей, задаются флагами -sign-key, -sign-cert и -sign-hash
+var (
+	signKeyPath  string
+	signCertPath string
+	signHashAlgo string
+)
+
+// errModuleSignature - ядро отказалось загружать модуль из-за подписи
+var errModuleSignature = errors.New("the kernel rejected the module because it is not signed with a trusted key")
+
+// signingConfigured проверяет, заданы ли ключ и сертификат для подписи модулей
+func signingConfigured() bool {
+	return signKeyPath != "" && signCertPath != ""
+}
+
+// isModuleSigned проверяет, есть ли в модуле подпись
+func isModuleSigned(modulePath string) bool {
+	data, err := os.ReadFile(modulePath)
+	if err != nil {
+		return false
+	}
+	return bytes.HasSuffix(data, []byte(moduleSignatureMarker))
+}
+
+// stripModuleSignature возвращает содержимое модуля без подписи
+func stripModuleSignature(data []byte) ([]byte, error) {
+	if !bytes.HasSuffix(data, []byte(moduleSignatureMarker)) {
+		return data, nil
+	}
+	end := len(data) - len(moduleSignatureMarker)
+	if end < moduleSignatureInfoSize {
+		return nil, errors.New("truncated module signature")
+	}
+	// Длина подписи хранится в последних 4 байтах module_signature (big-endian)
+	sigLen := int(binary.BigEndian.Uint32(data[end-4 : end]))
+	start := end - moduleSignatureInfoSize - sigLen
+	if start < 0 {
+		return nil, errors.New("invalid module signature length")
+	}
+	return data[:start], nil
+}
+
+// findSignFile ищет утилиту sign-file из заголовков ядра, а при её отсутствии - kmodsign
+func findSignFile(kernel string) (string, error) {
+	candidates := []string{
+		filepath.Join("/lib/modules", kernel, "build", "scripts", "sign-file"),
+		filepath.Join("/usr/src", "linux-headers-"+kernel, "scripts", "sign-file"),
+		filepath.Join("/usr/src", "kernels", kernel, "scripts", "sign-file"),
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	if path, err := exec.LookPath("kmodsign"); err == nil {
+		return path, nil
+	}
+	return "", fmt.Errorf("sign-file not found for kernel %s (install kernel headers or kmodsign)", kernel)
+}
+
+// signerFingerprint возвращает SHA-256 сертификата подписи, по нему определяется,
+// каким ключом подписан модуль в кэше
+func signerFingerprint() (string, error) {
+	data, err := os.ReadFile(signCertPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read signing certificate: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ensureModuleSigned подписывает модуль настроенным ключом, если подпись включена.
+// Модуль, подписанный другим сертификатом, переподписывается
+func ensureModuleSigned(modulePath, kernel string) error {
+	if !signingConfigured() {
+		return nil
+	}
+
+	fingerprint, err := signerFingerprint()
+	if err != nil {
+		return err
+	}
+	signerFile := modulePath + ".signer"
+	if isModuleSigned(modulePath) {
+		if recorded, err := os.ReadFile(signerFile); err == nil && strings.TrimSpace(string(recorded)) == fingerprint {
+			return nil
+		}
+	}
+
+	// Утилиту и ключ ищем до того, как снимать старую подпись: без них модуль остался бы неподписанным
+	signFile, err := findSignFile(kernel)
+	if err != nil {
+		return err
+	}
+	// sign-file принимает и ключ в токене PKCS#11, такой ключ не является файлом
+	if !strings.HasPrefix(signKeyPath, "pkcs11:") {
+		if _, err := os.ReadFile(signKeyPath); err != nil {
+			return fmt.Errorf("failed to read signing key: %v", err)
+		}
+	}
+	hashAlgo := signHashAlgo
+	if hashAlgo == "" {
+		hashAlgo = "sha256"
+	}
+
+	data, err := os.ReadFile(modulePath)
+	if err != nil {
+		return err
+	}
+	unsigned, err := stripModuleSignature(data)
+	if err != nil {
+		return fmt.Errorf("failed to remove old signature from %s: %v", modulePath, err)
+	}
+	if err := os.WriteFile(modulePath, unsigned, 0644); err != nil {
+		return err
+	}
+
+	// При неудачной подписи возвращаем модуль в прежнем виде
+	fmt.Printf("[INFO] Signing module %s with %s\n", modulePath, signCertPath)
+	if output, err := runCommand(signFile, hashAlgo, signKeyPath, signCertPath, modulePath); err != nil {
+		_ = os.WriteFile(modulePath, data, 0644)
+		return fmt.Errorf("module signing failed: %v: %s", err, output)
+	}
+	if !isModuleSigned(modulePath) {
+		_ = os.WriteFile(modulePath, data, 0644)
+		return fmt.Errorf("%s did not append a signature to %s", filepath.Base(signFile), modulePath)
+	}
+
+	return os.WriteFile(signerFile, []byte(fingerprint+"\n"), 0644)
+}
+
+// isSignatureRejection проверяет, вызвана ли ошибка insmod проверкой подписи модуля
+func isSignatureRejection(output string) bool {
+	output = strings.ToLower(output)
+	for _, marker := range []string{
+		"key was rejected by service",
+		"required key not available",
+		"module verification failed",
+		"lockdown",
+	} {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureGuidance возвращает подсказку, как добиться загрузки модуля при включённом Secure Boot
+func signatureGuidance() string {
+	var b strings.Builder
+	if !signingConfigured() {
+		b.WriteString("Secure Boot or kernel lockdown requires signed modules. Create a signing key and certificate,\n")
+		b.WriteString("then run the flasher with -sign-key <key.pem> -sign-cert <cert.der>.\n")
+	} else {
+		b.WriteString("The module was signed with " + signCertPath + ", but the kernel does not trust this certificate.\n")
+	}
+	b.WriteString("To enroll the certificate as a Machine Owner Key (MOK):\n")
+	b.WriteString("  1. mokutil --import <cert.der> and choose a one-time password\n")
+	b.WriteString("  2. Reboot and select 'Enroll MOK' in the MOK manager, then enter the password\n")
+	b.WriteString("  3. Check with mokutil --test-key <cert.der> and run the flasher again")
+	return b.String()
+}
+
+// certificateEnrolled проверяет через mokutil, зарегистрирован ли сертификат подписи.
+// Возвращает ошибку, если проверить не удалось
+func certificateEnrolled() (bool, error) {
+	if _, err := exec.LookPath("mokutil"); err != nil {
+		return false, errors.New("mokutil is not installed")
+	}
+	output, _ := runCommand("mokutil", "--test-key", signCertPath)
+	if strings.Contains(output, "already enrolled") {
+		return true, nil
+	}
+	if strings.Contains(output, "not enrolled") {
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected mokutil output: %s", output)
+}
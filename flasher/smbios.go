@@ -0,0 +1,424 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Типы структур SMBIOS, для которых есть типизированные записи
+const (
+	smbiosTypeBIOS         = 0
+	smbiosTypeSystem       = 1
+	smbiosTypeBaseboard    = 2
+	smbiosTypeChassis      = 3
+	smbiosTypeProcessor    = 4
+	smbiosTypeMemoryDevice = 17
+	smbiosTypeInactive     = 126
+	smbiosTypeEndOfTable   = 127
+)
+
+// SMBIOSInfo - данные SMBIOS платы в виде типизированных записей
+type SMBIOSInfo struct {
+	Version       string            `json:"smbios_version,omitempty"`
+	BIOS          *BIOSRecord       `json:"bios,omitempty"`
+	System        *SystemRecord     `json:"system,omitempty"`
+	Baseboards    []BaseboardRecord `json:"baseboards,omitempty"`
+	Chassis       []ChassisRecord   `json:"chassis,omitempty"`
+	Processors    []ProcessorRecord `json:"processors,omitempty"`
+	Memory        []MemoryDevice    `json:"memory,omitempty"`
+	MemoryTotalMB int               `json:"memory_total_mb,omitempty"`
+	Other         []DMIStructure    `json:"other,omitempty"` // структуры остальных типов без разбора по полям
+}
+
+// BIOSRecord - BIOS Information (тип 0)
+type BIOSRecord struct {
+	Handle           string   `json:"handle"`
+	Vendor           string   `json:"vendor,omitempty"`
+	Version          string   `json:"version,omitempty"`
+	ReleaseDate      string   `json:"release_date,omitempty"`
+	Revision         string   `json:"revision,omitempty"`
+	FirmwareRevision string   `json:"firmware_revision,omitempty"`
+	ROMSize          string   `json:"rom_size,omitempty"`
+	Characteristics  []string `json:"characteristics,omitempty"`
+}
+
+// SystemRecord - System Information (тип 1)
+type SystemRecord struct {
+	Handle       string `json:"handle"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	ProductName  string `json:"product_name,omitempty"`
+	Version      string `json:"version,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+	WakeUpType   string `json:"wake_up_type,omitempty"`
+	SKU          string `json:"sku,omitempty"`
+	Family       string `json:"family,omitempty"`
+}
+
+// BaseboardRecord - Base Board Information (тип 2), плат может быть несколько
+type BaseboardRecord struct {
+	Handle            string   `json:"handle"`
+	Manufacturer      string   `json:"manufacturer,omitempty"`
+	ProductName       string   `json:"product_name,omitempty"`
+	Version           string   `json:"version,omitempty"`
+	SerialNumber      string   `json:"serial_number,omitempty"`
+	AssetTag          string   `json:"asset_tag,omitempty"`
+	Type              string   `json:"type,omitempty"`
+	LocationInChassis string   `json:"location_in_chassis,omitempty"`
+	Features          []string `json:"features,omitempty"`
+}
+
+// ChassisRecord - Chassis Information (тип 3)
+type ChassisRecord struct {
+	Handle           string `json:"handle"`
+	Manufacturer     string `json:"manufacturer,omitempty"`
+	Type             string `json:"type,omitempty"`
+	Version          string `json:"version,omitempty"`
+	SerialNumber     string `json:"serial_number,omitempty"`
+	AssetTag         string `json:"asset_tag,omitempty"`
+	BootUpState      string `json:"boot_up_state,omitempty"`
+	PowerSupplyState string `json:"power_supply_state,omitempty"`
+	ThermalState     string `json:"thermal_state,omitempty"`
+	SecurityStatus   string `json:"security_status,omitempty"`
+	SKU              string `json:"sku,omitempty"`
+}
+
+// ProcessorRecord - Processor Information (тип 4)
+type ProcessorRecord struct {
+	Handle            string   `json:"handle"`
+	SocketDesignation string   `json:"socket_designation,omitempty"`
+	Type              string   `json:"type,omitempty"`
+	Family            string   `json:"family,omitempty"`
+	Manufacturer      string   `json:"manufacturer,omitempty"`
+	ID                string   `json:"id,omitempty"`
+	Signature         string   `json:"signature,omitempty"`
+	Version           string   `json:"version,omitempty"`
+	Voltage           string   `json:"voltage,omitempty"`
+	MaxSpeedMHz       int      `json:"max_speed_mhz,omitempty"`
+	CurrentSpeedMHz   int      `json:"current_speed_mhz,omitempty"`
+	Status            string   `json:"status,omitempty"`
+	Upgrade           string   `json:"upgrade,omitempty"`
+	SerialNumber      string   `json:"serial_number,omitempty"`
+	PartNumber        string   `json:"part_number,omitempty"`
+	CoreCount         int      `json:"core_count,omitempty"`
+	CoreEnabled       int      `json:"core_enabled,omitempty"`
+	ThreadCount       int      `json:"thread_count,omitempty"`
+	Flags             []string `json:"flags,omitempty"`
+	Characteristics   []string `json:"characteristics,omitempty"`
+}
+
+// MemoryDevice - Memory Device (тип 17), включая пустые слоты
+type MemoryDevice struct {
+	Handle             string `json:"handle"`
+	Locator            string `json:"locator,omitempty"`
+	BankLocator        string `json:"bank_locator,omitempty"`
+	Populated          bool   `json:"populated"`
+	SizeMB             int    `json:"size_mb,omitempty"`
+	FormFactor         string `json:"form_factor,omitempty"`
+	Type               string `json:"type,omitempty"`
+	TypeDetail         string `json:"type_detail,omitempty"`
+	SpeedMTs           int    `json:"speed_mts,omitempty"`
+	ConfiguredSpeedMTs int    `json:"configured_speed_mts,omitempty"`
+	Manufacturer       string `json:"manufacturer,omitempty"`
+	SerialNumber       string `json:"serial_number,omitempty"`
+	PartNumber         string `json:"part_number,omitempty"`
+	Rank               string `json:"rank,omitempty"`
+}
+
+// DMIStructure - одна структура из вывода dmidecode. Значения-списки (Characteristics, Flags и т.п.)
+// хранятся отдельно от простых полей, чтобы не терять строки
+type DMIStructure struct {
+	Handle string              `json:"handle"`
+	Type   int                 `json:"type"`
+	Name   string              `json:"name"`
+	Fields map[string]string   `json:"fields,omitempty"`
+	Lists  map[string][]string `json:"lists,omitempty"`
+}
+
+// field возвращает значение простого поля структуры
+func (s *DMIStructure) field(key string) string {
+	return s.Fields[key]
+}
+
+var (
+	dmiHandleRegexp  = regexp.MustCompile(`^Handle (0x[0-9A-Fa-f]+), DMI type (\d+)`)
+	dmiVersionRegexp = regexp.MustCompile(`^SMBIOS (\d+\.\d+(?:\.\d+)?) present`)
+)
+
+// indentWidth возвращает ширину отступа строки, табуляция считается за 8 пробелов
+func indentWidth(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case '\t':
+			width += 8
+		case ' ':
+			width++
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// parseDmidecode разбирает вывод dmidecode на структуры. Возвращает версию SMBIOS и структуры в порядке вывода
+func parseDmidecode(output string) (string, []DMIStructure) {
+	var (
+		version     string
+		structures  []DMIStructure
+		current     = -1 // индекс разбираемой структуры
+		expectName  bool
+		listKey     string
+		fieldIndent int
+	)
+
+	for _, rawLine := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(rawLine)
+		if line == "" {
+			continue
+		}
+		indent := indentWidth(rawLine)
+
+		if indent == 0 {
+			if m := dmiHandleRegexp.FindStringSubmatch(line); m != nil {
+				structType, _ := strconv.Atoi(m[2])
+				structures = append(structures, DMIStructure{
+					Handle: strings.ToLower(m[1]),
+					Type:   structType,
+					Fields: make(map[string]string),
+					Lists:  make(map[string][]string),
+				})
+				current = len(structures) - 1
+				expectName, listKey, fieldIndent = true, "", 0
+				continue
+			}
+			if m := dmiVersionRegexp.FindStringSubmatch(line); m != nil {
+				version = m[1]
+				continue
+			}
+			if current >= 0 && expectName {
+				structures[current].Name = line
+				expectName = false
+			}
+			continue
+		}
+		if current < 0 {
+			continue
+		}
+		expectName = false
+		s := &structures[current]
+
+		// Строки глубже уровня полей - элементы списка последнего поля без значения
+		if listKey != "" && indent > fieldIndent {
+			s.Lists[listKey] = append(s.Lists[listKey], line)
+			continue
+		}
+
+		fieldIndent = indent
+		listKey = ""
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if value == "" {
+			listKey = key
+			s.Lists[key] = []string{}
+			continue
+		}
+		// Повторяющиеся поля внутри одной структуры не перезаписывают первое значение
+		if _, exists := s.Fields[key]; !exists {
+			s.Fields[key] = value
+		}
+	}
+
+	return version, structures
+}
+
+// parseSMBIOS разбирает вывод dmidecode в типизированную модель
+func parseSMBIOS(output string) *SMBIOSInfo {
+	version, structures := parseDmidecode(output)
+	return buildSMBIOSInfo(version, structures)
+}
+
+// buildSMBIOSInfo раскладывает структуры по типизированным записям
+func buildSMBIOSInfo(version string, structures []DMIStructure) *SMBIOSInfo {
+	info := &SMBIOSInfo{Version: version}
+
+	for i := range structures {
+		s := &structures[i]
+		switch s.Type {
+		case smbiosTypeBIOS:
+			if info.BIOS != nil {
+				info.Other = append(info.Other, *s)
+				continue
+			}
+			info.BIOS = &BIOSRecord{
+				Handle:           s.Handle,
+				Vendor:           s.field("Vendor"),
+				Version:          s.field("Version"),
+				ReleaseDate:      s.field("Release Date"),
+				Revision:         s.field("BIOS Revision"),
+				FirmwareRevision: s.field("Firmware Revision"),
+				ROMSize:          s.field("ROM Size"),
+				Characteristics:  s.Lists["Characteristics"],
+			}
+		case smbiosTypeSystem:
+			if info.System != nil {
+				info.Other = append(info.Other, *s)
+				continue
+			}
+			info.System = &SystemRecord{
+				Handle:       s.Handle,
+				Manufacturer: s.field("Manufacturer"),
+				ProductName:  s.field("Product Name"),
+				Version:      s.field("Version"),
+				SerialNumber: s.field("Serial Number"),
+				UUID:         strings.ToLower(s.field("UUID")),
+				WakeUpType:   s.field("Wake-up Type"),
+				SKU:          s.field("SKU Number"),
+				Family:       s.field("Family"),
+			}
+		case smbiosTypeBaseboard:
+			info.Baseboards = append(info.Baseboards, BaseboardRecord{
+				Handle:            s.Handle,
+				Manufacturer:      s.field("Manufacturer"),
+				ProductName:       s.field("Product Name"),
+				Version:           s.field("Version"),
+				SerialNumber:      s.field("Serial Number"),
+				AssetTag:          s.field("Asset Tag"),
+				Type:              s.field("Type"),
+				LocationInChassis: s.field("Location In Chassis"),
+				Features:          s.Lists["Features"],
+			})
+		case smbiosTypeChassis:
+			info.Chassis = append(info.Chassis, ChassisRecord{
+				Handle:           s.Handle,
+				Manufacturer:     s.field("Manufacturer"),
+				Type:             s.field("Type"),
+				Version:          s.field("Version"),
+				SerialNumber:     s.field("Serial Number"),
+				AssetTag:         s.field("Asset Tag"),
+				BootUpState:      s.field("Boot-up State"),
+				PowerSupplyState: s.field("Power Supply State"),
+				ThermalState:     s.field("Thermal State"),
+				SecurityStatus:   s.field("Security Status"),
+				SKU:              s.field("SKU Number"),
+			})
+		case smbiosTypeProcessor:
+			info.Processors = append(info.Processors, ProcessorRecord{
+				Handle:            s.Handle,
+				SocketDesignation: s.field("Socket Designation"),
+				Type:              s.field("Type"),
+				Family:            s.field("Family"),
+				Manufacturer:      s.field("Manufacturer"),
+				ID:                s.field("ID"),
+				Signature:         s.field("Signature"),
+				Version:           s.field("Version"),
+				Voltage:           s.field("Voltage"),
+				MaxSpeedMHz:       parseDMINumber(s.field("Max Speed")),
+				CurrentSpeedMHz:   parseDMINumber(s.field("Current Speed")),
+				Status:            s.field("Status"),
+				Upgrade:           s.field("Upgrade"),
+				SerialNumber:      s.field("Serial Number"),
+				PartNumber:        s.field("Part Number"),
+				CoreCount:         parseDMINumber(s.field("Core Count")),
+				CoreEnabled:       parseDMINumber(s.field("Core Enabled")),
+				ThreadCount:       parseDMINumber(s.field("Thread Count")),
+				Flags:             s.Lists["Flags"],
+				Characteristics:   s.Lists["Characteristics"],
+			})
+		case smbiosTypeMemoryDevice:
+			sizeMB := parseDMISizeMB(s.field("Size"))
+			info.Memory = append(info.Memory, MemoryDevice{
+				Handle:             s.Handle,
+				Locator:            s.field("Locator"),
+				BankLocator:        s.field("Bank Locator"),
+				Populated:          sizeMB > 0,
+				SizeMB:             sizeMB,
+				FormFactor:         s.field("Form Factor"),
+				Type:               s.field("Type"),
+				TypeDetail:         s.field("Type Detail"),
+				SpeedMTs:           parseDMINumber(s.field("Speed")),
+				ConfiguredSpeedMTs: parseDMINumber(firstNonEmpty(s.field("Configured Memory Speed"), s.field("Configured Clock Speed"))),
+				Manufacturer:       s.field("Manufacturer"),
+				SerialNumber:       s.field("Serial Number"),
+				PartNumber:         s.field("Part Number"),
+				Rank:               s.field("Rank"),
+			})
+			info.MemoryTotalMB += sizeMB
+		case smbiosTypeInactive, smbiosTypeEndOfTable:
+		default:
+			info.Other = append(info.Other, *s)
+		}
+	}
+	return info
+}
+
+// parseDMINumber извлекает число из значения вида "3600 MHz" или "8"; для "Unknown" возвращает 0
+func parseDMINumber(value string) int {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseDMISizeMB переводит размер модуля памяти ("16 GB", "8192 MB") в мегабайты.
+// Пустой слот ("No Module Installed") даёт 0
+func parseDMISizeMB(value string) int {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return 0
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0
+	}
+	switch strings.ToUpper(fields[1]) {
+	case "KB":
+		return n / 1024
+	case "MB":
+		return n
+	case "GB":
+		return n * 1024
+	case "TB":
+		return n * 1024 * 1024
+	}
+	return 0
+}
+
+// firstNonEmpty возвращает первое непустое значение
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// dmiInfoFromSMBIOS извлекает из модели SMBIOS поля, используемые правилами пула и привязкой адресов
+func dmiInfoFromSMBIOS(smbios *SMBIOSInfo) DMIInfo {
+	var info DMIInfo
+	if smbios.System != nil {
+		info.SystemManufacturer = smbios.System.Manufacturer
+		info.ProductName = smbios.System.ProductName
+		info.SKU = smbios.System.SKU
+		info.SystemSerial = smbios.System.SerialNumber
+		info.SystemUUID = smbios.System.UUID
+	}
+	if len(smbios.Baseboards) > 0 {
+		board := smbios.Baseboards[0]
+		info.BaseboardManufacturer = board.Manufacturer
+		info.BaseboardProduct = board.ProductName
+		info.BoardSerial = board.SerialNumber
+	}
+	return info
+}
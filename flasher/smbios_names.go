@@ -0,0 +1,391 @@
+package main
+
+// Названия значений полей SMBIOS по спецификации DMTF DSP0134, в написании dmidecode
+
+// Типы структур со строками без форматированных полей
+const (
+	smbiosTypeOEMStrings    = 11
+	smbiosTypeConfigOptions = 12
+)
+
+// smbiosTypeNames - названия структур, которые сохраняются без разбора по полям
+var smbiosTypeNames = map[int]string{
+	5:  "Memory Controller Information",
+	6:  "Memory Module Information",
+	7:  "Cache Information",
+	8:  "Port Connector Information",
+	9:  "System Slot Information",
+	10: "On Board Device Information",
+	11: "OEM Strings",
+	12: "System Configuration Options",
+	13: "BIOS Language Information",
+	14: "Group Associations",
+	15: "System Event Log",
+	16: "Physical Memory Array",
+	18: "32-bit Memory Error Information",
+	19: "Memory Array Mapped Address",
+	20: "Memory Device Mapped Address",
+	21: "Built-in Pointing Device",
+	22: "Portable Battery",
+	23: "System Reset",
+	24: "Hardware Security",
+	25: "System Power Controls",
+	26: "Voltage Probe",
+	27: "Cooling Device",
+	28: "Temperature Probe",
+	29: "Electrical Current Probe",
+	30: "Out-of-band Remote Access",
+	31: "Boot Integrity Services Entry Point",
+	32: "System Boot Information",
+	33: "64-bit Memory Error Information",
+	34: "Management Device",
+	35: "Management Device Component",
+	36: "Management Device Threshold Data",
+	37: "Memory Channel",
+	38: "IPMI Device Information",
+	39: "System Power Supply",
+	40: "Additional Information",
+	41: "Onboard Device",
+	42: "Management Controller Host Interface",
+	43: "TPM Device",
+	44: "Processor Additional Information",
+	45: "Firmware Inventory Information",
+	46: "String Property",
+}
+
+// biosCharacteristics - биты BIOS Characteristics (смещение 0x0A)
+var biosCharacteristics = map[int]string{
+	4:  "ISA is supported",
+	5:  "MCA is supported",
+	6:  "EISA is supported",
+	7:  "PCI is supported",
+	8:  "PC Card (PCMCIA) is supported",
+	9:  "PNP is supported",
+	10: "APM is supported",
+	11: "BIOS is upgradeable",
+	12: "BIOS shadowing is allowed",
+	13: "VLB is supported",
+	14: "ESCD support is available",
+	15: "Boot from CD is supported",
+	16: "Selectable boot is supported",
+	17: "BIOS ROM is socketed",
+	18: "Boot from PC Card (PCMCIA) is supported",
+	19: "EDD is supported",
+	20: "Japanese floppy for NEC 9800 1.2 MB is supported (int 13h)",
+	21: "Japanese floppy for Toshiba 1.2 MB is supported (int 13h)",
+	22: "5.25\"/360 kB floppy services are supported (int 13h)",
+	23: "5.25\"/1.2 MB floppy services are supported (int 13h)",
+	24: "3.5\"/720 kB floppy services are supported (int 13h)",
+	25: "3.5\"/2.88 MB floppy services are supported (int 13h)",
+	26: "Print screen service is supported (int 5h)",
+	27: "8042 keyboard services are supported (int 9h)",
+	28: "Serial services are supported (int 14h)",
+	29: "Printer services are supported (int 17h)",
+	30: "CGA/mono video services are supported (int 10h)",
+	31: "NEC PC-98",
+}
+
+// biosCharacteristicsExt1 - биты первого байта расширенных характеристик (смещение 0x12)
+var biosCharacteristicsExt1 = map[int]string{
+	0: "ACPI is supported",
+	1: "USB legacy is supported",
+	2: "AGP is supported",
+	3: "I2O boot is supported",
+	4: "LS-120 boot is supported",
+	5: "ATAPI Zip drive boot is supported",
+	6: "IEEE 1394 boot is supported",
+	7: "Smart battery is supported",
+}
+
+// biosCharacteristicsExt2 - биты второго байта расширенных характеристик (смещение 0x13)
+var biosCharacteristicsExt2 = map[int]string{
+	0: "BIOS boot specification is supported",
+	1: "Function key-initiated network boot is supported",
+	2: "Targeted content distribution is supported",
+	3: "UEFI is supported",
+	4: "System is a virtual machine",
+	5: "Manufacturing mode is supported",
+	6: "Manufacturing mode is enabled",
+}
+
+// wakeUpTypes - значения System Wake-up Type
+var wakeUpTypes = map[int]string{
+	0: "Reserved",
+	1: "Other",
+	2: "Unknown",
+	3: "APM Timer",
+	4: "Modem Ring",
+	5: "LAN Remote",
+	6: "Power Switch",
+	7: "PCI PME#",
+	8: "AC Power Restored",
+}
+
+// baseboardFeatures - биты Base Board Feature Flags
+var baseboardFeatures = map[int]string{
+	0: "Board is a hosting board",
+	1: "Board requires at least one daughter board",
+	2: "Board is removable",
+	3: "Board is replaceable",
+	4: "Board is hot swappable",
+}
+
+// baseboardTypes - значения Base Board Type
+var baseboardTypes = map[int]string{
+	0x01: "Unknown",
+	0x02: "Other",
+	0x03: "Server Blade",
+	0x04: "Connectivity Switch",
+	0x05: "System Management Module",
+	0x06: "Processor Module",
+	0x07: "I/O Module",
+	0x08: "Memory Module",
+	0x09: "Daughter Board",
+	0x0A: "Motherboard",
+	0x0B: "Processor+Memory Module",
+	0x0C: "Processor+I/O Module",
+	0x0D: "Interconnect Board",
+}
+
+// chassisTypes - значения Chassis Type
+var chassisTypes = map[int]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "Desktop",
+	0x04: "Low Profile Desktop",
+	0x05: "Pizza Box",
+	0x06: "Mini Tower",
+	0x07: "Tower",
+	0x08: "Portable",
+	0x09: "Laptop",
+	0x0A: "Notebook",
+	0x0B: "Hand Held",
+	0x0C: "Docking Station",
+	0x0D: "All In One",
+	0x0E: "Sub Notebook",
+	0x0F: "Space-saving",
+	0x10: "Lunch Box",
+	0x11: "Main Server Chassis",
+	0x12: "Expansion Chassis",
+	0x13: "Sub Chassis",
+	0x14: "Bus Expansion Chassis",
+	0x15: "Peripheral Chassis",
+	0x16: "RAID Chassis",
+	0x17: "Rack Mount Chassis",
+	0x18: "Sealed-case PC",
+	0x19: "Multi-system",
+	0x1A: "CompactPCI",
+	0x1B: "AdvancedTCA",
+	0x1C: "Blade",
+	0x1D: "Blade Enclosing",
+	0x1E: "Tablet",
+	0x1F: "Convertible",
+	0x20: "Detachable",
+	0x21: "IoT Gateway",
+	0x22: "Embedded PC",
+	0x23: "Mini PC",
+	0x24: "Stick PC",
+}
+
+// chassisStates - значения состояний корпуса (загрузка, питание, температура)
+var chassisStates = map[int]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "Safe",
+	0x04: "Warning",
+	0x05: "Critical",
+	0x06: "Non-recoverable",
+}
+
+// chassisSecurity - значения Chassis Security Status
+var chassisSecurity = map[int]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "None",
+	0x04: "External Interface Locked Out",
+	0x05: "External Interface Enabled",
+}
+
+// processorTypes - значения Processor Type
+var processorTypes = map[int]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "Central Processor",
+	0x04: "Math Processor",
+	0x05: "DSP Processor",
+	0x06: "Video Processor",
+}
+
+// processorFamilies - распространённые значения Processor Family. Коды больше 0xFF
+// берутся из поля Processor Family 2
+var processorFamilies = map[int]string{
+	0x01:  "Other",
+	0x02:  "Unknown",
+	0x0B:  "Pentium",
+	0x0C:  "Pentium Pro",
+	0x0D:  "Pentium II",
+	0x0E:  "Pentium MMX",
+	0x0F:  "Celeron",
+	0x10:  "Pentium II Xeon",
+	0x11:  "Pentium III",
+	0x14:  "Celeron M",
+	0x15:  "Pentium 4 HT",
+	0x28:  "Core Duo",
+	0x29:  "Core Duo Mobile",
+	0x2A:  "Core Solo Mobile",
+	0x2B:  "Atom",
+	0x2C:  "Core M",
+	0x2D:  "Core m3",
+	0x2E:  "Core m5",
+	0x2F:  "Core m7",
+	0x6B:  "Zen",
+	0xB3:  "Xeon",
+	0xBF:  "Core 2 Duo",
+	0xC6:  "Core i7",
+	0xCD:  "Core i5",
+	0xCE:  "Core i3",
+	0xCF:  "Core i9",
+	0x100: "ARMv7",
+	0x101: "ARMv8",
+	0x118: "ARM",
+	0x200: "RISC-V RV32",
+	0x201: "RISC-V RV64",
+	0x202: "RISC-V RV128",
+}
+
+// processorFlags - биты EDX из CPUID(1), которые dmidecode выводит как Flags
+var processorFlags = map[int]string{
+	0:  "FPU (Floating-point unit on-chip)",
+	1:  "VME (Virtual mode extension)",
+	2:  "DE (Debugging extension)",
+	3:  "PSE (Page size extension)",
+	4:  "TSC (Time stamp counter)",
+	5:  "MSR (Model specific registers)",
+	6:  "PAE (Physical address extension)",
+	7:  "MCE (Machine check exception)",
+	8:  "CX8 (CMPXCHG8 instruction supported)",
+	9:  "APIC (On-chip APIC hardware supported)",
+	11: "SEP (Fast system call)",
+	12: "MTRR (Memory type range registers)",
+	13: "PGE (Page global enable)",
+	14: "MCA (Machine check architecture)",
+	15: "CMOV (Conditional move instruction supported)",
+	16: "PAT (Page attribute table)",
+	17: "PSE-36 (36-bit page size extension)",
+	18: "PSN (Processor serial number present and enabled)",
+	19: "CLFSH (CLFLUSH instruction supported)",
+	21: "DS (Debug store)",
+	22: "ACPI (ACPI supported)",
+	23: "MMX (MMX technology supported)",
+	24: "FXSR (FXSAVE and FXSTOR instructions supported)",
+	25: "SSE (Streaming SIMD extensions)",
+	26: "SSE2 (Streaming SIMD extensions 2)",
+	27: "SS (Self-snoop)",
+	28: "HTT (Multi-threading)",
+	29: "TM (Thermal monitor supported)",
+	31: "PBE (Pending break enabled)",
+}
+
+// legacyVoltages - биты напряжения процессора в старом формате
+var legacyVoltages = map[int]string{
+	0: "5.0 V",
+	1: "3.3 V",
+	2: "2.9 V",
+}
+
+// processorStatuses - значения состояния процессора в поле Status
+var processorStatuses = map[int]string{
+	0: "Unknown",
+	1: "Enabled",
+	2: "Disabled By User",
+	3: "Disabled By BIOS",
+	4: "Idle",
+	7: "Other",
+}
+
+// processorCharacteristics - биты Processor Characteristics
+var processorCharacteristics = map[int]string{
+	2: "64-bit capable",
+	3: "Multi-Core",
+	4: "Hardware Thread",
+	5: "Execute Protection",
+	6: "Enhanced Virtualization",
+	7: "Power/Performance Control",
+	8: "128-bit Capable",
+	9: "Arm64 SoC ID",
+}
+
+// memoryFormFactors - значения Memory Device Form Factor
+var memoryFormFactors = map[int]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "SIMM",
+	0x04: "SIP",
+	0x05: "Chip",
+	0x06: "DIP",
+	0x07: "ZIP",
+	0x08: "Proprietary Card",
+	0x09: "DIMM",
+	0x0A: "TSOP",
+	0x0B: "Row Of Chips",
+	0x0C: "RIMM",
+	0x0D: "SODIMM",
+	0x0E: "SRIMM",
+	0x0F: "FB-DIMM",
+	0x10: "Die",
+}
+
+// memoryTypes - значения Memory Device Type
+var memoryTypes = map[int]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "DRAM",
+	0x04: "EDRAM",
+	0x05: "VRAM",
+	0x06: "SRAM",
+	0x07: "RAM",
+	0x08: "ROM",
+	0x09: "Flash",
+	0x0A: "EEPROM",
+	0x0B: "FEPROM",
+	0x0C: "EPROM",
+	0x0D: "CDRAM",
+	0x0E: "3DRAM",
+	0x0F: "SDRAM",
+	0x10: "SGRAM",
+	0x11: "RDRAM",
+	0x12: "DDR",
+	0x13: "DDR2",
+	0x14: "DDR2 FB-DIMM",
+	0x18: "DDR3",
+	0x19: "FBD2",
+	0x1A: "DDR4",
+	0x1B: "LPDDR",
+	0x1C: "LPDDR2",
+	0x1D: "LPDDR3",
+	0x1E: "LPDDR4",
+	0x1F: "Logical non-volatile device",
+	0x20: "HBM",
+	0x21: "HBM2",
+	0x22: "DDR5",
+	0x23: "LPDDR5",
+}
+
+// memoryTypeDetails - биты Memory Device Type Detail
+var memoryTypeDetails = map[int]string{
+	1:  "Other",
+	2:  "Unknown",
+	3:  "Fast-paged",
+	4:  "Static Column",
+	5:  "Pseudo-static",
+	6:  "RAMBus",
+	7:  "Synchronous",
+	8:  "CMOS",
+	9:  "EDO",
+	10: "Window DRAM",
+	11: "Cache DRAM",
+	12: "Non-Volatile",
+	13: "Registered (Buffered)",
+	14: "Unbuffered (Unregistered)",
+	15: "LRDIMM",
+}
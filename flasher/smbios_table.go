@@ -0,0 +1,654 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Источники данных SMBIOS в sysfs
+const (
+	sysfsSMBIOSTables = "/sys/firmware/dmi/tables" // файлы smbios_entry_point и DMI
+	sysfsDMIID        = "/sys/class/dmi/id"
+)
+
+// smbiosEntryPoint - данные точки входа SMBIOS, нужные для разбора таблицы
+type smbiosEntryPoint struct {
+	Major, Minor, Revision int
+	TableAddress           uint64 // адрес таблицы; в файле dmidecode --dump-bin - смещение от начала файла
+	TableLength            uint32 // для SMBIOS 3 - максимальный размер таблицы
+}
+
+// version возвращает версию SMBIOS в том виде, в каком её печатает dmidecode
+func (ep smbiosEntryPoint) version() string {
+	if ep.Major >= 3 {
+		return fmt.Sprintf("%d.%d.%d", ep.Major, ep.Minor, ep.Revision)
+	}
+	return fmt.Sprintf("%d.%d", ep.Major, ep.Minor)
+}
+
+// atLeast проверяет, что версия SMBIOS не ниже указанной
+func (ep smbiosEntryPoint) atLeast(major, minor int) bool {
+	return ep.Major > major || (ep.Major == major && ep.Minor >= minor)
+}
+
+// checksumOK проверяет, что сумма байтов равна нулю
+func checksumOK(data []byte) bool {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum == 0
+}
+
+// parseSMBIOSEntryPoint разбирает точку входа SMBIOS 3 (_SM3_), 2.1 (_SM_) или устаревшую (_DMI_)
+func parseSMBIOSEntryPoint(data []byte) (smbiosEntryPoint, error) {
+	var ep smbiosEntryPoint
+
+	switch {
+	case bytes.HasPrefix(data, []byte("_SM3_")):
+		if len(data) < 0x18 || int(data[0x06]) > len(data) || !checksumOK(data[:data[0x06]]) {
+			return ep, errors.New("invalid SMBIOS 3 entry point")
+		}
+		ep.Major, ep.Minor, ep.Revision = int(data[0x07]), int(data[0x08]), int(data[0x09])
+		ep.TableLength = binary.LittleEndian.Uint32(data[0x0C:])
+		ep.TableAddress = binary.LittleEndian.Uint64(data[0x10:])
+
+	case bytes.HasPrefix(data, []byte("_SM_")):
+		if len(data) < 0x1F || int(data[0x05]) > len(data) || !checksumOK(data[:data[0x05]]) ||
+			!bytes.Equal(data[0x10:0x15], []byte("_DMI_")) || !checksumOK(data[0x10:0x1F]) {
+			return ep, errors.New("invalid SMBIOS 2 entry point")
+		}
+		ep.Major, ep.Minor = int(data[0x06]), int(data[0x07])
+		// Некоторые производители записывают 2.33 вместо 2.3 и 2.51 вместо 2.5
+		if ep.Major == 2 && ep.Minor == 33 {
+			ep.Minor = 3
+		} else if ep.Major == 2 && ep.Minor == 51 {
+			ep.Minor = 5
+		}
+		ep.TableLength = uint32(binary.LittleEndian.Uint16(data[0x16:]))
+		ep.TableAddress = uint64(binary.LittleEndian.Uint32(data[0x18:]))
+
+	case bytes.HasPrefix(data, []byte("_DMI_")):
+		if len(data) < 0x0F || !checksumOK(data[:0x0F]) {
+			return ep, errors.New("invalid legacy DMI entry point")
+		}
+		ep.Major, ep.Minor = int(data[0x0E]>>4), int(data[0x0E]&0x0F)
+		ep.TableLength = uint32(binary.LittleEndian.Uint16(data[0x06:]))
+		ep.TableAddress = uint64(binary.LittleEndian.Uint32(data[0x08:]))
+
+	default:
+		return ep, errors.New("no SMBIOS entry point anchor found")
+	}
+	return ep, nil
+}
+
+// isSMBIOSBinaryDump проверяет, что данные - дамп dmidecode --dump-bin, а не текстовый вывод
+func isSMBIOSBinaryDump(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("_SM3_")) || bytes.HasPrefix(data, []byte("_SM_")) || bytes.HasPrefix(data, []byte("_DMI_"))
+}
+
+// decodeSMBIOSDump разбирает файл dmidecode --dump-bin: точка входа в начале файла,
+// адрес таблицы в ней заменён смещением от начала файла
+func decodeSMBIOSDump(data []byte) (*SMBIOSInfo, error) {
+	ep, err := parseSMBIOSEntryPoint(data)
+	if err != nil {
+		return nil, err
+	}
+	if ep.TableAddress >= uint64(len(data)) {
+		return nil, fmt.Errorf("SMBIOS table offset %d is outside of the dump", ep.TableAddress)
+	}
+	table := data[ep.TableAddress:]
+	if uint64(len(table)) > uint64(ep.TableLength) {
+		table = table[:ep.TableLength]
+	}
+	structures, err := decodeSMBIOSTable(ep, table)
+	if err != nil {
+		return nil, err
+	}
+	return buildSMBIOSInfo(ep.version(), structures), nil
+}
+
+// readSMBIOSTables читает таблицы SMBIOS из каталога с файлами smbios_entry_point и DMI:
+// /sys/firmware/dmi/tables или его копии, снятой с другой системы
+func readSMBIOSTables(dir string) (*SMBIOSInfo, error) {
+	epData, err := os.ReadFile(filepath.Join(dir, "smbios_entry_point"))
+	if err != nil {
+		return nil, err
+	}
+	ep, err := parseSMBIOSEntryPoint(epData)
+	if err != nil {
+		return nil, err
+	}
+	table, err := os.ReadFile(filepath.Join(dir, "DMI"))
+	if err != nil {
+		return nil, err
+	}
+	structures, err := decodeSMBIOSTable(ep, table)
+	if err != nil {
+		return nil, err
+	}
+	return buildSMBIOSInfo(ep.version(), structures), nil
+}
+
+// decodeSMBIOSTable разбирает таблицу SMBIOS на структуры с полями в формате dmidecode,
+// чтобы текстовый вывод и таблица давали одинаковую модель. Обрезанная или повреждённая таблица
+// (структура выходит за конец, нет завершающей структуры) даёт ошибку
+func decodeSMBIOSTable(ep smbiosEntryPoint, table []byte) ([]DMIStructure, error) {
+	var structures []DMIStructure
+	ended := false
+
+	offset := 0
+	for offset < len(table) {
+		if offset+4 > len(table) {
+			return nil, fmt.Errorf("SMBIOS table truncated at offset %d", offset)
+		}
+		length := int(table[offset+1])
+		if length < 4 {
+			return nil, fmt.Errorf("invalid SMBIOS structure length %d at offset %d", length, offset)
+		}
+		if offset+length > len(table) {
+			return nil, fmt.Errorf("SMBIOS structure at offset %d is truncated", offset)
+		}
+		data := table[offset : offset+length]
+
+		// Строки структуры идут после форматированной части и заканчиваются двумя нулевыми байтами
+		end := offset + length
+		for end+1 < len(table) && (table[end] != 0 || table[end+1] != 0) {
+			end++
+		}
+		if end+1 >= len(table) {
+			return nil, fmt.Errorf("strings of SMBIOS structure at offset %d are not terminated", offset)
+		}
+		var strs []string
+		if end > offset+length {
+			for _, s := range bytes.Split(table[offset+length:end], []byte{0}) {
+				strs = append(strs, strings.TrimSpace(string(s)))
+			}
+		}
+
+		s := DMIStructure{
+			Handle: fmt.Sprintf("0x%04x", binary.LittleEndian.Uint16(data[2:])),
+			Type:   int(data[0]),
+			Fields: make(map[string]string),
+			Lists:  make(map[string][]string),
+		}
+		decodeSMBIOSStructure(ep, &s, smbiosRecord{data: data, strings: strs})
+		structures = append(structures, s)
+
+		offset = end + 2
+		if s.Type == smbiosTypeEndOfTable {
+			ended = true
+			break
+		}
+	}
+
+	// В SMBIOS 3 длина таблицы - лишь верхняя граница, конец отмечает только структура типа 127;
+	// в SMBIOS 2 таблица должна занимать ровно заявленную длину
+	if ep.Major >= 3 && !ended {
+		return nil, errors.New("SMBIOS table has no end-of-table structure")
+	}
+	if ep.Major < 3 && !ended && offset < int(ep.TableLength) {
+		return nil, fmt.Errorf("SMBIOS table is %d bytes, expected %d", offset, ep.TableLength)
+	}
+	return structures, nil
+}
+
+// smbiosRecord - форматированная часть структуры и её строки
+type smbiosRecord struct {
+	data    []byte
+	strings []string
+}
+
+// has проверяет, что форматированная часть содержит поле длиной size по смещению off
+func (r smbiosRecord) has(off, size int) bool {
+	return off+size <= len(r.data)
+}
+
+func (r smbiosRecord) byte(off int) byte {
+	return r.data[off]
+}
+
+func (r smbiosRecord) word(off int) uint16 {
+	return binary.LittleEndian.Uint16(r.data[off:])
+}
+
+func (r smbiosRecord) dword(off int) uint32 {
+	return binary.LittleEndian.Uint32(r.data[off:])
+}
+
+// str возвращает строку по номеру из байта по смещению off, как dmidecode
+func (r smbiosRecord) str(off int) string {
+	if !r.has(off, 1) {
+		return ""
+	}
+	index := int(r.data[off])
+	if index == 0 {
+		return "Not Specified"
+	}
+	if index > len(r.strings) {
+		return "<BAD INDEX>"
+	}
+	return r.strings[index-1]
+}
+
+// lookupName возвращает название значения из таблицы или его код, если значение неизвестно
+func lookupName(names map[int]string, value int) string {
+	if name, ok := names[value]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02X", value)
+}
+
+// bitNames возвращает названия установленных битов
+func bitNames(value uint64, names map[int]string) []string {
+	var result []string
+	for bit := 0; bit < 64; bit++ {
+		if value&(1<<bit) == 0 {
+			continue
+		}
+		if name, ok := names[bit]; ok {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// formatDMISize форматирует размер в наибольших единицах, на которые он делится без остатка
+func formatDMISize(kb uint64) string {
+	units := []string{"kB", "MB", "GB", "TB"}
+	i := 0
+	for i < len(units)-1 && kb >= 1024 && kb%1024 == 0 {
+		kb /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d %s", kb, units[i])
+}
+
+// speedOrUnknown форматирует скорость, ноль означает неизвестное значение
+func speedOrUnknown(value uint32, unit string) string {
+	if value == 0 {
+		return "Unknown"
+	}
+	return fmt.Sprintf("%d %s", value, unit)
+}
+
+// decodeSMBIOSStructure заполняет поля структуры по её типу
+func decodeSMBIOSStructure(ep smbiosEntryPoint, s *DMIStructure, r smbiosRecord) {
+	set := func(key, value string) {
+		if value != "" {
+			s.Fields[key] = value
+		}
+	}
+
+	switch s.Type {
+	case smbiosTypeBIOS:
+		s.Name = "BIOS Information"
+		if !r.has(0x12, 0) {
+			break
+		}
+		set("Vendor", r.str(0x04))
+		set("Version", r.str(0x05))
+		set("Release Date", r.str(0x08))
+		if r.byte(0x09) == 0xFF && r.has(0x18, 2) {
+			size := uint64(r.word(0x18) & 0x3FFF)
+			if r.word(0x18)>>14 == 1 {
+				size *= 1024
+			}
+			set("ROM Size", formatDMISize(size*1024))
+		} else {
+			set("ROM Size", formatDMISize(uint64(r.byte(0x09)+1)*64))
+		}
+		characteristics := r.dword(0x0A)
+		if characteristics&(1<<3) != 0 {
+			s.Lists["Characteristics"] = []string{"BIOS characteristics not supported"}
+		} else {
+			list := bitNames(uint64(characteristics), biosCharacteristics)
+			if r.has(0x12, 1) {
+				list = append(list, bitNames(uint64(r.byte(0x12)), biosCharacteristicsExt1)...)
+			}
+			if r.has(0x13, 1) {
+				list = append(list, bitNames(uint64(r.byte(0x13)), biosCharacteristicsExt2)...)
+			}
+			s.Lists["Characteristics"] = list
+		}
+		if r.has(0x14, 2) && r.byte(0x14) != 0xFF && r.byte(0x15) != 0xFF {
+			set("BIOS Revision", fmt.Sprintf("%d.%d", r.byte(0x14), r.byte(0x15)))
+		}
+		if r.has(0x16, 2) && r.byte(0x16) != 0xFF && r.byte(0x17) != 0xFF {
+			set("Firmware Revision", fmt.Sprintf("%d.%d", r.byte(0x16), r.byte(0x17)))
+		}
+
+	case smbiosTypeSystem:
+		s.Name = "System Information"
+		if !r.has(0x08, 0) {
+			break
+		}
+		set("Manufacturer", r.str(0x04))
+		set("Product Name", r.str(0x05))
+		set("Version", r.str(0x06))
+		set("Serial Number", r.str(0x07))
+		if r.has(0x08, 16) {
+			set("UUID", formatSMBIOSUUID(r.data[0x08:0x18], ep.atLeast(2, 6)))
+		}
+		if r.has(0x18, 1) {
+			set("Wake-up Type", lookupName(wakeUpTypes, int(r.byte(0x18))))
+		}
+		if r.has(0x1A, 1) {
+			set("SKU Number", r.str(0x19))
+			set("Family", r.str(0x1A))
+		}
+
+	case smbiosTypeBaseboard:
+		s.Name = "Base Board Information"
+		if !r.has(0x08, 0) {
+			break
+		}
+		set("Manufacturer", r.str(0x04))
+		set("Product Name", r.str(0x05))
+		set("Version", r.str(0x06))
+		set("Serial Number", r.str(0x07))
+		if r.has(0x08, 1) {
+			set("Asset Tag", r.str(0x08))
+		}
+		if r.has(0x09, 1) {
+			s.Lists["Features"] = bitNames(uint64(r.byte(0x09)), baseboardFeatures)
+		}
+		if r.has(0x0A, 1) {
+			set("Location In Chassis", r.str(0x0A))
+		}
+		if r.has(0x0D, 1) {
+			set("Chassis Handle", fmt.Sprintf("0x%04X", r.word(0x0B)))
+			set("Type", lookupName(baseboardTypes, int(r.byte(0x0D))))
+		}
+
+	case smbiosTypeChassis:
+		s.Name = "Chassis Information"
+		if !r.has(0x09, 0) {
+			break
+		}
+		set("Manufacturer", r.str(0x04))
+		set("Type", lookupName(chassisTypes, int(r.byte(0x05)&0x7F)))
+		if r.byte(0x05)&0x80 != 0 {
+			set("Lock", "Present")
+		} else {
+			set("Lock", "Not Present")
+		}
+		set("Version", r.str(0x06))
+		set("Serial Number", r.str(0x07))
+		set("Asset Tag", r.str(0x08))
+		if r.has(0x0C, 1) {
+			set("Boot-up State", lookupName(chassisStates, int(r.byte(0x09))))
+			set("Power Supply State", lookupName(chassisStates, int(r.byte(0x0A))))
+			set("Thermal State", lookupName(chassisStates, int(r.byte(0x0B))))
+			set("Security Status", lookupName(chassisSecurity, int(r.byte(0x0C))))
+		}
+		if r.has(0x14, 1) {
+			skuOffset := 0x15 + int(r.byte(0x13))*int(r.byte(0x14))
+			if r.has(skuOffset, 1) {
+				set("SKU Number", r.str(skuOffset))
+			}
+		}
+
+	case smbiosTypeProcessor:
+		s.Name = "Processor Information"
+		if !r.has(0x1A, 0) {
+			break
+		}
+		set("Socket Designation", r.str(0x04))
+		set("Type", lookupName(processorTypes, int(r.byte(0x05))))
+		family := int(r.byte(0x06))
+		if family == 0xFE && r.has(0x28, 2) {
+			family = int(r.word(0x28))
+		}
+		set("Family", lookupName(processorFamilies, family))
+		manufacturer := r.str(0x07)
+		set("Manufacturer", manufacturer)
+
+		id := r.data[0x08:0x10]
+		set("ID", strings.TrimSpace(fmt.Sprintf("% X", id)))
+		eax := binary.LittleEndian.Uint32(id)
+		if signature := x86Signature(manufacturer, eax); signature != "" {
+			set("Signature", signature)
+			s.Lists["Flags"] = bitNames(uint64(binary.LittleEndian.Uint32(id[4:])), processorFlags)
+		}
+
+		set("Version", r.str(0x10))
+		voltage := r.byte(0x11)
+		if voltage&0x80 != 0 {
+			set("Voltage", fmt.Sprintf("%.1f V", float64(voltage&0x7F)/10))
+		} else if v := bitNames(uint64(voltage&0x07), legacyVoltages); len(v) > 0 {
+			set("Voltage", strings.Join(v, " "))
+		}
+		set("External Clock", speedOrUnknown(uint32(r.word(0x12)), "MHz"))
+		set("Max Speed", speedOrUnknown(uint32(r.word(0x14)), "MHz"))
+		set("Current Speed", speedOrUnknown(uint32(r.word(0x16)), "MHz"))
+		if status := r.byte(0x18); status&0x40 != 0 {
+			set("Status", "Populated, "+lookupName(processorStatuses, int(status&0x07)))
+		} else {
+			set("Status", "Unpopulated")
+		}
+		if r.has(0x23, 0) {
+			set("Serial Number", r.str(0x20))
+			set("Asset Tag", r.str(0x21))
+			set("Part Number", r.str(0x22))
+		}
+		if r.has(0x26, 2) {
+			coreCount, coreEnabled, threadCount := uint16(r.byte(0x23)), uint16(r.byte(0x24)), uint16(r.byte(0x25))
+			if r.has(0x2A, 6) {
+				if coreCount == 0xFF {
+					coreCount = r.word(0x2A)
+				}
+				if coreEnabled == 0xFF {
+					coreEnabled = r.word(0x2C)
+				}
+				if threadCount == 0xFF {
+					threadCount = r.word(0x2E)
+				}
+			}
+			set("Core Count", strconv.Itoa(int(coreCount)))
+			set("Core Enabled", strconv.Itoa(int(coreEnabled)))
+			set("Thread Count", strconv.Itoa(int(threadCount)))
+			s.Lists["Characteristics"] = bitNames(uint64(r.word(0x26)), processorCharacteristics)
+		}
+
+	case smbiosTypeMemoryDevice:
+		s.Name = "Memory Device"
+		if !r.has(0x15, 0) {
+			break
+		}
+		set("Array Handle", fmt.Sprintf("0x%04X", r.word(0x04)))
+		set("Total Width", memoryWidth(r.word(0x08)))
+		set("Data Width", memoryWidth(r.word(0x0A)))
+		switch size := r.word(0x0C); {
+		case size == 0:
+			set("Size", "No Module Installed")
+		case size == 0xFFFF:
+			set("Size", "Unknown")
+		case size == 0x7FFF && r.has(0x1C, 4):
+			set("Size", formatDMISize(uint64(r.dword(0x1C)&0x7FFFFFFF)*1024))
+		case size&0x8000 != 0:
+			set("Size", formatDMISize(uint64(size&0x7FFF)))
+		default:
+			set("Size", formatDMISize(uint64(size)*1024))
+		}
+		set("Form Factor", lookupName(memoryFormFactors, int(r.byte(0x0E))))
+		set("Locator", r.str(0x10))
+		set("Bank Locator", r.str(0x11))
+		set("Type", lookupName(memoryTypes, int(r.byte(0x12))))
+		if detail := r.word(0x13); detail&0xFFFE == 0 {
+			set("Type Detail", "None")
+		} else {
+			set("Type Detail", strings.Join(bitNames(uint64(detail), memoryTypeDetails), " "))
+		}
+		if r.has(0x17, 0) {
+			speed := uint32(r.word(0x15))
+			if speed == 0xFFFF && r.has(0x54, 4) {
+				speed = r.dword(0x54)
+			}
+			set("Speed", speedOrUnknown(speed, "MT/s"))
+		}
+		if r.has(0x1B, 0) {
+			set("Manufacturer", r.str(0x17))
+			set("Serial Number", r.str(0x18))
+			set("Asset Tag", r.str(0x19))
+			set("Part Number", r.str(0x1A))
+		}
+		if r.has(0x1B, 1) {
+			if rank := r.byte(0x1B) & 0x0F; rank != 0 {
+				set("Rank", strconv.Itoa(int(rank)))
+			} else {
+				set("Rank", "Unknown")
+			}
+		}
+		if r.has(0x20, 2) {
+			speed := uint32(r.word(0x20))
+			if speed == 0xFFFF && r.has(0x58, 4) {
+				speed = r.dword(0x58)
+			}
+			set("Configured Memory Speed", speedOrUnknown(speed, "MT/s"))
+		}
+
+	case smbiosTypeOEMStrings, smbiosTypeConfigOptions:
+		s.Name = smbiosTypeNames[s.Type]
+		for i, str := range r.strings {
+			set(fmt.Sprintf("String %d", i+1), str)
+		}
+
+	case smbiosTypeInactive:
+		s.Name = "Inactive"
+
+	case smbiosTypeEndOfTable:
+		s.Name = "End Of Table"
+
+	default:
+		// Остальные структуры сохраняем без разбора, чтобы данные не терялись
+		if name, ok := smbiosTypeNames[s.Type]; ok {
+			s.Name = name
+		} else if s.Type >= 128 {
+			s.Name = "OEM-specific Type"
+		} else {
+			s.Name = fmt.Sprintf("Unknown Type %d", s.Type)
+		}
+		set("Header and Data", strings.TrimSpace(fmt.Sprintf("% X", r.data)))
+		if len(r.strings) > 0 {
+			s.Lists["Strings"] = r.strings
+		}
+	}
+}
+
+// formatSMBIOSUUID форматирует UUID системы. Начиная с SMBIOS 2.6 первые три поля хранятся в little-endian
+func formatSMBIOSUUID(u []byte, littleEndian bool) string {
+	allSame := func(b byte) bool {
+		for _, x := range u {
+			if x != b {
+				return false
+			}
+		}
+		return true
+	}
+	if allSame(0xFF) {
+		return "Not Present"
+	}
+	if allSame(0x00) {
+		return "Not Settable"
+	}
+
+	if littleEndian {
+		return fmt.Sprintf("%02X%02X%02X%02X-%02X%02X-%02X%02X-%02X%02X-%02X%02X%02X%02X%02X%02X",
+			u[3], u[2], u[1], u[0], u[5], u[4], u[7], u[6], u[8], u[9], u[10], u[11], u[12], u[13], u[14], u[15])
+	}
+	return fmt.Sprintf("%02X%02X%02X%02X-%02X%02X-%02X%02X-%02X%02X-%02X%02X%02X%02X%02X%02X",
+		u[0], u[1], u[2], u[3], u[4], u[5], u[6], u[7], u[8], u[9], u[10], u[11], u[12], u[13], u[14], u[15])
+}
+
+// x86Signature расшифровывает сигнатуру процессоров Intel и AMD из поля ID
+func x86Signature(manufacturer string, eax uint32) string {
+	isIntel := strings.Contains(manufacturer, "Intel")
+	isAMD := strings.Contains(manufacturer, "AMD") || strings.Contains(manufacturer, "Advanced Micro Devices")
+	if !isIntel && !isAMD {
+		return ""
+	}
+
+	family := (eax >> 8) & 0x0F
+	model := (eax >> 4) & 0x0F
+	stepping := eax & 0x0F
+	if family == 0x0F || (isIntel && family == 0x06) {
+		model += ((eax >> 16) & 0x0F) << 4
+	}
+	if family == 0x0F {
+		family += (eax >> 20) & 0xFF
+	}
+
+	if isIntel {
+		return fmt.Sprintf("Type %d, Family %d, Model %d, Stepping %d", (eax>>12)&0x03, family, model, stepping)
+	}
+	return fmt.Sprintf("Family %d, Model %d, Stepping %d", family, model, stepping)
+}
+
+// memoryWidth форматирует ширину шины памяти
+func memoryWidth(bits uint16) string {
+	if bits == 0xFFFF || bits == 0 {
+		return "Unknown"
+	}
+	return fmt.Sprintf("%d bits", bits)
+}
+
+// readDMIIDInfo собирает данные из /sys/class/dmi/id, когда таблицы SMBIOS недоступны.
+// Там есть только основные поля BIOS, системы, платы и корпуса
+func readDMIIDInfo() (*SMBIOSInfo, error) {
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(sysfsDMIID, name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	if _, err := os.Stat(sysfsDMIID); err != nil {
+		return nil, err
+	}
+
+	info := &SMBIOSInfo{}
+	if vendor, version := read("bios_vendor"), read("bios_version"); vendor != "" || version != "" {
+		info.BIOS = &BIOSRecord{Vendor: vendor, Version: version, ReleaseDate: read("bios_date"), Revision: read("bios_release")}
+	}
+	// product_serial, product_uuid и board_serial доступны только root
+	info.System = &SystemRecord{
+		Manufacturer: read("sys_vendor"),
+		ProductName:  read("product_name"),
+		Version:      read("product_version"),
+		SerialNumber: read("product_serial"),
+		UUID:         strings.ToLower(read("product_uuid")),
+		SKU:          read("product_sku"),
+		Family:       read("product_family"),
+	}
+	if name := read("board_name"); name != "" {
+		info.Baseboards = []BaseboardRecord{{
+			Manufacturer: read("board_vendor"),
+			ProductName:  name,
+			Version:      read("board_version"),
+			SerialNumber: read("board_serial"),
+			AssetTag:     read("board_asset_tag"),
+		}}
+	}
+	if chassisType, err := strconv.Atoi(read("chassis_type")); err == nil {
+		info.Chassis = []ChassisRecord{{
+			Manufacturer: read("chassis_vendor"),
+			Type:         lookupName(chassisTypes, chassisType&0x7F),
+			Version:      read("chassis_version"),
+			SerialNumber: read("chassis_serial"),
+			AssetTag:     read("chassis_asset_tag"),
+		}}
+	}
+
+	if info.System.ProductName == "" && len(info.Baseboards) == 0 {
+		return nil, errors.New("no DMI data in " + sysfsDMIID)
+	}
+	return info, nil
+}
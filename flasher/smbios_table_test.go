@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Дамп desktop-3.2.bin снят с той же платы, что и desktop.txt, но содержит не все структуры:
+// один процессор без части флагов и два модуля памяти из трёх
+func TestDecodeSMBIOSDumpMatchesDmidecode(t *testing.T) {
+	dump, err := decodeSMBIOSDump(readFixture(t, "smbios/desktop-3.2.bin"))
+	if err != nil {
+		t.Fatalf("decodeSMBIOSDump: %v", err)
+	}
+	text := parseSMBIOS(string(readFixture(t, "dmidecode/desktop.txt")))
+
+	if dump.Version != text.Version {
+		t.Errorf("version = %q, dmidecode %q", dump.Version, text.Version)
+	}
+	if !reflect.DeepEqual(dump.BIOS, text.BIOS) {
+		t.Errorf("BIOS = %+v, dmidecode %+v", dump.BIOS, text.BIOS)
+	}
+	if !reflect.DeepEqual(dump.System, text.System) {
+		t.Errorf("system = %+v, dmidecode %+v", dump.System, text.System)
+	}
+	if !reflect.DeepEqual(dump.Baseboards, text.Baseboards) {
+		t.Errorf("baseboards = %+v, dmidecode %+v", dump.Baseboards, text.Baseboards)
+	}
+	if !reflect.DeepEqual(dump.Chassis, text.Chassis) {
+		t.Errorf("chassis = %+v, dmidecode %+v", dump.Chassis, text.Chassis)
+	}
+	if got, want := dmiInfoFromSMBIOS(dump), dmiInfoFromSMBIOS(text); got != want {
+		t.Errorf("DMI info = %+v, dmidecode %+v", got, want)
+	}
+
+	if len(dump.Processors) != 1 || len(text.Processors) != 1 {
+		t.Fatalf("processors: dump %d, dmidecode %d, want 1", len(dump.Processors), len(text.Processors))
+	}
+	p, q := dump.Processors[0], text.Processors[0]
+	if p.Handle != q.Handle || p.SocketDesignation != q.SocketDesignation || p.Family != q.Family ||
+		p.Manufacturer != q.Manufacturer || p.ID != q.ID || p.Signature != q.Signature || p.Version != q.Version ||
+		p.Voltage != q.Voltage || p.MaxSpeedMHz != q.MaxSpeedMHz || p.CurrentSpeedMHz != q.CurrentSpeedMHz ||
+		p.CoreCount != q.CoreCount || p.ThreadCount != q.ThreadCount || !reflect.DeepEqual(p.Characteristics, q.Characteristics) {
+		t.Errorf("processor = %+v, dmidecode %+v", p, q)
+	}
+
+	textMemory := make(map[string]MemoryDevice)
+	for _, m := range text.Memory {
+		textMemory[m.Handle] = m
+	}
+	if len(dump.Memory) == 0 {
+		t.Fatal("no memory devices decoded")
+	}
+	for _, m := range dump.Memory {
+		want, ok := textMemory[m.Handle]
+		if !ok {
+			t.Errorf("memory device %s is not in dmidecode output", m.Handle)
+			continue
+		}
+		if m.Locator != want.Locator || m.BankLocator != want.BankLocator || m.Populated != want.Populated ||
+			m.SizeMB != want.SizeMB || m.Type != want.Type || m.SpeedMTs != want.SpeedMTs {
+			t.Errorf("memory device %s = %+v, dmidecode %+v", m.Handle, m, want)
+		}
+		if m.Populated && (m.Manufacturer != want.Manufacturer || m.SerialNumber != want.SerialNumber || m.PartNumber != want.PartNumber) {
+			t.Errorf("memory device %s = %+v, dmidecode %+v", m.Handle, m, want)
+		}
+	}
+}
+
+func TestDecodeSMBIOSDumpRejectsDamagedData(t *testing.T) {
+	dump := readFixture(t, "smbios/desktop-3.2.bin")
+	const tableOffset = 0x20
+
+	corrupt := func(offset int, value byte) []byte {
+		data := append([]byte(nil), dump...)
+		data[offset] = value
+		return data
+	}
+	// relocate переносит таблицу и пересчитывает контрольную сумму точки входа, чтобы её принял разбор
+	relocate := func(address uint16) []byte {
+		data := append([]byte(nil), dump...)
+		data[0x10], data[0x11] = byte(address), byte(address>>8)
+		data[0x05] = 0
+		var sum byte
+		for _, b := range data[:data[0x06]] {
+			sum += b
+		}
+		data[0x05] = -sum
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"anchor only", dump[:5]},
+		{"entry point only", dump[:tableOffset]},
+		{"structure header cut", dump[:tableOffset+2]},
+		{"formatted part cut", dump[:tableOffset+10]},
+		{"strings cut", dump[:tableOffset+0x1a+5]},
+		{"no end-of-table", dump[:len(dump)-6]},
+		{"bad entry point checksum", corrupt(0x05, dump[0x05]+1)},
+		{"table offset outside dump", relocate(0x1000)},
+		{"table offset inside a structure", relocate(tableOffset + 3)},
+		{"structure length below header", corrupt(tableOffset+1, 2)},
+		{"structure length past table", corrupt(len(dump)-6+1, 0x20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeSMBIOSDump(tt.data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestDecodeSMBIOSDumpNoPanic(t *testing.T) {
+	dump := readFixture(t, "smbios/desktop-3.2.bin")
+
+	// Любая обрезка дампа даёт ошибку, а не панику на индексе среза
+	for n := 0; n < len(dump); n++ {
+		if _, err := decodeSMBIOSDump(dump[:n]); err == nil {
+			t.Errorf("dump cut to %d bytes decoded without error", n)
+		}
+	}
+	// Порча любого байта таблицы не должна приводить к панике
+	for i := 0x20; i < len(dump); i++ {
+		data := append([]byte(nil), dump...)
+		data[i] ^= 0xff
+		decodeSMBIOSDump(data)
+	}
+}
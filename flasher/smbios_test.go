@@ -0,0 +1,246 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readFixture читает файл из testdata
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+func TestParseDmidecodeStructures(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		version    string
+		count      int
+		first      DMIStructure // заголовок первой структуры
+		handles    []string     // все структуры одного типа в порядке вывода
+		handleType int
+	}{
+		{
+			fixture:    "dmidecode/desktop.txt",
+			version:    "3.2.0",
+			count:      14,
+			first:      DMIStructure{Handle: "0x0000", Type: smbiosTypeBIOS, Name: "BIOS Information"},
+			handleType: smbiosTypeMemoryDevice,
+			handles:    []string{"0x0011", "0x0013", "0x0015"},
+		},
+		{
+			fixture:    "dmidecode/server-2cpu.txt",
+			version:    "3.3.0",
+			count:      11,
+			first:      DMIStructure{Handle: "0x0000", Type: smbiosTypeBIOS, Name: "BIOS Information"},
+			handleType: smbiosTypeProcessor,
+			handles:    []string{"0x0050", "0x0054"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			version, structures := parseDmidecode(string(readFixture(t, tt.fixture)))
+			if version != tt.version {
+				t.Errorf("version = %q, want %q", version, tt.version)
+			}
+			if len(structures) != tt.count {
+				t.Fatalf("got %d structures, want %d", len(structures), tt.count)
+			}
+			first := structures[0]
+			if first.Handle != tt.first.Handle || first.Type != tt.first.Type || first.Name != tt.first.Name {
+				t.Errorf("first structure = %s type %d %q, want %s type %d %q",
+					first.Handle, first.Type, first.Name, tt.first.Handle, tt.first.Type, tt.first.Name)
+			}
+
+			var handles []string
+			for _, s := range structures {
+				if s.Type == tt.handleType {
+					handles = append(handles, s.Handle)
+				}
+			}
+			if !reflect.DeepEqual(handles, tt.handles) {
+				t.Errorf("type %d handles = %v, want %v", tt.handleType, handles, tt.handles)
+			}
+
+			last := structures[len(structures)-1]
+			if last.Type != smbiosTypeEndOfTable {
+				t.Errorf("last structure type = %d, want %d", last.Type, smbiosTypeEndOfTable)
+			}
+		})
+	}
+}
+
+func TestParseSMBIOSFixtures(t *testing.T) {
+	tests := []struct {
+		fixture         string
+		system          SystemRecord
+		baseboard       string
+		biosChars       []string
+		processors      []string // сокеты в порядке вывода
+		cores, threads  int
+		procChars       int
+		procFlags       int
+		populatedMemory int
+		memoryTotalMB   int
+	}{
+		{
+			fixture: "dmidecode/desktop.txt",
+			system: SystemRecord{
+				Handle:       "0x0001",
+				Manufacturer: "Micro-Star International Co., Ltd.",
+				ProductName:  "MS-7C56",
+				Version:      "2.0",
+				SerialNumber: "To be filled by O.E.M.",
+				UUID:         "5e2a1c40-7b3d-11ec-8d3d-0242ac130003",
+				WakeUpType:   "Power Switch",
+				SKU:          "To be filled by O.E.M.",
+				Family:       "To be filled by O.E.M.",
+			},
+			baseboard: "07C5611_L91E654321",
+			biosChars: []string{
+				"PCI is supported",
+				"BIOS is upgradeable",
+				"BIOS shadowing is allowed",
+				"Boot from CD is supported",
+				"Selectable boot is supported",
+				"EDD is supported",
+				"ACPI is supported",
+				"USB legacy is supported",
+				"BIOS boot specification is supported",
+				"Targeted content distribution is supported",
+				"UEFI is supported",
+			},
+			processors:      []string{"AM4"},
+			cores:           6,
+			threads:         12,
+			procChars:       6,
+			procFlags:       10,
+			populatedMemory: 2,
+			memoryTotalMB:   32768,
+		},
+		{
+			fixture: "dmidecode/server-2cpu.txt",
+			system: SystemRecord{
+				Handle:       "0x0001",
+				Manufacturer: "Supermicro",
+				ProductName:  "SYS-1029P-WTR",
+				Version:      "0123456789",
+				SerialNumber: "S372184X9A12345",
+				UUID:         "00000000-0000-0000-0000-ac1f6b4a2b3c",
+				WakeUpType:   "Power Switch",
+				SKU:          "To be filled by O.E.M.",
+				Family:       "To be filled by O.E.M.",
+			},
+			baseboard: "ZM19AS012345",
+			biosChars: []string{
+				"PCI is supported",
+				"BIOS is upgradeable",
+				"BIOS shadowing is allowed",
+				"ACPI is supported",
+				"UEFI is supported",
+			},
+			processors: []string{"CPU1", "CPU2"},
+			cores:      10,
+			threads:    20,
+			procChars:  6,
+			procFlags:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			info := parseSMBIOS(string(readFixture(t, tt.fixture)))
+
+			if info.System == nil || *info.System != tt.system {
+				t.Errorf("system = %+v, want %+v", info.System, tt.system)
+			}
+			if len(info.Baseboards) != 1 || info.Baseboards[0].SerialNumber != tt.baseboard {
+				t.Errorf("baseboards = %+v, want one with serial %s", info.Baseboards, tt.baseboard)
+			}
+			if info.BIOS == nil || !reflect.DeepEqual(info.BIOS.Characteristics, tt.biosChars) {
+				t.Errorf("BIOS characteristics = %v, want %v", info.BIOS, tt.biosChars)
+			}
+
+			// Повторяющиеся структуры одного типа не сливаются в одну
+			var sockets []string
+			for _, p := range info.Processors {
+				sockets = append(sockets, p.SocketDesignation)
+				if p.CoreCount != tt.cores || p.ThreadCount != tt.threads {
+					t.Errorf("%s: cores/threads = %d/%d, want %d/%d", p.SocketDesignation, p.CoreCount, p.ThreadCount, tt.cores, tt.threads)
+				}
+				// Многострочные списки не перемешиваются с полями, которые идут после них
+				if len(p.Characteristics) != tt.procChars || len(p.Flags) != tt.procFlags {
+					t.Errorf("%s: %d characteristics and %d flags, want %d and %d",
+						p.SocketDesignation, len(p.Characteristics), len(p.Flags), tt.procChars, tt.procFlags)
+				}
+				if p.Version == "" {
+					t.Errorf("%s: the field after the Flags list was lost", p.SocketDesignation)
+				}
+			}
+			if !reflect.DeepEqual(sockets, tt.processors) {
+				t.Errorf("processor sockets = %v, want %v", sockets, tt.processors)
+			}
+
+			if tt.memoryTotalMB > 0 {
+				populated := 0
+				for _, m := range info.Memory {
+					if m.Populated {
+						populated++
+					}
+				}
+				if populated != tt.populatedMemory || info.MemoryTotalMB != tt.memoryTotalMB {
+					t.Errorf("memory: %d populated, %d MB, want %d populated, %d MB",
+						populated, info.MemoryTotalMB, tt.populatedMemory, tt.memoryTotalMB)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDmidecodeHeaders(t *testing.T) {
+	output := "SMBIOS 2.7 present.\n" +
+		"Handle 0x00AB, DMI type 4, 42 bytes\n" +
+		"Processor Information\n" +
+		"\tSocket Designation: CPU0\n" +
+		"\tCharacteristics:\n" +
+		"\t\t64-bit capable\n" +
+		"\t\tMulti-Core\n" +
+		"\tCore Count: 4\n" +
+		"\tCore Count: 8\n" +
+		"\n" +
+		"Handle 0x00AC, DMI type 200, 6 bytes\n" +
+		"OEM-specific Type\n" +
+		"\tHeader and Data:\n" +
+		"\t\tC8 06 AC 00 01 02\n"
+
+	version, structures := parseDmidecode(output)
+	if version != "2.7" {
+		t.Errorf("version = %q, want 2.7", version)
+	}
+	if len(structures) != 2 {
+		t.Fatalf("got %d structures, want 2", len(structures))
+	}
+
+	cpu := structures[0]
+	if cpu.Handle != "0x00ab" || cpu.Type != smbiosTypeProcessor || cpu.Name != "Processor Information" {
+		t.Errorf("header = %s type %d %q", cpu.Handle, cpu.Type, cpu.Name)
+	}
+	if got := cpu.Lists["Characteristics"]; !reflect.DeepEqual(got, []string{"64-bit capable", "Multi-Core"}) {
+		t.Errorf("characteristics = %v", got)
+	}
+	if got := cpu.field("Core Count"); got != "4" {
+		t.Errorf("repeated field = %q, want the first value 4", got)
+	}
+
+	oem := structures[1]
+	if oem.Type != 200 || oem.Name != "OEM-specific Type" || len(oem.Lists["Header and Data"]) != 1 {
+		t.Errorf("OEM structure = %+v", oem)
+	}
+}
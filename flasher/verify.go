@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Значения /sys/class/net/<iface>/addr_assign_type
+const (
+	addrAssignPermanent = "0" // адрес прочитан из оборудования при загрузке драйвера
+)
+
+// verifyTimeout - сколько ждать появления интерфейса после загрузки штатного драйвера
+const verifyTimeout = 15 * time.Second
+
+// permanentMAC возвращает постоянный (аппаратный) MAC-адрес интерфейса.
+// Сначала используется ethtool -P, при его отсутствии - адрес из sysfs,
+// если ядро сообщает, что он получен от оборудования, а не задан через ip link
+func permanentMAC(iface string) (string, error) {
+	if out, err := runCommand("ethtool", "-P", iface); err == nil {
+		if idx := strings.Index(out, "address:"); idx != -1 {
+			addr := strings.ToLower(strings.TrimSpace(out[idx+len("address:"):]))
+			if addr != "" && addr != "00:00:00:00:00:00" {
+				return addr, nil
+			}
+		}
+	}
+
+	assignType := readSysfsValue(filepath.Join(sysClassNet, iface, "addr_assign_type"))
+	if assignType != addrAssignPermanent {
+		return "", fmt.Errorf("permanent address of %s is unavailable (addr_assign_type %q)", iface, assignType)
+	}
+
+	addr := strings.ToLower(readSysfsValue(filepath.Join(sysClassNet, iface, "address")))
+	if addr == "" {
+		return "", fmt.Errorf("could not read address of %s", iface)
+	}
+	return addr, nil
+}
+
+// interfacesWithPermanentMAC возвращает интерфейсы, у которых аппаратный адрес совпадает с targetMAC
+func interfacesWithPermanentMAC(targetMAC string) []string {
+	var result []string
+	for _, nic := range listPCINICs() {
+		perm, err := permanentMAC(nic.Interface)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(perm, targetMAC) {
+			result = append(result, nic.Interface)
+		}
+	}
+	return result
+}
+
+// verifyFlashedMAC перечитывает аппаратные адреса после загрузки штатного драйвера и
+// убеждается, что targetMAC действительно записан в efuse, а не только назначен интерфейсу
+func verifyFlashedMAC(targetMAC string) ([]string, error) {
+	deadline := time.Now().Add(verifyTimeout)
+	for {
+		if ifaces := interfacesWithPermanentMAC(targetMAC); len(ifaces) > 0 {
+			return ifaces, nil
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	// Выясняем, не изменился ли только рабочий адрес
+	if ifaces, err := getInterfacesWithMAC(targetMAC); err == nil && len(ifaces) > 0 {
+		return nil, fmt.Errorf("MAC %s is only set as the runtime address on %s; the permanent hardware address was not changed",
+			targetMAC, strings.Join(ifaces, ", "))
+	}
+
+	var found []string
+	for _, nic := range listPCINICs() {
+		if perm, err := permanentMAC(nic.Interface); err == nil {
+			found = append(found, fmt.Sprintf("%s=%s", nic.Interface, perm))
+		}
+	}
+	if len(found) == 0 {
+		return nil, errors.New("no network interface reported a permanent address after the driver reload")
+	}
+	return nil, fmt.Errorf("no interface has permanent address %s (found: %s)", targetMAC, strings.Join(found, ", "))
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Форматы выгрузки пула
+const (
+	exportCSV   = "csv"
+	exportJSONL = "jsonl"
+	exportXLSX  = "xlsx"
+)
+
+// exportFormats - поддерживаемые форматы выгрузки в порядке пунктов меню
+var exportFormats = []string{exportCSV, exportJSONL, exportXLSX}
+
+// exportColumns - колонки выгрузки. Названия совпадают с полями импорта, поэтому выгрузку можно загрузить обратно
+var exportColumns = []string{
+	"address", "state", "used", "used_at", "used_by", "comment",
+	"reserved", "reservation_reason", "reservation_owner", "reservation_expires",
+	"system_uuid", "system_serial", "board_serial", "interface", "pci_address", "previous_mac",
+}
+
+// defaultExportColumns - колонки, которые выгружаются, если не выбраны другие
+var defaultExportColumns = exportColumns[:10]
+
+// exportValue возвращает значение колонки выгрузки для адреса
+func exportValue(addr MACAddress, column string) string {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	binding := addr.Binding
+	if binding == nil {
+		binding = &HardwareBinding{}
+	}
+	reservation := addr.Reservation
+	if reservation == nil {
+		reservation = &Reservation{}
+	}
+
+	switch column {
+	case "address":
+		return addr.Address
+	case "state":
+		return addressState(addr)
+	case "used":
+		return strconv.FormatBool(addr.Used)
+	case "used_at":
+		return formatTime(addr.UsedAt)
+	case "used_by":
+		return addr.UsedBy
+	case "comment":
+		return addr.Comment
+	case "reserved":
+		return strconv.FormatBool(addr.Reserved)
+	case "reservation_reason":
+		return reservation.Reason
+	case "reservation_owner":
+		return reservation.Owner
+	case "reservation_expires":
+		return formatTime(reservation.ExpiresAt)
+	case "system_uuid":
+		return binding.SystemUUID
+	case "system_serial":
+		return binding.SystemSerial
+	case "board_serial":
+		return binding.BoardSerial
+	case "interface":
+		return binding.Interface
+	case "pci_address":
+		return binding.PCIAddress
+	case "previous_mac":
+		return binding.PreviousMAC
+	}
+	return ""
+}
+
+// parseExportColumns разбирает список колонок через запятую: названия или номера из exportColumns.
+// Пустая строка - колонки по умолчанию, all - все колонки
+func parseExportColumns(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "":
+		return defaultExportColumns, nil
+	case "all":
+		return exportColumns, nil
+	}
+
+	var columns []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(item); err == nil {
+			if n < 1 || n > len(exportColumns) {
+				return nil, fmt.Errorf("invalid column number %d", n)
+			}
+			columns = append(columns, exportColumns[n-1])
+			continue
+		}
+		found := false
+		for _, c := range exportColumns {
+			if strings.EqualFold(c, item) {
+				columns = append(columns, c)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", item)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns selected")
+	}
+	return columns, nil
+}
+
+// ExportFilter - условия отбора адресов для выгрузки
+type ExportFilter struct {
+	States       []string  // пусто - любые состояния
+	ReservedOnly bool      // только действующие резервирования
+	Pattern      string    // шаблон адреса, как при выборе адресов
+	UsedBy       string    // подстрока в UsedBy
+	Since, Until time.Time // интервал UsedAt
+}
+
+// parseExportFilter разбирает условия через пробел:
+// state=used,free reserved match=00:1A:2B:* used-by=line3 since=2024-01-01 until=2024-12-31
+func parseExportFilter(value string) (ExportFilter, error) {
+	var f ExportFilter
+	for _, term := range strings.Fields(value) {
+		key, arg, _ := strings.Cut(term, "=")
+		switch strings.ToLower(key) {
+		case "state":
+			for _, s := range strings.Split(arg, ",") {
+				s = strings.ToLower(strings.TrimSpace(s))
+				known := false
+				for _, state := range addressStates {
+					if s == state {
+						known = true
+					}
+				}
+				if !known {
+					return f, fmt.Errorf("unknown state %q", s)
+				}
+				f.States = append(f.States, s)
+			}
+		case "reserved":
+			f.ReservedOnly = true
+		case "match":
+			f.Pattern = arg
+		case "used-by":
+			f.UsedBy = arg
+		case "since", "until":
+			day, err := time.ParseInLocation("2006-01-02", arg, time.Local)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s date %q, expected YYYY-MM-DD", key, arg)
+			}
+			if key == "since" {
+				f.Since = day
+			} else {
+				f.Until = day.Add(24 * time.Hour)
+			}
+		default:
+			return f, fmt.Errorf("unknown filter %q", term)
+		}
+	}
+	return f, nil
+}
+
+// exportFilterMatches проверяет адрес по условиям выгрузки
+func exportFilterMatches(f ExportFilter, addr MACAddress) bool {
+	if len(f.States) > 0 {
+		state, ok := addressState(addr), false
+		for _, s := range f.States {
+			if s == state {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.ReservedOnly && !isReserved(addr) {
+		return false
+	}
+	if f.Pattern != "" && !matchAddressPattern(addr.Address, f.Pattern) {
+		return false
+	}
+	if f.UsedBy != "" && !strings.Contains(strings.ToLower(addr.UsedBy), strings.ToLower(f.UsedBy)) {
+		return false
+	}
+	if !f.Since.IsZero() && addr.UsedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && (addr.UsedAt.IsZero() || !addr.UsedAt.Before(f.Until)) {
+		return false
+	}
+	return true
+}
+
+// spreadsheetCell защищает значение от вычисления как формулы: табличный редактор выполняет
+// ячейки, начинающиеся с =, +, - или @, а комментарий и used_by вводят пользователи и флешеры
+func spreadsheetCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// writeExportCSV записывает адреса в CSV с заголовком
+func writeExportCSV(w io.Writer, columns []string, addrs []MACAddress) error {
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	for _, addr := range addrs {
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = spreadsheetCell(exportValue(addr, c))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeExportJSONL записывает адреса в JSON Lines, по объекту на строку, в порядке колонок.
+// used и reserved записываются как логические значения
+func writeExportJSONL(w io.Writer, columns []string, addrs []MACAddress) error {
+	bw := bufio.NewWriter(w)
+	for _, addr := range addrs {
+		bw.WriteByte('{')
+		for i, c := range columns {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			key, _ := json.Marshal(c)
+			var value []byte
+			switch c {
+			case "used":
+				value, _ = json.Marshal(addr.Used)
+			case "reserved":
+				value, _ = json.Marshal(addr.Reserved)
+			default:
+				value, _ = json.Marshal(exportValue(addr, c))
+			}
+			bw.Write(key)
+			bw.WriteByte(':')
+			bw.Write(value)
+		}
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
+
+// xlsxColumnName возвращает буквенное обозначение колонки листа: 0 - A, 26 - AA
+func xlsxColumnName(n int) string {
+	name := ""
+	for n >= 0 {
+		name = string(rune('A'+n%26)) + name
+		n = n/26 - 1
+	}
+	return name
+}
+
+// Части минимальной книги XLSX (Office Open XML) с одним листом
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="MAC pool" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// writeExportXLSX записывает адреса в книгу XLSX. Все значения записываются строками,
+// чтобы табличный редактор не превращал MAC-адреса и даты в числа
+func writeExportXLSX(w io.Writer, columns []string, addrs []MACAddress) error {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %v", p.name, err)
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return fmt.Errorf("failed to write %s: %v", p.name, err)
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return fmt.Errorf("failed to write sheet: %v", err)
+	}
+	bw := bufio.NewWriter(sheet)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	bw.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	writeRow := func(n int, values []string) {
+		fmt.Fprintf(bw, `<row r="%d">`, n)
+		for i, v := range values {
+			if v == "" {
+				continue
+			}
+			fmt.Fprintf(bw, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, xlsxColumnName(i), n)
+			xml.EscapeText(bw, []byte(v))
+			bw.WriteString(`</t></is></c>`)
+		}
+		bw.WriteString(`</row>`)
+	}
+	writeRow(1, columns)
+	for i, addr := range addrs {
+		values := make([]string, len(columns))
+		for j, c := range columns {
+			values[j] = spreadsheetCell(exportValue(addr, c))
+		}
+		writeRow(i+2, values)
+	}
+	bw.WriteString(`</sheetData></worksheet>`)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write sheet: %v", err)
+	}
+	return zw.Close()
+}
+
+// writePoolExport отбирает адреса по фильтру и записывает их в выбранном формате. Возвращает число адресов
+func writePoolExport(w io.Writer, pool MACPool, format string, columns []string, filter ExportFilter) (int, error) {
+	var addrs []MACAddress
+	for _, addr := range pool.Addresses {
+		if exportFilterMatches(filter, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	var err error
+	switch format {
+	case exportCSV:
+		err = writeExportCSV(w, columns, addrs)
+	case exportJSONL:
+		err = writeExportJSONL(w, columns, addrs)
+	case exportXLSX:
+		err = writeExportXLSX(w, columns, addrs)
+	default:
+		err = fmt.Errorf("unknown export format %q, expected csv, jsonl or xlsx", format)
+	}
+	return len(addrs), err
+}
+
+// saveExport записывает выгрузку в файл или, если путь "-", в стандартный вывод.
+// Файл создаётся с правами 0600: данные в нём больше не зашифрованы
+func saveExport(path string, pool MACPool, format string, columns []string, filter ExportFilter) (int, error) {
+	if path == "-" {
+		return writePoolExport(os.Stdout, pool, format, columns, filter)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create export file: %v", err)
+	}
+	count, err := writePoolExport(f, pool, format, columns, filter)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write export file: %v", closeErr)
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+	return count, nil
+}
+
+// plaintextWarning - предупреждение перед выгрузкой незашифрованных данных
+const plaintextWarning = "The export is NOT encrypted: MAC addresses, usage and hardware data leave the protected pool file."
+
+// runExportCommand выгружает пул без интерактивного меню. Приглашения выводятся в stderr,
+// чтобы выгрузку в стандартный вывод можно было передать по конвейеру
+func runExportCommand(poolFile, format, output, columnsList, filterExpr string, confirmed bool) int {
+	if poolFile == "" {
+		fmt.Fprintln(os.Stderr, "-file is required with -export")
+		return 2
+	}
+	format = strings.ToLower(format)
+	columns, err := parseExportColumns(columnsList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	filter, err := parseExportFilter(filterExpr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	if format == exportXLSX && output == "-" && term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, "Refusing to write XLSX to a terminal, use -output or redirect stdout")
+		return 2
+	}
+
+	// Подтверждение и пароль читаются через один reader: при вводе из конвейера
+	// отдельный буфер подтверждения забрал бы и строку с паролем
+	reader := bufio.NewReader(os.Stdin)
+	if !confirmed {
+		fmt.Fprintln(os.Stderr, colorYellow+plaintextWarning+colorReset)
+		fmt.Fprint(os.Stderr, "Continue? (yes/no): ")
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "yes" && answer != "y" {
+			fmt.Fprintln(os.Stderr, "Export cancelled.")
+			return 1
+		}
+	}
+
+	pool, _, err := loadAndDecryptPoolFrom(poolFile, reader)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, colorRed+"Error:"+colorReset, err)
+		return 1
+	}
+	count, err := saveExport(output, pool, format, columns, filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, colorRed+"Error:"+colorReset, err)
+		return 1
+	}
+	if output != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d MAC addresses to %s\n", count, output)
+	}
+	return 0
+}
+
+// exportPool - пункт меню выгрузки пула: статистика или список адресов в CSV, JSON Lines или XLSX
+func exportPool(poolFile string) error {
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("\nExport format:")
+	fmt.Println("1. Summary statistics (text report)")
+	fmt.Println("2. CSV")
+	fmt.Println("3. JSON Lines")
+	fmt.Println("4. XLSX")
+	fmt.Println("0. Cancel")
+	fmt.Print("\nSelect option: ")
+	choice, _ := reader.ReadString('\n')
+
+	var format string
+	switch strings.TrimSpace(choice) {
+	case "1":
+		return exportPoolStats(poolFile)
+	case "2", "3", "4":
+		n, _ := strconv.Atoi(strings.TrimSpace(choice))
+		format = exportFormats[n-2]
+	default:
+		return nil
+	}
+
+	pool, _, err := loadAndDecryptPool(poolFile)
+	if err != nil {
+		fmt.Println(colorRed+"Failed to load MAC pool:"+colorReset, err)
+		return err
+	}
+
+	fmt.Println("\nColumns:")
+	for i, c := range exportColumns {
+		fmt.Printf("%2d. %s\n", i+1, c)
+	}
+	fmt.Printf("Columns (names or numbers, comma separated; all; empty for %s): ", strings.Join(defaultExportColumns, ","))
+	input, _ := reader.ReadString('\n')
+	columns, err := parseExportColumns(input)
+	if err != nil {
+		showErrorAndWait(err)
+		return err
+	}
+
+	fmt.Println("\nFilter, for example: state=used,quarantined reserved match=00:1A:2B:* used-by=line3 since=2024-01-01 until=2024-12-31")
+	fmt.Print("Filter (empty for all addresses): ")
+	input, _ = reader.ReadString('\n')
+	filter, err := parseExportFilter(input)
+	if err != nil {
+		showErrorAndWait(err)
+		return err
+	}
+
+	timeStr := time.Now().Format("20060102_150405")
+	defaultPath := filepath.Join(filepath.Dir(poolFile), fmt.Sprintf("mac_pool_%s.%s", timeStr, format))
+	fmt.Printf("Output file [%s]: ", defaultPath)
+	output, _ := reader.ReadString('\n')
+	output = strings.TrimSpace(output)
+	if output == "" {
+		output = defaultPath
+	}
+	if output == "-" {
+		showErrorAndWait(errors.New("export to stdout is available from the command line: -export FORMAT -file POOL"))
+		return nil
+	}
+	if _, err := os.Stat(output); err == nil && !getYesNoConfirmation(fmt.Sprintf("%s already exists. Overwrite?", output)) {
+		return nil
+	}
+
+	fmt.Println(colorYellow + plaintextWarning + colorReset)
+	if !getYesNoConfirmation("Continue with the export?") {
+		fmt.Println("Export cancelled.")
+		return nil
+	}
+
+	count, err := saveExport(output, pool, format, columns, filter)
+	if err != nil {
+		fmt.Println(colorRed+"Export failed:"+colorReset, err)
+		return err
+	}
+	fmt.Printf(colorGreen+"Exported %d MAC addresses to: %s\n"+colorReset, count, output)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpreadsheetCell(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"", ""},
+		{"00:E0:4C:00:00:01", "00:E0:4C:00:00:01"},
+		{"line 3 eth0", "line 3 eth0"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1-555-0100", "'+1-555-0100"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := spreadsheetCell(tt.value); got != tt.want {
+			t.Errorf("spreadsheetCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// exportTestPool возвращает пул с комментарием, который табличный редактор принял бы за формулу
+func exportTestPool() MACPool {
+	return MACPool{Addresses: []MACAddress{
+		{Address: "00:E0:4C:00:00:01", Used: true, State: stateUsed, UsedAt: time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local), UsedBy: "line3", Comment: "=cmd|'/c calc'!A1"},
+		{Address: "00:E0:4C:00:00:02"},
+		{Address: "00:E0:4C:00:00:03", Used: true, State: stateQuarantined, UsedBy: "-line4"},
+	}}
+}
+
+func TestWritePoolExport(t *testing.T) {
+	columns := []string{"address", "state", "used", "used_by", "comment"}
+
+	tests := []struct {
+		name   string
+		format string
+		filter string
+		count  int
+		want   string
+	}{
+		{
+			name:   "CSV escapes formulas",
+			format: exportCSV,
+			filter: "state=used,quarantined",
+			count:  2,
+			want: "address,state,used,used_by,comment\n" +
+				"00:E0:4C:00:00:01,used,true,line3,'=cmd|'/c calc'!A1\n" +
+				"00:E0:4C:00:00:03,quarantined,true,'-line4,\n",
+		},
+		{
+			name:   "JSON Lines keeps values as they are",
+			format: exportJSONL,
+			filter: "used-by=LINE since=2026-03-01 until=2026-03-01",
+			count:  1,
+			want:   `{"address":"00:E0:4C:00:00:01","state":"used","used":true,"used_by":"line3","comment":"=cmd|'/c calc'!A1"}` + "\n",
+		},
+		{
+			name:   "pattern filter",
+			format: exportCSV,
+			filter: "match=00:E0:4C:00:00:02",
+			count:  1,
+			want:   "address,state,used,used_by,comment\n00:E0:4C:00:00:02,free,false,,\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := parseExportFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("parseExportFilter: %v", err)
+			}
+			var buf bytes.Buffer
+			count, err := writePoolExport(&buf, exportTestPool(), tt.format, columns, filter)
+			if err != nil {
+				t.Fatalf("writePoolExport: %v", err)
+			}
+			if count != tt.count || buf.String() != tt.want {
+				t.Errorf("count = %d, output:\n%s\nwant %d:\n%s", count, buf.String(), tt.count, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteExportXLSXEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := writePoolExport(&buf, exportTestPool(), exportXLSX, []string{"address", "comment"}, ExportFilter{}); err != nil {
+		t.Fatalf("writePoolExport: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		sheet = string(data)
+	}
+	if !strings.Contains(sheet, `<c r="B2" t="inlineStr"><is><t xml:space="preserve">&#39;=cmd|&#39;/c calc&#39;!A1</t></is></c>`) {
+		t.Errorf("sheet does not contain the escaped comment:\n%s", sheet)
+	}
+}
+
+func TestParseExportOptions(t *testing.T) {
+	columns, err := parseExportColumns("address, 2 ,USED_BY")
+	if err != nil || !reflect.DeepEqual(columns, []string{"address", "state", "used_by"}) {
+		t.Errorf("parseExportColumns = %v, %v", columns, err)
+	}
+	for _, bad := range []string{"0", "address,mac", " , "} {
+		if _, err := parseExportColumns(bad); err == nil {
+			t.Errorf("parseExportColumns(%q) accepted", bad)
+		}
+	}
+	for _, bad := range []string{"state=burned", "since=01.03.2026", "owner=qa"} {
+		if _, err := parseExportFilter(bad); err == nil {
+			t.Errorf("parseExportFilter(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,776 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Поля записи пула, которые можно заполнить из колонок файла импорта
+const (
+	importAddress            = "address"
+	importState              = "state"
+	importUsed               = "used"
+	importUsedAt             = "used_at"
+	importUsedBy             = "used_by"
+	importComment            = "comment"
+	importReserved           = "reserved"
+	importReservationReason  = "reservation_reason"
+	importReservationOwner   = "reservation_owner"
+	importReservationExpires = "reservation_expires"
+)
+
+// importFields - поля импорта и названия колонок, которые сопоставляются им автоматически
+var importFields = []struct {
+	Name    string
+	Aliases []string
+}{
+	{importAddress, []string{"address", "mac", "mac_address", "macaddress", "assignment"}},
+	{importState, []string{"state", "status"}},
+	{importUsed, []string{"used", "is_used"}},
+	{importUsedAt, []string{"used_at", "usedat", "date_used", "assigned_at"}},
+	{importUsedBy, []string{"used_by", "usedby", "assigned_to", "host"}},
+	{importComment, []string{"comment", "comments", "note", "notes", "description"}},
+	{importReserved, []string{"reserved", "is_reserved"}},
+	{importReservationReason, []string{"reservation_reason", "reserve_reason", "reason"}},
+	{importReservationOwner, []string{"reservation_owner", "reserve_owner", "owner", "organization"}},
+	{importReservationExpires, []string{"reservation_expires_at", "reservation_expires", "reserve_expires", "expires_at", "expires"}},
+}
+
+// Действия над строкой импорта
+const (
+	importActionAdd       = "add"
+	importActionUpdate    = "update"
+	importActionUnchanged = "unchanged"
+	importActionSkip      = "skip"
+	importActionError     = "error"
+)
+
+// ImportTable - строки файла импорта: названия колонок и значения по колонкам
+type ImportTable struct {
+	Format  string
+	Columns []string
+	Rows    []map[string]string
+	Lines   []int // номер строки файла (CSV) или записи (JSON) для каждой строки
+}
+
+// ImportRow - результат проверки одной строки импорта
+type ImportRow struct {
+	Line     int
+	Address  string
+	Action   string
+	Index    int        // индекс адреса в пуле для обновления, -1 для нового
+	Entry    MACAddress // запись после импорта
+	Changes  []string
+	Problems []string // ошибки; строка с ошибками не импортируется
+	Warnings []string
+}
+
+// macWithoutSeparators - MAC-адрес без разделителей, как его выдают некоторые выгрузки
+var macWithoutSeparators = regexp.MustCompile(`^[0-9A-Fa-f]{12}$`)
+
+// normalizeImportMAC приводит MAC-адрес из файла к формату пула
+func normalizeImportMAC(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if macWithoutSeparators.MatchString(value) {
+		return formatMACWithColons(strings.ToUpper(value)), true
+	}
+	if !isMACValid(value) {
+		return "", false
+	}
+	return standardizeMACFormat(value), true
+}
+
+// normalizeColumnName приводит название колонки к виду, в котором записаны псевдонимы полей
+func normalizeColumnName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_", ".", "_").Replace(name)
+}
+
+// readImportFile читает CSV, JSON-массив, JSON Lines или пул в JSON ({"addresses": [...]})
+func readImportFile(path string) (ImportTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ImportTable{}, fmt.Errorf("failed to read file: %v", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return ImportTable{}, errors.New("file is empty")
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".json" || ext == ".jsonl" || ext == ".ndjson" || trimmed[0] == '[' || trimmed[0] == '{' {
+		return readImportJSON(trimmed)
+	}
+	return readImportCSV(data)
+}
+
+// readImportCSV читает CSV с заголовком. Разделитель (запятая, точка с запятой или табуляция)
+// определяется по первой строке. Файл без заголовка, где первая колонка - MAC-адрес,
+// читается как простой список адресов
+func readImportCSV(data []byte) (ImportTable, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = detectDelimiter(data)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	table := ImportTable{Format: "CSV"}
+	var header []string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ImportTable{}, fmt.Errorf("invalid CSV: %v", err)
+		}
+		line, _ := r.FieldPos(0)
+
+		if header == nil {
+			if _, ok := normalizeImportMAC(record[0]); ok {
+				// Заголовка нет, колонки нумеруются
+				header = make([]string, len(record))
+				for i := range header {
+					header[i] = fmt.Sprintf("column%d", i+1)
+				}
+			} else {
+				header = record
+				continue
+			}
+		}
+
+		row := make(map[string]string)
+		empty := true
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			row[header[i]] = value
+			if strings.TrimSpace(value) != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+		table.Rows = append(table.Rows, row)
+		table.Lines = append(table.Lines, line)
+	}
+	table.Columns = header
+	return table, nil
+}
+
+// detectDelimiter выбирает разделитель CSV по первой непустой строке, не являющейся комментарием
+func detectDelimiter(data []byte) rune {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		best, bestCount := ',', strings.Count(line, ",")
+		for _, d := range []rune{';', '\t'} {
+			if n := strings.Count(line, string(d)); n > bestCount {
+				best, bestCount = d, n
+			}
+		}
+		return best
+	}
+	return ','
+}
+
+// readImportJSON читает JSON-массив объектов, поток объектов (JSON Lines) или пул с полем addresses.
+// Вложенные объекты разворачиваются в колонки вида reservation.reason
+func readImportJSON(data []byte) (ImportTable, error) {
+	var objects []map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	for {
+		var value interface{}
+		if err := dec.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return ImportTable{}, fmt.Errorf("invalid JSON: %v", err)
+		}
+
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				obj, ok := item.(map[string]interface{})
+				if !ok {
+					return ImportTable{}, errors.New("invalid JSON: array items must be objects")
+				}
+				objects = append(objects, obj)
+			}
+		case map[string]interface{}:
+			if list, ok := v["addresses"].([]interface{}); ok {
+				for _, item := range list {
+					if obj, ok := item.(map[string]interface{}); ok {
+						objects = append(objects, obj)
+					}
+				}
+				continue
+			}
+			objects = append(objects, v)
+		default:
+			return ImportTable{}, errors.New("invalid JSON: expected objects with address fields")
+		}
+	}
+
+	table := ImportTable{Format: "JSON"}
+	seen := make(map[string]bool)
+	for i, obj := range objects {
+		row := make(map[string]string)
+		flattenJSON("", obj, row)
+		var keys []string
+		for key := range row {
+			if !seen[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			seen[key] = true
+			table.Columns = append(table.Columns, key)
+		}
+		table.Rows = append(table.Rows, row)
+		table.Lines = append(table.Lines, i+1)
+	}
+	return table, nil
+}
+
+// flattenJSON разворачивает вложенные объекты JSON в плоский набор колонок
+func flattenJSON(prefix string, obj map[string]interface{}, row map[string]string) {
+	for key, value := range obj {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenJSON(name, v, row)
+		case nil:
+			row[name] = ""
+		case string:
+			row[name] = v
+		case json.Number:
+			row[name] = v.String()
+		case bool:
+			row[name] = strconv.FormatBool(v)
+		default:
+			encoded, _ := json.Marshal(v)
+			row[name] = string(encoded)
+		}
+	}
+}
+
+// autoMapColumns сопоставляет колонки файла полям импорта по названиям.
+// Если колонка с адресом не найдена, берётся первая колонка, в которой встречаются MAC-адреса
+func autoMapColumns(table ImportTable) map[string]string {
+	mapping := make(map[string]string)
+	for _, field := range importFields {
+		for _, alias := range field.Aliases {
+			for _, column := range table.Columns {
+				if _, taken := mapping[field.Name]; !taken && normalizeColumnName(column) == alias {
+					mapping[field.Name] = column
+				}
+			}
+		}
+	}
+	if _, ok := mapping[importAddress]; !ok && len(table.Rows) > 0 {
+		for _, column := range table.Columns {
+			if _, ok := normalizeImportMAC(table.Rows[0][column]); ok {
+				mapping[importAddress] = column
+				break
+			}
+		}
+	}
+	return mapping
+}
+
+// printColumnMapping выводит сопоставление полей пула колонкам файла
+func printColumnMapping(table ImportTable, mapping map[string]string) {
+	fmt.Printf("\nColumns in file: %s\n", strings.Join(table.Columns, ", "))
+	fmt.Println("\nColumn mapping:")
+	for _, field := range importFields {
+		column := mapping[field.Name]
+		if column == "" {
+			column = "-"
+		}
+		fmt.Printf("  %-20s <- %s\n", field.Name, column)
+	}
+}
+
+// editColumnMapping позволяет поправить сопоставление колонок: field=column, field= снимает сопоставление
+func editColumnMapping(table ImportTable, mapping map[string]string, reader *bufio.Reader) error {
+	for {
+		printColumnMapping(table, mapping)
+		fmt.Print("\nChange mapping as field=column (field= to unmap), empty line to continue: ")
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if input == "" {
+			break
+		}
+
+		field, column, ok := strings.Cut(input, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		known := false
+		for _, f := range importFields {
+			if f.Name == field {
+				known = true
+			}
+		}
+		if !ok || !known {
+			fmt.Printf(colorYellow+"Unknown field %q\n"+colorReset, field)
+			continue
+		}
+		if column == "" {
+			delete(mapping, field)
+			continue
+		}
+		found := false
+		for _, c := range table.Columns {
+			if strings.EqualFold(c, column) {
+				mapping[field] = c
+				found = true
+			}
+		}
+		if !found {
+			fmt.Printf(colorYellow+"No column %q in file\n"+colorReset, column)
+		}
+	}
+	if mapping[importAddress] == "" {
+		return errors.New("no column is mapped to the MAC address")
+	}
+	return nil
+}
+
+// parseImportBool разбирает логическое значение колонки
+func parseImportBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "y", "x":
+		return true, nil
+	case "0", "false", "no", "n", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+// parseImportTime разбирает дату и время в форматах RFC 3339, "2006-01-02 15:04:05" и "2006-01-02"
+func parseImportTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", value)
+}
+
+// parseImportState разбирает состояние адреса. В pending адрес переводит только флешер
+func parseImportState(value string) (string, error) {
+	state := strings.ToLower(value)
+	switch state {
+	case "unused", "available":
+		state = stateFree
+	case "burned", "assigned":
+		state = stateUsed
+	}
+	for _, s := range manualStates {
+		if s == state {
+			return state, nil
+		}
+	}
+	if state == statePending {
+		return "", errors.New("pending can only be set by the flasher")
+	}
+	return "", fmt.Errorf("unknown state %q", value)
+}
+
+// validateImport проверяет строки импорта и сравнивает их с пулом. Пул не изменяется
+func validateImport(pool MACPool, table ImportTable, mapping map[string]string, updateExisting bool) []ImportRow {
+	inPool := make(map[string]int)
+	for i, addr := range pool.Addresses {
+		inPool[standardizeMACFormat(addr.Address)] = i
+	}
+	seen := make(map[string]int)
+
+	rows := make([]ImportRow, 0, len(table.Rows))
+	for n, values := range table.Rows {
+		get := func(field string) string {
+			column := mapping[field]
+			if column == "" {
+				return ""
+			}
+			return strings.TrimSpace(values[column])
+		}
+		row := ImportRow{Line: table.Lines[n], Index: -1, Address: get(importAddress)}
+		fail := func(format string, args ...interface{}) {
+			row.Problems = append(row.Problems, fmt.Sprintf(format, args...))
+		}
+
+		mac, ok := normalizeImportMAC(row.Address)
+		switch {
+		case row.Address == "":
+			fail("missing MAC address")
+		case !ok:
+			fail("invalid MAC address %q", row.Address)
+		default:
+			row.Address = mac
+			if line, dup := seen[mac]; dup {
+				fail("duplicate of line %d", line)
+			}
+			seen[mac] = row.Line
+		}
+
+		// Состояние: из колонки state, иначе по признаку used или наличию даты использования
+		state := ""
+		if value := get(importState); value != "" {
+			s, err := parseImportState(value)
+			if err != nil {
+				fail("%v", err)
+			}
+			state = s
+		} else if value := get(importUsed); value != "" {
+			used, err := parseImportBool(value)
+			if err != nil {
+				fail("used: %v", err)
+			}
+			state = stateFree
+			if used {
+				state = stateUsed
+			}
+		} else if get(importUsedAt) != "" {
+			state = stateUsed
+		}
+
+		var usedAt time.Time
+		if value := get(importUsedAt); value != "" {
+			t, err := parseImportTime(value)
+			if err != nil {
+				fail("used_at: %v", err)
+			}
+			usedAt = t
+		}
+		usedBy := get(importUsedBy)
+		comment := get(importComment)
+
+		var reservation *Reservation
+		reserved := get(importReservationReason) != "" || get(importReservationOwner) != ""
+		if value := get(importReserved); value != "" {
+			r, err := parseImportBool(value)
+			if err != nil {
+				fail("reserved: %v", err)
+			}
+			reserved = r
+		}
+		if reserved {
+			reservation = &Reservation{
+				Reason:     get(importReservationReason),
+				Owner:      get(importReservationOwner),
+				ReservedAt: time.Now(),
+				ReservedBy: os.Getenv("USER"),
+			}
+			if value := get(importReservationExpires); value != "" {
+				t, err := parseImportTime(value)
+				if err != nil {
+					fail("reservation_expires: %v", err)
+				} else if t.Before(time.Now()) {
+					row.Warnings = append(row.Warnings, "reservation has already expired")
+				}
+				reservation.ExpiresAt = t
+			}
+		}
+
+		if len(row.Problems) > 0 {
+			row.Action = importActionError
+			rows = append(rows, row)
+			continue
+		}
+
+		idx, exists := inPool[row.Address]
+		switch {
+		case !exists:
+			if state == "" {
+				state = stateFree
+			}
+			row.Action = importActionAdd
+			row.Entry = MACAddress{Address: row.Address, State: state, Used: state != stateFree, Comment: comment}
+			row.Changes = append(row.Changes, "state "+state)
+		case !updateExisting:
+			row.Action = importActionSkip
+			row.Warnings = append(row.Warnings, "already in pool")
+			rows = append(rows, row)
+			continue
+		default:
+			row.Index = idx
+			row.Entry = pool.Addresses[idx]
+			from := addressState(row.Entry)
+			if state != "" && state != from {
+				// Возврат записанного адреса в свободные - это сброс, он проходит отдельные проверки
+				if state == stateFree && wasBurned(row.Entry) {
+					fail("%s address cannot be made free by import, use Reset MAC address status", from)
+				} else if err := setAddressState(&row.Entry, state); err != nil {
+					fail("%v", err)
+				} else {
+					row.Changes = append(row.Changes, fmt.Sprintf("state %s -> %s", from, state))
+				}
+			}
+			if comment != "" && comment != row.Entry.Comment {
+				row.Changes = append(row.Changes, fmt.Sprintf("comment %q -> %q", row.Entry.Comment, comment))
+				row.Entry.Comment = comment
+			}
+		}
+		if len(row.Problems) > 0 {
+			row.Action = importActionError
+			rows = append(rows, row)
+			continue
+		}
+
+		// История использования и резервирование имеют смысл только для подходящих состояний
+		final := addressState(row.Entry)
+		if !usedAt.IsZero() || usedBy != "" {
+			if final == stateFree {
+				row.Warnings = append(row.Warnings, "usage history ignored for a free address")
+			} else {
+				if !usedAt.IsZero() && !usedAt.Equal(row.Entry.UsedAt) {
+					if exists {
+						row.Changes = append(row.Changes, fmt.Sprintf("used_at %s -> %s", formatImportTime(row.Entry.UsedAt), formatImportTime(usedAt)))
+					} else {
+						row.Changes = append(row.Changes, "used_at "+formatImportTime(usedAt))
+					}
+					row.Entry.UsedAt = usedAt
+				}
+				if usedBy != "" && usedBy != row.Entry.UsedBy {
+					if exists {
+						row.Changes = append(row.Changes, fmt.Sprintf("used_by %q -> %q", row.Entry.UsedBy, usedBy))
+					} else {
+						row.Changes = append(row.Changes, "used_by "+usedBy)
+					}
+					row.Entry.UsedBy = usedBy
+				}
+			}
+		}
+		if final == stateUsed && row.Entry.UsedAt.IsZero() {
+			row.Warnings = append(row.Warnings, "used address without used_at")
+		}
+		if reservation != nil {
+			if final != stateFree {
+				row.Warnings = append(row.Warnings, fmt.Sprintf("reservation ignored for a %s address", final))
+			} else {
+				if exists && row.Entry.Reservation != nil {
+					reservation.ReservedAt = row.Entry.Reservation.ReservedAt
+					reservation.ReservedBy = row.Entry.Reservation.ReservedBy
+				}
+				if !exists || reservationSummary(row.Entry) != reservationSummary(MACAddress{Reserved: true, Reservation: reservation}) {
+					row.Changes = append(row.Changes, "reserved "+reservationSummary(MACAddress{Reserved: true, Reservation: reservation}))
+				}
+				row.Entry.Reserved = true
+				row.Entry.Reservation = reservation
+			}
+		}
+
+		if exists {
+			row.Action = importActionUpdate
+			if len(row.Changes) == 0 {
+				row.Action = importActionUnchanged
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// formatImportTime выводит время для предпросмотра импорта
+func formatImportTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// countImportActions считает строки импорта по действиям
+func countImportActions(rows []ImportRow) map[string]int {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row.Action]++
+	}
+	return counts
+}
+
+// printImportPreview выводит итоги проверки и изменения, которые внесёт импорт
+func printImportPreview(rows []ImportRow, limit int) {
+	counts := countImportActions(rows)
+	fmt.Println("\nImport preview (dry run, the pool is not changed yet):")
+	fmt.Printf(colorGreen+"  To add:     %d\n"+colorReset, counts[importActionAdd])
+	fmt.Printf(colorGreen+"  To update:  %d\n"+colorReset, counts[importActionUpdate])
+	fmt.Printf("  Unchanged:  %d\n", counts[importActionUnchanged])
+	fmt.Printf(colorYellow+"  Skipped:    %d\n"+colorReset, counts[importActionSkip])
+	fmt.Printf(colorRed+"  Errors:     %d\n"+colorReset, counts[importActionError])
+
+	shown := 0
+	for _, row := range rows {
+		if row.Action == importActionUnchanged && len(row.Warnings) == 0 {
+			continue
+		}
+		if shown == limit {
+			fmt.Printf("  ... and more, save the validation report to see all rows\n")
+			break
+		}
+		shown++
+		if shown == 1 {
+			fmt.Println()
+		}
+
+		address := row.Address
+		if address == "" {
+			address = "-"
+		}
+		switch row.Action {
+		case importActionAdd:
+			fmt.Printf(colorGreen+"  + line %d %s: %s\n"+colorReset, row.Line, address, strings.Join(row.Changes, ", "))
+		case importActionUpdate:
+			fmt.Printf(colorGreen+"  ~ line %d %s: %s\n"+colorReset, row.Line, address, strings.Join(row.Changes, ", "))
+		case importActionError:
+			fmt.Printf(colorRed+"  ! line %d %s: %s\n"+colorReset, row.Line, address, strings.Join(row.Problems, "; "))
+		default:
+			fmt.Printf(colorYellow+"  - line %d %s: %s\n"+colorReset, row.Line, address, row.Action)
+		}
+		for _, w := range row.Warnings {
+			fmt.Printf(colorYellow+"      warning: %s\n"+colorReset, w)
+		}
+	}
+}
+
+// writeImportReport сохраняет построчный отчёт проверки импорта в CSV
+func writeImportReport(path string, rows []ImportRow) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %v", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"line", "address", "action", "changes", "errors", "warnings"})
+	for _, row := range rows {
+		w.Write([]string{
+			strconv.Itoa(row.Line),
+			row.Address,
+			row.Action,
+			strings.Join(row.Changes, "; "),
+			strings.Join(row.Problems, "; "),
+			strings.Join(row.Warnings, "; "),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return nil
+}
+
+// applyImport вносит проверенные строки в пул. Возвращает число добавленных и обновлённых адресов
+func applyImport(pool *MACPool, rows []ImportRow) (added, updated int) {
+	for _, row := range rows {
+		switch row.Action {
+		case importActionAdd:
+			pool.Addresses = append(pool.Addresses, row.Entry)
+			added++
+		case importActionUpdate:
+			pool.Addresses[row.Index] = row.Entry
+			updated++
+		}
+	}
+	return added, updated
+}
+
+// importFromFile импортирует адреса из CSV или JSON с состоянием, комментариями, резервированием
+// и историей использования: сопоставление колонок, предпросмотр изменений и отчёт по строкам
+func importFromFile(pool MACPool, password, poolFile string) error {
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Print("Enter path to CSV or JSON file: ")
+	path, _ := reader.ReadString('\n')
+	path = strings.TrimSpace(path)
+	if path == "" {
+		fmt.Println("Operation cancelled.")
+		return nil
+	}
+
+	table, err := readImportFile(path)
+	if err != nil {
+		fmt.Println(colorRed+"Error reading file:"+colorReset, err)
+		return err
+	}
+	if len(table.Rows) == 0 {
+		fmt.Println(colorYellow + "No rows to import." + colorReset)
+		return nil
+	}
+	fmt.Printf("\nRead %d %s row(s) from %s\n", len(table.Rows), table.Format, path)
+
+	mapping := autoMapColumns(table)
+	if err := editColumnMapping(table, mapping, reader); err != nil {
+		fmt.Println(colorRed+"Import cancelled:"+colorReset, err)
+		return err
+	}
+
+	updateExisting := getYesNoConfirmation("Update addresses that are already in the pool?")
+
+	rows := validateImport(pool, table, mapping, updateExisting)
+	printImportPreview(rows, 50)
+
+	counts := countImportActions(rows)
+	if counts[importActionError] > 0 || counts[importActionSkip] > 0 {
+		fmt.Print("\nSave validation report to (CSV path, empty to skip): ")
+		reportPath, _ := reader.ReadString('\n')
+		if reportPath = strings.TrimSpace(reportPath); reportPath != "" {
+			if err := writeImportReport(reportPath, rows); err != nil {
+				fmt.Println(colorRed+"Failed to save report:"+colorReset, err)
+			} else {
+				fmt.Printf(colorGreen+"Validation report saved to %s\n"+colorReset, reportPath)
+			}
+		}
+	}
+
+	if counts[importActionAdd]+counts[importActionUpdate] == 0 {
+		fmt.Println(colorYellow + "\nNothing to import." + colorReset)
+		return nil
+	}
+	prompt := fmt.Sprintf("Apply import (%d to add, %d to update", counts[importActionAdd], counts[importActionUpdate])
+	if counts[importActionError] > 0 {
+		prompt += fmt.Sprintf(", %d rows with errors are left out", counts[importActionError])
+	}
+	if !getYesNoConfirmation(prompt + ")?") {
+		fmt.Println("Operation cancelled.")
+		return nil
+	}
+
+	added, updated := applyImport(&pool, rows)
+	pool.LastUpdated = time.Now()
+
+	// Обновляем HMAC подпись
+	signPool(&pool, password)
+
+	if err := saveEncryptedPool(pool, password, poolFile); err != nil {
+		fmt.Println(colorRed+"Failed to save pool:"+colorReset, err)
+		return err
+	}
+	fmt.Printf(colorGreen+"Imported %d new and updated %d existing MAC addresses.\n"+colorReset, added, updated)
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// importTestPool возвращает пул, с которым сравниваются строки импорта
+func importTestPool() MACPool {
+	usedAt := time.Date(2026, 2, 1, 9, 0, 0, 0, time.Local)
+	return MACPool{Addresses: []MACAddress{
+		{Address: "00:E0:4C:00:00:01"},
+		{Address: "00:E0:4C:00:00:02", Used: true, State: stateUsed, UsedAt: usedAt, UsedBy: "host-a"},
+		{Address: "00:E0:4C:00:00:03", Used: true, State: stateUsed, UsedAt: usedAt},
+		{Address: "00:E0:4C:00:00:04", Used: true, State: stateUsed, UsedAt: usedAt},
+		{Address: "00:E0:4C:00:00:05"},
+	}}
+}
+
+const importTestCSV = `MAC;Status;Used At;Used By;Comment;Reason;Owner
+00e04c000010;unused;;;spare board;;
+00-e0-4c-00-00-11;burned;2026-03-01 09:00:00;host-b;;;
+00:E0:4C:00:00:01;used;2026-03-01;;;;
+00:E0:4C:00:00:02;used;;;;;
+00:e0:4c:00:00:02;used;;;;;
+00:E0:4C:00:00:03;free;;;;;
+00:E0:4C:00:00:04;retired;;;;;
+00:E0:4C:00:00:05;;;;;lab;qa
+zz:zz;;;;;;
+;pending;;;;;
+00:E0:4C:00:00:12;pending;;;;;
+00:E0:4C:00:00:13;free;2026-03-01;host-c;;;
+`
+
+func TestReadImportFile(t *testing.T) {
+	table, err := readImportCSV([]byte(importTestCSV))
+	if err != nil {
+		t.Fatalf("readImportCSV: %v", err)
+	}
+	if len(table.Rows) != 12 || table.Lines[0] != 2 || table.Lines[11] != 13 {
+		t.Fatalf("rows/lines = %d/%v", len(table.Rows), table.Lines)
+	}
+	want := map[string]string{
+		importAddress:           "MAC",
+		importState:             "Status",
+		importUsedAt:            "Used At",
+		importUsedBy:            "Used By",
+		importComment:           "Comment",
+		importReservationReason: "Reason",
+		importReservationOwner:  "Owner",
+	}
+	if mapping := autoMapColumns(table); !reflect.DeepEqual(mapping, want) {
+		t.Errorf("mapping = %v, want %v", mapping, want)
+	}
+
+	// Список адресов без заголовка: колонка с адресами находится по значениям
+	plain, err := readImportCSV([]byte("00:E0:4C:00:00:20,first\n# comment\n00:E0:4C:00:00:21,second\n"))
+	if err != nil {
+		t.Fatalf("readImportCSV: %v", err)
+	}
+	if len(plain.Rows) != 2 || autoMapColumns(plain)[importAddress] != "column1" {
+		t.Errorf("headerless CSV = %+v", plain)
+	}
+
+	// Пул в JSON: вложенные объекты разворачиваются в колонки
+	pool, err := readImportJSON([]byte(`{"addresses":[{"address":"00:E0:4C:00:00:30","reservation":{"reason":"lab"}}]}`))
+	if err != nil {
+		t.Fatalf("readImportJSON: %v", err)
+	}
+	if !reflect.DeepEqual(pool.Columns, []string{"address", "reservation.reason"}) {
+		t.Errorf("JSON columns = %v", pool.Columns)
+	}
+	lines, err := readImportJSON([]byte("{\"mac\":\"00:E0:4C:00:00:31\",\"used\":true}\n{\"mac\":\"00:E0:4C:00:00:32\",\"used\":false}\n"))
+	if err != nil || len(lines.Rows) != 2 || lines.Rows[0]["used"] != "true" {
+		t.Errorf("JSON Lines = %+v, %v", lines, err)
+	}
+}
+
+func TestValidateImport(t *testing.T) {
+	table, err := readImportCSV([]byte(importTestCSV))
+	if err != nil {
+		t.Fatalf("readImportCSV: %v", err)
+	}
+	rows := validateImport(importTestPool(), table, autoMapColumns(table), true)
+
+	tests := []struct {
+		line    int
+		action  string
+		address string
+		detail  string // фрагмент изменений, ошибок или предупреждений
+	}{
+		{2, importActionAdd, "00:E0:4C:00:00:10", "state free"},
+		{3, importActionAdd, "00:E0:4C:00:00:11", "used_by host-b"},
+		{4, importActionError, "00:E0:4C:00:00:01", "transition from free to used is not allowed"},
+		{5, importActionUnchanged, "00:E0:4C:00:00:02", ""},
+		{6, importActionError, "00:E0:4C:00:00:02", "duplicate of line 5"},
+		{7, importActionError, "00:E0:4C:00:00:03", "cannot be made free by import"},
+		{8, importActionUpdate, "00:E0:4C:00:00:04", "state used -> retired"},
+		{9, importActionUpdate, "00:E0:4C:00:00:05", "reserved lab, owner qa"},
+		{10, importActionError, "zz:zz", "invalid MAC address"},
+		{11, importActionError, "", "missing MAC address"},
+		{12, importActionError, "00:E0:4C:00:00:12", "pending can only be set by the flasher"},
+		{13, importActionAdd, "00:E0:4C:00:00:13", "usage history ignored for a free address"},
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(tests))
+	}
+	for i, tt := range tests {
+		row := rows[i]
+		if row.Line != tt.line || row.Action != tt.action || row.Address != tt.address {
+			t.Errorf("row %d = line %d %s %q, want line %d %s %q", i, row.Line, row.Action, row.Address, tt.line, tt.action, tt.address)
+			continue
+		}
+		details := strings.Join(append(append(append([]string(nil), row.Changes...), row.Problems...), row.Warnings...), "; ")
+		if !strings.Contains(details, tt.detail) {
+			t.Errorf("line %d details = %q, want them to contain %q", tt.line, details, tt.detail)
+		}
+	}
+
+	used := rows[1].Entry
+	if addressState(used) != stateUsed || !used.UsedAt.Equal(time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local)) {
+		t.Errorf("added used address = %+v", used)
+	}
+}
+
+func TestValidateImportWithoutUpdates(t *testing.T) {
+	table, err := readImportCSV([]byte("address,state\n00:E0:4C:00:00:04,retired\n00:E0:4C:00:00:40,used\n"))
+	if err != nil {
+		t.Fatalf("readImportCSV: %v", err)
+	}
+	rows := validateImport(importTestPool(), table, autoMapColumns(table), false)
+
+	if rows[0].Action != importActionSkip || rows[1].Action != importActionAdd {
+		t.Fatalf("actions = %s, %s, want skip, add", rows[0].Action, rows[1].Action)
+	}
+	// Адрес без даты использования добавляется с предупреждением
+	if !reflect.DeepEqual(rows[1].Warnings, []string{"used address without used_at"}) {
+		t.Errorf("warnings = %v", rows[1].Warnings)
+	}
+}
+
+func TestImportDryRunKeepsPool(t *testing.T) {
+	table, err := readImportCSV([]byte(importTestCSV))
+	if err != nil {
+		t.Fatalf("readImportCSV: %v", err)
+	}
+	pool := importTestPool()
+	rows := validateImport(pool, table, autoMapColumns(table), true)
+
+	if !reflect.DeepEqual(pool, importTestPool()) {
+		t.Fatal("validateImport changed the pool")
+	}
+	counts := countImportActions(rows)
+	want := map[string]int{importActionAdd: 3, importActionUpdate: 2, importActionUnchanged: 1, importActionError: 6}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+
+	added, updated := applyImport(&pool, rows)
+	if added != 3 || updated != 2 || len(pool.Addresses) != 8 {
+		t.Fatalf("added/updated = %d/%d, pool size %d", added, updated, len(pool.Addresses))
+	}
+	if addressState(pool.Addresses[0]) != stateFree || addressState(pool.Addresses[2]) != stateUsed {
+		t.Error("rows with errors were applied")
+	}
+	if addressState(pool.Addresses[3]) != stateRetired || !pool.Addresses[4].Reserved {
+		t.Errorf("updates not applied: %+v, %+v", pool.Addresses[3], pool.Addresses[4])
+	}
+}
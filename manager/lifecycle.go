@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Состояния адреса в пуле. MAC Flasher выдаёт только свободные адреса
+const (
+	stateFree        = "free"        // можно выдавать
+	statePending     = "pending"     // выдан флешеру, прошивка не завершена
+	stateUsed        = "used"        // записан в плату
+	stateRetired     = "retired"     // плата списана, адрес больше не выдаётся
+	stateQuarantined = "quarantined" // судьба адреса неизвестна, требуется проверка
+	stateDefective   = "defective"   // плата с адресом неисправна
+)
+
+// addressStates - состояния в порядке жизненного цикла для вывода статистики
+var addressStates = []string{stateFree, statePending, stateUsed, stateRetired, stateQuarantined, stateDefective}
+
+// manualStates - состояния, которые можно назначить вручную; в pending адрес переводит только флешер
+var manualStates = []string{stateFree, stateUsed, stateRetired, stateQuarantined, stateDefective}
+
+// allowedTransitions - разрешённые переходы между состояниями. Те же правила проверяет MAC Flasher
+var allowedTransitions = map[string][]string{
+	stateFree:        {statePending, stateRetired, stateQuarantined},
+	statePending:     {stateUsed, stateFree, stateQuarantined},
+	stateUsed:        {stateRetired, stateQuarantined, stateDefective, stateFree},
+	stateQuarantined: {stateFree, stateUsed, stateRetired, stateDefective},
+	stateDefective:   {stateRetired, stateQuarantined},
+	stateRetired:     {},
+}
+
+// addressState возвращает состояние адреса. Пулы без поля state хранят только признак Used
+func addressState(addr MACAddress) string {
+	if addr.State != "" {
+		return addr.State
+	}
+	if addr.Used {
+		return stateUsed
+	}
+	return stateFree
+}
+
+// canTransition проверяет, разрешён ли переход между состояниями
+func canTransition(from, to string) bool {
+	for _, s := range allowedTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// setAddressState переводит адрес в новое состояние, если переход разрешён. Признак Used
+// остаётся установленным для всех состояний, кроме свободного: старые версии флешера смотрят только на него
+func setAddressState(addr *MACAddress, to string) error {
+	from := addressState(*addr)
+	if from == to {
+		return nil
+	}
+	if !canTransition(from, to) {
+		return fmt.Errorf("%s: transition from %s to %s is not allowed", addr.Address, from, to)
+	}
+	addr.State = to
+	addr.Used = to != stateFree
+	if to == stateFree {
+		addr.UsedAt = time.Time{}
+		addr.UsedBy = ""
+	}
+	return nil
+}
+
+// wasBurned проверяет, мог ли адрес уже оказаться в железе
+func wasBurned(addr MACAddress) bool {
+	switch addressState(addr) {
+	case stateUsed, stateQuarantined, stateDefective:
+		return true
+	}
+	return addr.Binding != nil
+}
+
+// countAddressStates считает адреса по состояниям; свободные зарезервированные адреса считаются отдельно
+func countAddressStates(pool MACPool) (counts map[string]int, reserved int) {
+	counts = make(map[string]int)
+	for _, addr := range pool.Addresses {
+		state := addressState(addr)
+		if state == stateFree && isReserved(addr) {
+			reserved++
+			continue
+		}
+		counts[state]++
+	}
+	return counts, reserved
+}
+
+// stateLabel возвращает название состояния для вывода
+func stateLabel(state string) string {
+	return strings.ToUpper(state[:1]) + state[1:]
+}
+
+// stateColor возвращает цвет состояния для вывода
+func stateColor(state string) string {
+	switch state {
+	case stateUsed:
+		return colorGreen
+	case statePending, stateQuarantined:
+		return colorYellow
+	case stateRetired, stateDefective:
+		return colorRed
+	}
+	return colorReset
+}
+
+// confirmReleaseBurned предупреждает перед возвратом в оборот адресов, которые могли быть записаны в платы
+func confirmReleaseBurned(pool MACPool, indices []int) bool {
+	var burned []string
+	for _, idx := range indices {
+		if wasBurned(pool.Addresses[idx]) {
+			burned = append(burned, pool.Addresses[idx].Address)
+		}
+	}
+	if len(burned) == 0 {
+		return true
+	}
+
+	fmt.Printf(colorRed+"\nWARNING: %d address(es) may already be written to boards:\n"+colorReset, len(burned))
+	for i, mac := range burned {
+		if i == 10 {
+			fmt.Printf("  ... and %d more\n", len(burned)-10)
+			break
+		}
+		fmt.Println("  " + mac)
+	}
+	fmt.Println(colorRed + "Making them free lets the flasher assign the same MAC to another board," + colorReset)
+	fmt.Println(colorRed + "which causes duplicate addresses on the network if the original board is still in use." + colorReset)
+	return getYesNoConfirmation("Make these addresses free anyway?")
+}
+
+// changeAddressStates переводит выбранные адреса в другое состояние жизненного цикла
+func changeAddressStates(poolFile string) error {
+	pool, password, err := loadAndDecryptPool(poolFile)
+	if err != nil {
+		fmt.Println(colorRed+"Failed to load MAC pool:"+colorReset, err)
+		waitForEnter("")
+		return err
+	}
+
+	clearScreen()
+	showHeader()
+	fmt.Println("Change Address Lifecycle State")
+	fmt.Println()
+	counts, reserved := countAddressStates(pool)
+	for _, state := range addressStates {
+		fmt.Printf("  %s%-12s%s %d\n", stateColor(state), stateLabel(state), colorReset, counts[state])
+	}
+	fmt.Printf("  %-12s %d\n", "Reserved", reserved)
+
+	reader := bufio.NewReader(os.Stdin)
+	indices, err := selectAddresses(pool, reader, false)
+	if err != nil {
+		showErrorAndWait(err)
+		return err
+	}
+	if len(indices) == 0 {
+		return nil
+	}
+
+	fmt.Println("\nNew state:")
+	for i, state := range manualStates {
+		fmt.Printf("%d. %s\n", i+1, stateLabel(state))
+	}
+	fmt.Println("0. Cancel")
+	fmt.Print("\nSelect option: ")
+	choice, _ := reader.ReadString('\n')
+	choice = strings.TrimSpace(choice)
+	if choice == "0" || choice == "" {
+		return nil
+	}
+	var target string
+	for i, state := range manualStates {
+		if choice == fmt.Sprint(i+1) {
+			target = state
+		}
+	}
+	if target == "" {
+		showErrorAndWait(fmt.Errorf("invalid option %q", choice))
+		return nil
+	}
+
+	// Отбираем адреса, для которых переход разрешён
+	var allowed []int
+	rejected := make(map[string]int)
+	for _, idx := range indices {
+		from := addressState(pool.Addresses[idx])
+		if from == target {
+			continue
+		}
+		if !canTransition(from, target) {
+			rejected[from]++
+			continue
+		}
+		allowed = append(allowed, idx)
+	}
+	for from, n := range rejected {
+		fmt.Printf(colorYellow+"Skipping %d %s address(es): %s -> %s is not allowed\n"+colorReset, n, from, from, target)
+	}
+	if len(allowed) == 0 {
+		fmt.Println(colorYellow + "No addresses to change." + colorReset)
+		waitForEnter("")
+		return nil
+	}
+
+	// Возврат в свободные проходит те же проверки, что и сброс адресов
+	var event *PoolEvent
+	if target == stateFree {
+		allowed, event, err = guardReset(pool, allowed, reader)
+		if err != nil {
+			showErrorAndWait(err)
+			return err
+		}
+		if event == nil {
+			fmt.Println("Operation cancelled.")
+			waitForEnter("")
+			return nil
+		}
+	}
+	if !getYesNoConfirmation(fmt.Sprintf("Change %d address(es) to %s", len(allowed), target)) {
+		return nil
+	}
+
+	fmt.Print("Comment (optional, empty keeps the current one): ")
+	comment, _ := reader.ReadString('\n')
+	comment = strings.TrimSpace(comment)
+
+	for _, idx := range allowed {
+		if err := setAddressState(&pool.Addresses[idx], target); err != nil {
+			showErrorAndWait(err)
+			return err
+		}
+		if comment != "" {
+			pool.Addresses[idx].Comment = comment
+		}
+		if event != nil {
+			event.Addresses = append(event.Addresses, pool.Addresses[idx].Address)
+		}
+	}
+	if event != nil {
+		journalEvent(&pool, *event)
+	}
+
+	pool.LastUpdated = time.Now()
+	signPool(&pool, password)
+	if err := saveEncryptedPool(pool, password, poolFile); err != nil {
+		fmt.Println(colorRed+"Failed to save pool:"+colorReset, err)
+		waitForEnter("")
+		return err
+	}
+	fmt.Printf(colorGreen+"Changed %d address(es) to %s.\n"+colorReset, len(allowed), target)
+	waitForEnter("")
+	return nil
+}
+
+// lifecycleStates - состояния помимо свободного и использованного, выводятся в статистике, если встречаются
+var lifecycleStates = []string{statePending, stateRetired, stateQuarantined, stateDefective}
+
+// addressStatusText описывает состояние адреса для текстовых списков
+func addressStatusText(addr MACAddress) string {
+	state := addressState(addr)
+	status := "Unused"
+	switch state {
+	case stateFree:
+	case stateUsed:
+		status = fmt.Sprintf("Used at %s", addr.UsedAt.Format("2006-01-02 15:04:05"))
+		if addr.UsedBy != "" {
+			status += fmt.Sprintf(" by %s", addr.UsedBy)
+		}
+	default:
+		status = stateLabel(state)
+		if addr.UsedBy != "" {
+			status += fmt.Sprintf(" (used by %s)", addr.UsedBy)
+		}
+	}
+	return status
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Результаты проверки подписи лога
+const (
+	logVerified   = "VERIFIED"
+	logUnsigned   = "UNSIGNED"
+	logUnknownKey = "UNKNOWN KEY"
+	logTampered   = "INVALID"
+	logUnreadable = "ERROR"
+)
+
+// LogSignature - подпись лога ключом станции, как её записывает MAC Flasher
+type LogSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+	Value     string `json:"value"`
+}
+
+// signedLogFields - поля лога, которые выводятся в отчёте о проверке
+type signedLogFields struct {
+	Timestamp       string        `json:"timestamp"`
+	MacAddress      string        `json:"mac_address"`
+	ActionPerformed string        `json:"action_performed"`
+	Success         bool          `json:"success"`
+	PoolHashBefore  string        `json:"pool_hash_before"`
+	PoolHashAfter   string        `json:"pool_hash_after"`
+	Signature       *LogSignature `json:"signature"`
+}
+
+// LogVerification - результат проверки одного лога
+type LogVerification struct {
+	Path   string
+	Status string
+	Detail string
+	Log    signedLogFields
+}
+
+// stationKeyID возвращает короткий идентификатор открытого ключа, как в MAC Flasher
+func stationKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// poolStateHash возвращает SHA-256 пула, с которым сравниваются хэши из логов
+func poolStateHash(pool MACPool) string {
+	data, err := json.Marshal(pool)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalLogPayload возвращает подписываемые данные лога: объект верхнего уровня без поля signature
+func canonicalLogPayload(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "signature")
+	return json.Marshal(fields)
+}
+
+// loadStationKeys читает доверенные открытые ключи станций из файла .pub или каталога с такими файлами
+func loadStationKeys(path string) (map[string]ed25519.PublicKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access station keys: %v", err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.pub"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make(map[string]ed25519.PublicKey)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("%s is not a PEM encoded public key", file)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", file, err)
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an Ed25519 key", file)
+		}
+		keys[stationKeyID(pub)] = pub
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no station public keys found in %s", path)
+	}
+	return keys, nil
+}
+
+// collectLogFiles возвращает файлы логов: сам файл или все *.json в каталоге и подкаталогах
+func collectLogFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && strings.HasSuffix(d.Name(), ".json") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// verifyLogFile проверяет подпись лога по доверенным ключам станций
+func verifyLogFile(path string, keys map[string]ed25519.PublicKey) LogVerification {
+	result := LogVerification{Path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		result.Status, result.Detail = logUnreadable, err.Error()
+		return result
+	}
+	if err := json.Unmarshal(data, &result.Log); err != nil {
+		result.Status, result.Detail = logUnreadable, "not a valid log: "+err.Error()
+		return result
+	}
+
+	sig := result.Log.Signature
+	if sig == nil {
+		result.Status, result.Detail = logUnsigned, "log has no signature"
+		return result
+	}
+	if sig.Algorithm != "ed25519" {
+		result.Status, result.Detail = logTampered, fmt.Sprintf("unsupported signature algorithm %q", sig.Algorithm)
+		return result
+	}
+	// Открытый ключ из самого лога не используется: его мог подменить тот, кто изменил лог
+	pub, ok := keys[sig.KeyID]
+	if !ok {
+		result.Status, result.Detail = logUnknownKey, "signed by untrusted key "+sig.KeyID
+		return result
+	}
+
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		result.Status, result.Detail = logTampered, "malformed signature"
+		return result
+	}
+	payload, err := canonicalLogPayload(data)
+	if err != nil {
+		result.Status, result.Detail = logUnreadable, err.Error()
+		return result
+	}
+	if !ed25519.Verify(pub, payload, value) {
+		result.Status, result.Detail = logTampered, "signature does not match log contents"
+		return result
+	}
+
+	result.Status, result.Detail = logVerified, "key "+sig.KeyID
+	return result
+}
+
+// verifyLogs проверяет все логи по указанному пути
+func verifyLogs(logsPath string, keys map[string]ed25519.PublicKey) ([]LogVerification, error) {
+	files, err := collectLogFiles(logsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logs: %v", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .json logs found in %s", logsPath)
+	}
+
+	results := make([]LogVerification, 0, len(files))
+	for _, file := range files {
+		results = append(results, verifyLogFile(file, keys))
+	}
+	return results, nil
+}
+
+// printLogVerification выводит отчёт о проверке. Если известен хэш текущего пула, отмечаются логи,
+// после которых пул больше не изменялся. Возвращает true, если все логи подписаны доверенными ключами
+func printLogVerification(results []LogVerification, currentPoolHash string) bool {
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Status]++
+
+		color := colorGreen
+		switch r.Status {
+		case logUnsigned, logUnknownKey:
+			color = colorYellow
+		case logTampered, logUnreadable:
+			color = colorRed
+		}
+		fmt.Printf("%s%-11s%s %s\n", color, r.Status, colorReset, r.Path)
+		fmt.Printf("            %s\n", r.Detail)
+		if r.Status == logUnreadable {
+			continue
+		}
+
+		result := "failed"
+		if r.Log.Success {
+			result = "success"
+		}
+		fmt.Printf("            %s  %s  %s (%s)\n", r.Log.Timestamp, r.Log.MacAddress, r.Log.ActionPerformed, result)
+		if r.Log.PoolHashBefore != "" || r.Log.PoolHashAfter != "" {
+			fmt.Printf("            pool %s -> %s", shortHash(r.Log.PoolHashBefore), shortHash(r.Log.PoolHashAfter))
+			if currentPoolHash != "" && r.Log.PoolHashAfter == currentPoolHash {
+				fmt.Print(colorCyan + "  (current pool state)" + colorReset)
+			}
+			fmt.Println()
+		}
+	}
+
+	fmt.Printf("\nChecked %d log(s): %d verified, %d unsigned, %d unknown key, %d invalid, %d unreadable\n",
+		len(results), counts[logVerified], counts[logUnsigned], counts[logUnknownKey], counts[logTampered], counts[logUnreadable])
+	return counts[logVerified] == len(results)
+}
+
+// shortHash сокращает хэш для вывода
+func shortHash(hash string) string {
+	if hash == "" {
+		return "-"
+	}
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// runVerifyLogsCommand проверяет логи без интерактивного меню и возвращает код завершения
+func runVerifyLogsCommand(logsPath, keysPath string) int {
+	if keysPath == "" {
+		fmt.Fprintln(os.Stderr, "-station-keys is required with -verify-logs")
+		return 2
+	}
+	keys, err := loadStationKeys(keysPath)
+	if err != nil {
+		fmt.Println(colorRed+"Error:"+colorReset, err)
+		return 1
+	}
+	results, err := verifyLogs(logsPath, keys)
+	if err != nil {
+		fmt.Println(colorRed+"Error:"+colorReset, err)
+		return 1
+	}
+	if !printLogVerification(results, "") {
+		return 1
+	}
+	return 0
+}
+
+// verifyOperationLogs - пункт меню проверки подписей логов
+func verifyOperationLogs(poolFile string, poolExists bool) error {
+	clearScreen()
+	showHeader()
+	fmt.Println("Verify Signed Operation Logs")
+	fmt.Println()
+
+	reader := bufio.NewReader(os.Stdin)
+
+	keysPath := appConfig.StationKeysPath
+	if keysPath != "" {
+		fmt.Printf("Station public keys [%s]: ", keysPath)
+	} else {
+		fmt.Print("Station public key file or directory with *.pub files: ")
+	}
+	input, _ := reader.ReadString('\n')
+	if input = strings.TrimSpace(input); input != "" {
+		keysPath = input
+	}
+	if keysPath == "" {
+		err := errors.New("no station keys specified")
+		showErrorAndWait(err)
+		return err
+	}
+
+	keys, err := loadStationKeys(keysPath)
+	if err != nil {
+		showErrorAndWait(err)
+		return err
+	}
+	appConfig.StationKeysPath = keysPath
+	saveConfig()
+	fmt.Printf(colorGreen+"Loaded %d trusted station key(s)\n"+colorReset, len(keys))
+
+	fmt.Print("Log file or directory: ")
+	logsPath, _ := reader.ReadString('\n')
+	logsPath = strings.TrimSpace(logsPath)
+	if logsPath == "" {
+		return nil
+	}
+
+	// Сравнение с текущим пулом требует пароля, поэтому оно необязательно
+	currentPoolHash := ""
+	if poolExists {
+		fmt.Print("Compare pool hashes with the current pool? (yes/no): ")
+		answer, _ := reader.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) == "yes" {
+			pool, _, err := loadAndDecryptPool(poolFile)
+			if err != nil {
+				fmt.Println(colorRed+"Failed to load MAC pool:"+colorReset, err)
+			} else {
+				currentPoolHash = poolStateHash(pool)
+			}
+		}
+	}
+
+	results, err := verifyLogs(logsPath, keys)
+	if err != nil {
+		showErrorAndWait(err)
+		return err
+	}
+
+	fmt.Println()
+	if printLogVerification(results, currentPoolHash) {
+		fmt.Println(colorGreen + "All logs are signed by trusted stations and unmodified" + colorReset)
+	} else {
+		fmt.Println(colorRed + "Some logs could not be verified, see the report above" + colorReset)
+	}
+	waitForEnter("")
+	return nil
+}
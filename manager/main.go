@@ -48,22 +48,69 @@ const (
 
 // MACPool содержит пул MAC-адресов и метаданные
 type MACPool struct {
-	Version         int          `json:"version"`
-	Addresses       []MACAddress `json:"addresses"`
-	LastUpdated     time.Time    `json:"last_updated"`
-	CreatedBy       string       `json:"created_by"`
-	Signature       string       `json:"signature,omitempty"` // HMAC подпись
-	MACVendorPrefix string       `json:"mac_vendor_prefix,omitempty"`
+	Version         int               `json:"version"`
+	Addresses       []MACAddress      `json:"addresses"`
+	LastUpdated     time.Time         `json:"last_updated"`
+	CreatedBy       string            `json:"created_by"`
+	Signature       string            `json:"signature,omitempty"` // HMAC подпись
+	MACVendorPrefix string            `json:"mac_vendor_prefix,omitempty"`
+	Policy          *AllocationPolicy `json:"policy,omitempty"`    // Правила выделения адресов по данным DMI
+	Approvers       []Approver        `json:"approvers,omitempty"` // Подтверждающие сброс адресов
+	Journal         []PoolEvent       `json:"journal,omitempty"`   // Журнал сбросов адресов
+}
+
+// Approver - сотрудник, чей пароль подтверждает сброс использованных адресов
+type Approver struct {
+	Name string `json:"name"`
+	Salt string `json:"salt"` // base64
+	Hash string `json:"hash"` // PBKDF2-SHA256 пароля, base64
+}
+
+// PoolEvent - запись журнала пула о сбросе адресов
+type PoolEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Addresses []string  `json:"addresses"`
+	Reason    string    `json:"reason"`
+	Operator  string    `json:"operator,omitempty"`
+	Approver  string    `json:"approver,omitempty"`
+	Evidence  string    `json:"evidence,omitempty"` // сверка с логами или запись о возврате оборудования
 }
 
 // MACAddress представляет MAC-адрес и его статус
 type MACAddress struct {
-	Address  string    `json:"address"`
-	Used     bool      `json:"used"`
-	UsedAt   time.Time `json:"used_at,omitempty"`
-	UsedBy   string    `json:"used_by,omitempty"`
-	Reserved bool      `json:"reserved,omitempty"`
-	Comment  string    `json:"comment,omitempty"`
+	Address     string           `json:"address"`
+	Used        bool             `json:"used"`
+	State       string           `json:"state,omitempty"` // Состояние жизненного цикла; пустое - по признаку Used
+	UsedAt      time.Time        `json:"used_at,omitempty"`
+	UsedBy      string           `json:"used_by,omitempty"`
+	Reserved    bool             `json:"reserved,omitempty"`
+	Reservation *Reservation     `json:"reservation,omitempty"` // Причина и срок резервирования
+	Comment     string           `json:"comment,omitempty"`
+	Binding     *HardwareBinding `json:"binding,omitempty"` // Плата, на которую записан адрес
+}
+
+// Reservation описывает, кто и зачем зарезервировал адрес
+type Reservation struct {
+	Reason     string    `json:"reason"`
+	Owner      string    `json:"owner"`
+	ReservedAt time.Time `json:"reserved_at"`
+	ReservedBy string    `json:"reserved_by,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"` // Нулевое значение - бессрочно
+}
+
+// HardwareBinding связывает выделенный адрес с конкретной платой
+type HardwareBinding struct {
+	SystemUUID         string `json:"system_uuid,omitempty"`
+	SystemSerial       string `json:"system_serial,omitempty"`
+	BoardSerial        string `json:"board_serial,omitempty"`
+	Interface          string `json:"interface,omitempty"`
+	PCIAddress         string `json:"pci_address,omitempty"` // Адрес на шине, например 0000:03:00.0
+	PCIVendor          string `json:"pci_vendor,omitempty"`  // Идентификаторы в формате 0x10ec
+	PCIDevice          string `json:"pci_device,omitempty"`
+	PCISubsystemVendor string `json:"pci_subsystem_vendor,omitempty"`
+	PCISubsystemDevice string `json:"pci_subsystem_device,omitempty"`
+	PreviousMAC        string `json:"previous_mac,omitempty"` // Заводской MAC-адрес до прошивки
 }
 
 // RecentPool хранит информацию о недавно использованных пулах
@@ -78,6 +125,10 @@ type Config struct {
 	RecentPools         []RecentPool `json:"recent_pools"`
 	DefaultVendorPrefix string       `json:"default_vendor_prefix,omitempty"`
 	LastDirectory       string       `json:"last_directory,omitempty"`
+	StationKeysPath     string       `json:"station_keys_path,omitempty"`  // Доверенные ключи станций для проверки логов
+	LogSource           string       `json:"log_source,omitempty"`         // Каталог логов или URL сервиса сбора логов для сверки при сбросе
+	ApproversFile       string       `json:"approvers_file,omitempty"`     // Список подтверждающих сброс, по умолчанию в домашнем каталоге
+	CompleteLogStore    string       `json:"complete_log_store,omitempty"` // Сервис сбора логов, в который выгружают все станции
 	MaxRecentPools      int          `json:"max_recent_pools"`
 }
 
@@ -94,8 +145,32 @@ func main() {
 	// Определение флагов командной строки
 	poolFilePtr := flag.String("file", "", "Path to MAC address pool file")
 	vendorPrefixPtr := flag.String("prefix", "", "Vendor prefix for MAC addresses (e.g., '00:1A:2B')")
+	verifyLogsPtr := flag.String("verify-logs", "", "Verify signatures of operation logs (file or directory) and exit")
+	stationKeysPtr := flag.String("station-keys", "", "Station public key file or directory with *.pub files for -verify-logs")
+	reconcilePtr := flag.String("reconcile", "", "Compare the pool (-file) with operation logs from a directory or collector URL and exit")
+	collectorCAPtr := flag.String("collector-ca", "", "CA certificate to verify the log collector")
+	collectorTokenPtr := flag.String("collector-token-file", "", "File with bearer token for the log collector (default: $"+collectorTokenEnv+")")
+	exportPtr := flag.String("export", "", "Export the pool (-file) as csv, jsonl or xlsx and exit")
+	outputPtr := flag.String("output", "-", "Output file for -export, - for stdout")
+	columnsPtr := flag.String("columns", "", "Comma separated columns for -export, or all (default: "+strings.Join(defaultExportColumns, ",")+")")
+	filterPtr := flag.String("filter", "", "Filter for -export, e.g. 'state=used,quarantined reserved match=00:1A:2B:* used-by=line3 since=2024-01-01'")
+	plaintextPtr := flag.Bool("confirm-plaintext", false, "Do not ask for confirmation before -export writes unencrypted data")
 	flag.Parse()
 
+	collectorCAFile = *collectorCAPtr
+	collectorTokenFile = *collectorTokenPtr
+
+	// Проверка логов выполняется без интерактивного меню
+	if *verifyLogsPtr != "" {
+		os.Exit(runVerifyLogsCommand(*verifyLogsPtr, *stationKeysPtr))
+	}
+	if *reconcilePtr != "" {
+		os.Exit(runReconcileCommand(*poolFilePtr, *reconcilePtr))
+	}
+	if *exportPtr != "" {
+		os.Exit(runExportCommand(*poolFilePtr, *exportPtr, *outputPtr, *columnsPtr, *filterPtr, *plaintextPtr))
+	}
+
 	// Загрузка конфигурации
 	loadConfig()
 
@@ -160,6 +235,7 @@ func main() {
 		fmt.Println("\nOptions:")
 		fmt.Println("P. Select different pool file")
 		fmt.Println("N. Create new MAC address pool")
+		fmt.Println("V. Verify signed operation logs")
 
 		if poolExists {
 			fmt.Println("\nPool Operations:")
@@ -168,8 +244,14 @@ func main() {
 			fmt.Println("3. List MAC addresses in pool")
 			fmt.Println("4. Reset MAC address status (mark as unused)")
 			fmt.Println("5. Change encryption password")
-			fmt.Println("6. Export pool statistics")
+			fmt.Println("6. Export pool (statistics, CSV, JSON Lines, XLSX)")
 			fmt.Println("7. View pool information")
+			fmt.Println("8. Manage allocation policy")
+			fmt.Println("9. Search allocations (MAC, UUID, serial, PCI)")
+			fmt.Println("10. Reserve or release addresses")
+			fmt.Println("11. Change address state (retire, quarantine, defective)")
+			fmt.Println("12. Manage reset approvers")
+			fmt.Println("R. Reconcile pool with operation logs")
 		}
 
 		fmt.Println("\nS. Settings")
@@ -259,7 +341,7 @@ func main() {
 
 		case "6":
 			if poolExists {
-				exportPoolStats(currentPoolPath)
+				exportPool(currentPoolPath)
 			} else {
 				showNoPoolError()
 			}
@@ -271,6 +353,51 @@ func main() {
 				showNoPoolError()
 			}
 
+		case "8":
+			if poolExists {
+				managePolicy(currentPoolPath)
+			} else {
+				showNoPoolError()
+			}
+
+		case "9":
+			if poolExists {
+				searchAllocations(currentPoolPath)
+			} else {
+				showNoPoolError()
+			}
+
+		case "10":
+			if poolExists {
+				manageReservations(currentPoolPath)
+			} else {
+				showNoPoolError()
+			}
+
+		case "11":
+			if poolExists {
+				changeAddressStates(currentPoolPath)
+			} else {
+				showNoPoolError()
+			}
+
+		case "12":
+			if poolExists {
+				manageApprovers(currentPoolPath)
+			} else {
+				showNoPoolError()
+			}
+
+		case "R":
+			if poolExists {
+				reconcilePoolWithLogs(currentPoolPath)
+			} else {
+				showNoPoolError()
+			}
+
+		case "V":
+			verifyOperationLogs(currentPoolPath, poolExists)
+
 		case "S":
 			vendorPrefix = showSettingsMenu(vendorPrefix)
 
@@ -673,19 +800,9 @@ func viewPoolInfo(poolFile string) error {
 	fmt.Printf("Pool Information: %s\n\n", poolFile)
 
 	// Подсчет статистики
-	unusedCount := 0
-	usedCount := 0
-	reservedCount := 0
-
-	for _, addr := range pool.Addresses {
-		if addr.Used {
-			usedCount++
-		} else if addr.Reserved {
-			reservedCount++
-		} else {
-			unusedCount++
-		}
-	}
+	counts, reservedCount := countAddressStates(pool)
+	usedCount := counts[stateUsed]
+	unusedCount := counts[stateFree]
 
 	// Отображение основной информации
 	fmt.Printf("File: %s\n", poolFile)
@@ -698,10 +815,34 @@ func viewPoolInfo(poolFile string) error {
 		fmt.Printf("Vendor prefix: %s\n", pool.MACVendorPrefix)
 	}
 
+	if pool.Policy != nil && len(pool.Policy.Rules) > 0 {
+		fmt.Printf("Allocation policy: %d rules\n", len(pool.Policy.Rules))
+	}
+	if approvers, err := resetApprovers(pool); err == nil && len(approvers) > 0 {
+		fmt.Printf("Reset approvers: %d\n", len(approvers))
+	}
+
 	fmt.Printf("\nTotal MAC addresses: %d\n", len(pool.Addresses))
 	fmt.Printf("Used: %d (%.1f%%)\n", usedCount, percentage(usedCount, len(pool.Addresses)))
 	fmt.Printf("Unused: %d (%.1f%%)\n", unusedCount, percentage(unusedCount, len(pool.Addresses)))
 	fmt.Printf("Reserved: %d (%.1f%%)\n", reservedCount, percentage(reservedCount, len(pool.Addresses)))
+	for _, state := range lifecycleStates {
+		if counts[state] > 0 {
+			fmt.Printf("%s: %d (%.1f%%)\n", stateLabel(state), counts[state], percentage(counts[state], len(pool.Addresses)))
+		}
+	}
+
+	// Резервирования по владельцам и причинам
+	if len(groupReservations(pool)) > 0 {
+		fmt.Printf("\nReservations by owner and reason:\n")
+		printReservationGroups(pool, false)
+	}
+
+	// Последние сбросы адресов из журнала пула
+	if len(pool.Journal) > 0 {
+		fmt.Printf("\nRecent resets:\n")
+		printPoolJournal(pool, 5)
+	}
 
 	// Отображение последних использованных адресов
 	if usedCount > 0 {
@@ -710,7 +851,7 @@ func viewPoolInfo(poolFile string) error {
 		// Сортируем адреса по времени использования (от новых к старым)
 		var usedAddrs []MACAddress
 		for _, addr := range pool.Addresses {
-			if addr.Used {
+			if addressState(addr) == stateUsed {
 				usedAddrs = append(usedAddrs, addr)
 			}
 		}
@@ -767,7 +908,12 @@ func showSettingsMenu(currentVendorPrefix string) string {
 	fmt.Printf("1. Default vendor prefix: %s\n", currentVendorPrefix)
 	fmt.Printf("2. Maximum recent pools: %d\n", appConfig.MaxRecentPools)
 	fmt.Println("3. Clear recent pools list")
-	fmt.Println("4. Save and exit settings")
+	if appConfig.CompleteLogStore != "" {
+		fmt.Printf("4. Complete log store for reset cross-checks: %s\n", appConfig.CompleteLogStore)
+	} else {
+		fmt.Println("4. Complete log store for reset cross-checks: not set")
+	}
+	fmt.Println("5. Save and exit settings")
 
 	fmt.Print("\nSelect option: ")
 	reader := bufio.NewReader(os.Stdin)
@@ -843,6 +989,30 @@ func showSettingsMenu(currentVendorPrefix string) string {
 		return currentVendorPrefix
 
 	case "4":
+		// Сервис сбора логов, в который выгружают логи все станции: при сверке сброса
+		// отсутствие записи об адресе в нём подтверждает, что адрес не прошивался
+		fmt.Println("\nSet this only for a collector that every flashing station uploads to.")
+		fmt.Print("Collector URL (https://..., '-' to clear): ")
+		url, _ := reader.ReadString('\n')
+		url = strings.TrimSpace(url)
+		switch {
+		case url == "":
+			return currentVendorPrefix
+		case url == "-":
+			appConfig.CompleteLogStore = ""
+		case strings.HasPrefix(url, "https://"):
+			appConfig.CompleteLogStore = strings.TrimRight(url, "/")
+		default:
+			fmt.Println(colorRed + "The collector URL must use https. Setting not changed." + colorReset)
+			time.Sleep(2 * time.Second)
+			return currentVendorPrefix
+		}
+		saveConfig()
+		fmt.Println(colorGreen + "Complete log store updated successfully." + colorReset)
+		time.Sleep(1 * time.Second)
+		return currentVendorPrefix
+
+	case "5":
 		return currentVendorPrefix
 
 	default:
@@ -1056,7 +1226,7 @@ func addMACsToPool(poolFile string) error {
 	fmt.Println("\nHow would you like to add MAC addresses?")
 	fmt.Println("1. Enter MAC addresses manually (one per line)")
 	fmt.Println("2. Generate MAC addresses with vendor prefix")
-	fmt.Println("3. Import from file")
+	fmt.Println("3. Import from CSV/JSON file (status, comments, reservations, usage history)")
 	fmt.Println("0. Cancel")
 
 	var choice string
@@ -1146,66 +1316,8 @@ func addMACsToPool(poolFile string) error {
 		newMACs = generatedMACs
 
 	case "3":
-		// Импорт из файла
-		fmt.Print("Enter path to file: ")
-		var filePath string
-		fmt.Scanln(&filePath)
-
-		data, err := os.ReadFile(filePath)
-		if err != nil {
-			fmt.Println(colorRed+"Error reading file:"+colorReset, err)
-			return err
-		}
-
-		scanner := bufio.NewScanner(strings.NewReader(string(data)))
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-
-			// Извлекаем MAC из строки (в случае если в строке есть дополнительные данные)
-			re := regexp.MustCompile(`([0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}`)
-			macMatches := re.FindAllString(line, -1)
-
-			for _, mac := range macMatches {
-				if !isMACValid(mac) {
-					fmt.Printf(colorYellow+"Invalid MAC format: %s (skipped)\n"+colorReset, mac)
-					continue
-				}
-
-				// Стандартизация формата
-				mac = standardizeMACFormat(mac)
-
-				// Проверка на дубликаты
-				isDuplicate := false
-				for _, m := range newMACs {
-					if strings.EqualFold(m, mac) {
-						isDuplicate = true
-						break
-					}
-				}
-
-				if !isDuplicate {
-					// Проверка на дубликаты в существующем пуле
-					for _, addr := range pool.Addresses {
-						if strings.EqualFold(addr.Address, mac) {
-							fmt.Printf(colorYellow+"MAC %s already exists in pool (skipped)\n"+colorReset, mac)
-							isDuplicate = true
-							break
-						}
-					}
-				}
-
-				if !isDuplicate {
-					newMACs = append(newMACs, mac)
-				}
-			}
-		}
-
-		if scanner.Err() != nil {
-			fmt.Println(colorRed+"Error scanning file:"+colorReset, scanner.Err())
-		}
+		// Импорт из CSV или JSON с метаданными; простой список адресов читается как CSV без заголовка
+		return importFromFile(pool, password, poolFile)
 
 	default:
 		fmt.Println(colorRed + "Invalid option." + colorReset)
@@ -1334,15 +1446,9 @@ func removeMACsFromPool(poolFile string) error {
 	// Отображение всех MAC-адресов
 	fmt.Println("\nMAC addresses in pool:")
 	for i, addr := range pool.Addresses {
-		status := "Unused"
-		if addr.Used {
-			status = fmt.Sprintf("Used at %s", addr.UsedAt.Format("2006-01-02 15:04:05"))
-			if addr.UsedBy != "" {
-				status += fmt.Sprintf(" by %s", addr.UsedBy)
-			}
-		}
+		status := addressStatusText(addr)
 		if addr.Reserved {
-			status += " (Reserved)"
+			status += " (Reserved: " + reservationSummary(addr) + ")"
 		}
 
 		comment := ""
@@ -1398,7 +1504,7 @@ func removeMACsFromPool(poolFile string) error {
 		}
 
 		for i, addr := range pool.Addresses {
-			if !addr.Used && !addr.Reserved {
+			if addressState(addr) == stateFree && !isReserved(addr) {
 				indicesToRemove = append(indicesToRemove, i)
 			}
 		}
@@ -1451,7 +1557,7 @@ func removeMACsFromPool(poolFile string) error {
 	}
 
 	if usedCount > 0 {
-		fmt.Printf(colorYellow+"Warning: %d of the selected MAC addresses are marked as used.\n"+colorReset, usedCount)
+		fmt.Printf(colorYellow+"Warning: %d of the selected MAC addresses are not free (used, pending, retired, quarantined or defective).\n"+colorReset, usedCount)
 		fmt.Print("Are you sure you want to remove them? (yes/no): ")
 		var confirm string
 		fmt.Scanln(&confirm)
@@ -1520,6 +1626,9 @@ func listMACsInPool(poolFile string) error {
 	fmt.Println(colorGreen + "1" + colorReset + " - All MAC addresses")
 	fmt.Println(colorGreen + "2" + colorReset + " - Only unused MAC addresses")
 	fmt.Println(colorGreen + "3" + colorReset + " - Only used MAC addresses")
+	fmt.Println(colorGreen + "4" + colorReset + " - Only reserved MAC addresses")
+	fmt.Println(colorGreen + "5" + colorReset + " - Reserved MAC addresses grouped by owner and reason")
+	fmt.Println(colorGreen + "6" + colorReset + " - Pending, retired, quarantined and defective MAC addresses")
 	fmt.Println(colorGreen + "0" + colorReset + " - Return to main menu")
 
 	reader := bufio.NewReader(os.Stdin)
@@ -1538,18 +1647,41 @@ func listMACsInPool(poolFile string) error {
 		viewMode = "All MAC addresses"
 	case "2":
 		for _, addr := range pool.Addresses {
-			if !addr.Used {
+			if addressState(addr) == stateFree {
 				filteredAddresses = append(filteredAddresses, addr)
 			}
 		}
 		viewMode = "Unused MAC addresses"
 	case "3":
 		for _, addr := range pool.Addresses {
-			if addr.Used {
+			if addressState(addr) == stateUsed {
 				filteredAddresses = append(filteredAddresses, addr)
 			}
 		}
 		viewMode = "Used MAC addresses"
+	case "6":
+		for _, addr := range pool.Addresses {
+			if state := addressState(addr); state != stateFree && state != stateUsed {
+				filteredAddresses = append(filteredAddresses, addr)
+			}
+		}
+		viewMode = "Pending, retired, quarantined and defective MAC addresses"
+	case "4":
+		for _, addr := range pool.Addresses {
+			if addr.Reserved {
+				filteredAddresses = append(filteredAddresses, addr)
+			}
+		}
+		viewMode = "Reserved MAC addresses"
+	case "5":
+		clearScreen()
+		showHeader()
+		fmt.Println(colorCyan + "Reserved MAC addresses by owner and reason" + colorReset)
+		fmt.Println()
+		printReservationGroups(pool, true)
+		fmt.Println("\nPress ENTER to return...")
+		reader.ReadString('\n')
+		return nil
 	default:
 		fmt.Println(colorRed + "Invalid option." + colorReset)
 		time.Sleep(1 * time.Second)
@@ -1565,19 +1697,9 @@ func listMACsInPool(poolFile string) error {
 	}
 
 	// Подготовка статистики
-	unusedCount := 0
-	usedCount := 0
-	reservedCount := 0
-
-	for _, addr := range pool.Addresses {
-		if addr.Used {
-			usedCount++
-		} else if addr.Reserved {
-			reservedCount++
-		} else {
-			unusedCount++
-		}
-	}
+	counts, reservedCount := countAddressStates(pool)
+	usedCount := counts[stateUsed]
+	unusedCount := counts[stateFree]
 
 	// Реализация постраничного просмотра с улучшенной навигацией
 	const itemsPerPage = 15 // Уменьшаем количество на странице для лучшей читаемости
@@ -1622,15 +1744,26 @@ func listMACsInPool(poolFile string) error {
 			statusColor := colorReset
 			status := "Unused"
 
-			if addr.Used {
+			if state := addressState(addr); state == stateUsed {
 				statusColor = colorGreen
 				status = "Used"
 				if addr.UsedAt.Year() > 1 { // Проверка валидной даты
 					status = "Used on " + addr.UsedAt.Format("2006-01-02")
 				}
-			} else if addr.Reserved {
+			} else if state != stateFree {
+				statusColor = stateColor(state)
+				status = stateLabel(state)
+			} else if isReserved(addr) {
 				statusColor = colorYellow
 				status = "Reserved"
+				if addr.Reservation != nil {
+					status += ": " + addr.Reservation.Reason
+					if len(status) > 40 {
+						status = status[:37] + "..."
+					}
+				}
+			} else if addr.Reserved {
+				status = "Unused (reservation expired)"
 			}
 
 			// Если нужны дополнительные детали и они есть
@@ -1668,7 +1801,13 @@ func listMACsInPool(poolFile string) error {
 		fmt.Printf("Total: %d MACs | ", len(pool.Addresses))
 		fmt.Printf("Used: %s%d%s | ", colorGreen, usedCount, colorReset)
 		fmt.Printf("Unused: %d | ", unusedCount)
-		fmt.Printf("Reserved: %s%d%s\n", colorYellow, reservedCount, colorReset)
+		fmt.Printf("Reserved: %s%d%s", colorYellow, reservedCount, colorReset)
+		for _, state := range lifecycleStates {
+			if counts[state] > 0 {
+				fmt.Printf(" | %s: %s%d%s", stateLabel(state), stateColor(state), counts[state], colorReset)
+			}
+		}
+		fmt.Println()
 
 		if pool.MACVendorPrefix != "" {
 			fmt.Printf("Vendor prefix: %s\n", pool.MACVendorPrefix)
@@ -1770,14 +1909,24 @@ func resetMACStatus(poolFile string) error {
 		return err
 	}
 
-	// Проверка наличия использованных MAC-адресов
+	// Проверка наличия адресов, которые можно вернуть в оборот; списанные и неисправные не сбрасываются
 	var usedAddresses []int
+	locked := 0
 	for i, addr := range pool.Addresses {
-		if addr.Used {
+		state := addressState(addr)
+		if state == stateFree {
+			continue
+		}
+		if canTransition(state, stateFree) {
 			usedAddresses = append(usedAddresses, i)
+		} else {
+			locked++
 		}
 	}
 
+	if locked > 0 {
+		fmt.Printf(colorYellow+"%d retired or defective MAC addresses cannot be made free again.\n"+colorReset, locked)
+	}
 	if len(usedAddresses) == 0 {
 		fmt.Println(colorYellow + "No used MAC addresses in pool." + colorReset)
 		return nil
@@ -1787,11 +1936,7 @@ func resetMACStatus(poolFile string) error {
 	fmt.Println("\nUsed MAC addresses in pool:")
 	for i, idx := range usedAddresses {
 		addr := pool.Addresses[idx]
-		fmt.Printf("%d. %s - Used at %s", i+1, addr.Address, addr.UsedAt.Format("2006-01-02 15:04:05"))
-		if addr.UsedBy != "" {
-			fmt.Printf(" by %s", addr.UsedBy)
-		}
-		fmt.Println()
+		fmt.Printf("%d. %s - %s\n", i+1, addr.Address, addressStatusText(addr))
 	}
 
 	// Предложить варианты сброса
@@ -1849,18 +1994,30 @@ func resetMACStatus(poolFile string) error {
 		return nil
 	}
 
+	// Сброс требует причины, подтверждения, что адреса не ушли с платами, и, если задано, второго подтверждающего
+	indicesToReset, event, err := guardReset(pool, indicesToReset, bufio.NewReader(os.Stdin))
+	if err != nil {
+		fmt.Println(colorRed+"Reset refused:"+colorReset, err)
+		return err
+	}
+	if event == nil {
+		fmt.Println("Operation cancelled.")
+		return nil
+	}
+
 	// Сброс статуса MAC-адресов
 	resetCount := 0
 	for _, idx := range indicesToReset {
 		if idx >= 0 && idx < len(pool.Addresses) {
-			if pool.Addresses[idx].Used {
-				pool.Addresses[idx].Used = false
-				pool.Addresses[idx].UsedAt = time.Time{}
-				pool.Addresses[idx].UsedBy = ""
-				resetCount++
+			if err := setAddressState(&pool.Addresses[idx], stateFree); err != nil {
+				fmt.Printf(colorYellow+"Skipped %v\n"+colorReset, err)
+				continue
 			}
+			event.Addresses = append(event.Addresses, pool.Addresses[idx].Address)
+			resetCount++
 		}
 	}
+	journalEvent(&pool, *event)
 
 	pool.LastUpdated = time.Now()
 
@@ -1943,19 +2100,9 @@ func exportPoolStats(poolFile string) error {
 	}
 
 	// Сбор статистики
-	unusedCount := 0
-	usedCount := 0
-	reservedCount := 0
-
-	for _, addr := range pool.Addresses {
-		if addr.Used {
-			usedCount++
-		} else if addr.Reserved {
-			reservedCount++
-		} else {
-			unusedCount++
-		}
-	}
+	counts, reservedCount := countAddressStates(pool)
+	usedCount := counts[stateUsed]
+	unusedCount := counts[stateFree]
 
 	// Создание файла отчета
 	timeStr := time.Now().Format("20060102_150405")
@@ -1980,7 +2127,25 @@ func exportPoolStats(poolFile string) error {
 	f.WriteString(fmt.Sprintf("Total MAC addresses: %d\n", len(pool.Addresses)))
 	f.WriteString(fmt.Sprintf("Used: %d (%.1f%%)\n", usedCount, float64(usedCount)/float64(len(pool.Addresses))*100))
 	f.WriteString(fmt.Sprintf("Unused: %d (%.1f%%)\n", unusedCount, float64(unusedCount)/float64(len(pool.Addresses))*100))
-	f.WriteString(fmt.Sprintf("Reserved: %d (%.1f%%)\n\n", reservedCount, float64(reservedCount)/float64(len(pool.Addresses))*100))
+	f.WriteString(fmt.Sprintf("Reserved: %d (%.1f%%)\n", reservedCount, float64(reservedCount)/float64(len(pool.Addresses))*100))
+	for _, state := range lifecycleStates {
+		if counts[state] > 0 {
+			f.WriteString(fmt.Sprintf("%s: %d (%.1f%%)\n", stateLabel(state), counts[state], float64(counts[state])/float64(len(pool.Addresses))*100))
+		}
+	}
+	f.WriteString("\n")
+
+	if groups := groupReservations(pool); len(groups) > 0 {
+		f.WriteString("Reservations by owner and reason:\n")
+		for _, g := range groups {
+			f.WriteString(fmt.Sprintf("%s - %s: %d", g.Owner, g.Reason, len(g.Addresses)))
+			if g.Expired > 0 {
+				f.WriteString(fmt.Sprintf(" (%d expired)", g.Expired))
+			}
+			f.WriteString("\n")
+		}
+		f.WriteString("\n")
+	}
 
 	if pool.MACVendorPrefix != "" {
 		f.WriteString(fmt.Sprintf("Vendor prefix: %s\n\n", pool.MACVendorPrefix))
@@ -1992,13 +2157,14 @@ func exportPoolStats(poolFile string) error {
 	fmt.Println("2. Yes, include all MAC addresses")
 	fmt.Println("3. Yes, but only used MAC addresses")
 	fmt.Println("4. Yes, but only unused MAC addresses")
+	fmt.Println("5. Yes, but only reserved MAC addresses")
 
 	var choice string
 	fmt.Print("\nSelect option: ")
 	fmt.Scanln(&choice)
 
 	switch choice {
-	case "2", "3", "4":
+	case "2", "3", "4", "5":
 		f.WriteString("MAC Address List:\n")
 		f.WriteString("----------------\n\n")
 
@@ -2009,21 +2175,17 @@ func exportPoolStats(poolFile string) error {
 			case "2": // Все
 				include = true
 			case "3": // Только использованные
-				include = addr.Used
+				include = addressState(addr) == stateUsed
 			case "4": // Только неиспользованные
-				include = !addr.Used && !addr.Reserved
+				include = addressState(addr) == stateFree && !isReserved(addr)
+			case "5": // Только зарезервированные
+				include = addr.Reserved
 			}
 
 			if include {
-				status := "Unused"
-				if addr.Used {
-					status = fmt.Sprintf("Used at %s", addr.UsedAt.Format("2006-01-02 15:04:05"))
-					if addr.UsedBy != "" {
-						status += fmt.Sprintf(" by %s", addr.UsedBy)
-					}
-				}
+				status := addressStatusText(addr)
 				if addr.Reserved {
-					status += " (Reserved)"
+					status += " (Reserved: " + reservationSummary(addr) + ")"
 				}
 
 				comment := ""
@@ -2042,6 +2204,26 @@ func exportPoolStats(poolFile string) error {
 
 // loadAndDecryptPool загружает и дешифрует пул MAC-адресов
 func loadAndDecryptPool(poolFile string) (MACPool, string, error) {
+	return loadAndDecryptPoolFrom(poolFile, nil)
+}
+
+// readPassword читает пароль без эха с терминала. Если stdin не терминал, пароль читается строкой
+// из reader, через который прочитаны предыдущие ответы: отдельное чтение из stdin не увидело бы
+// строки, уже забранные в буфер reader. nil - только с терминала
+func readPassword(reader *bufio.Reader) ([]byte, error) {
+	if reader == nil || term.IsTerminal(int(syscall.Stdin)) {
+		return term.ReadPassword(int(syscall.Stdin))
+	}
+	line, err := reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), err
+}
+
+// loadAndDecryptPoolFrom загружает и дешифрует пул. Если stdin не терминал, пароль читается
+// строкой из reader, через который прочитаны предыдущие ответы; nil - только с терминала
+func loadAndDecryptPoolFrom(poolFile string, reader *bufio.Reader) (MACPool, string, error) {
 	var pool MACPool
 
 	// Проверка существования файла
@@ -2055,10 +2237,10 @@ func loadAndDecryptPool(poolFile string) (MACPool, string, error) {
 		return pool, "", fmt.Errorf("failed to read MAC pool file: %v", err)
 	}
 
-	// Запрос пароля для дешифрования
-	fmt.Print("Enter password: ")
-	password, err := term.ReadPassword(int(syscall.Stdin))
-	fmt.Println()
+	// Запрос пароля для дешифрования. Приглашение выводится в stderr, чтобы не смешиваться с выгрузкой в stdout
+	fmt.Fprint(os.Stderr, "Enter password: ")
+	password, err := readPassword(reader)
+	fmt.Fprintln(os.Stderr)
 	if err != nil {
 		return pool, "", fmt.Errorf("failed to read password: %v", err)
 	}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AllocationPolicy описывает правила выбора MAC-адресов в зависимости от данных DMI
+type AllocationPolicy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule сопоставляет поля DMI с диапазоном адресов, количеством портов и драйвером.
+// Пустое поле совпадает с любым значением, в непустых допускаются шаблоны вида "X570*"
+// и регулярные выражения между косыми чертами: "/^X5[57]0/"
+type PolicyRule struct {
+	Name                  string `json:"name"`
+	SystemManufacturer    string `json:"system_manufacturer,omitempty"`
+	ProductName           string `json:"product_name,omitempty"`
+	BaseboardManufacturer string `json:"baseboard_manufacturer,omitempty"`
+	BaseboardProduct      string `json:"baseboard_product,omitempty"`
+	SKU                   string `json:"sku,omitempty"`
+	RangeStart            string `json:"range_start,omitempty"`
+	RangeEnd              string `json:"range_end,omitempty"`
+	Ports                 int    `json:"ports,omitempty"`
+	Driver                string `json:"driver,omitempty"`
+}
+
+// supportedDrivers - драйверы прошивки, которые понимает MAC Flasher
+var supportedDrivers = []string{"rtnicpg"}
+
+// validatePolicyRule проверяет корректность правила политики
+func validatePolicyRule(rule PolicyRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return errors.New("rule name is required")
+	}
+
+	for _, pattern := range []string{rule.SystemManufacturer, rule.ProductName, rule.BaseboardManufacturer, rule.BaseboardProduct, rule.SKU} {
+		if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			if _, err := regexp.Compile(pattern[1 : len(pattern)-1]); err != nil {
+				return fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+			}
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+
+	var low, high uint64 = 0, 0xFFFFFFFFFFFF
+	var err error
+	if rule.RangeStart != "" {
+		if !isMACValid(rule.RangeStart) {
+			return fmt.Errorf("invalid range start %q", rule.RangeStart)
+		}
+		low, _ = macToUint64(rule.RangeStart)
+	}
+	if rule.RangeEnd != "" {
+		if !isMACValid(rule.RangeEnd) {
+			return fmt.Errorf("invalid range end %q", rule.RangeEnd)
+		}
+		if high, err = macToUint64(rule.RangeEnd); err != nil {
+			return err
+		}
+	}
+	if low > high {
+		return errors.New("range start is greater than range end")
+	}
+
+	// MAC Flasher записывает в плату один адрес, лишние адреса правила остались бы незаписанными
+	if rule.Ports > 1 {
+		return errors.New("only one port per board can be flashed, set ports to 1")
+	}
+	if rule.Ports < 0 {
+		return errors.New("ports must not be negative")
+	}
+
+	if rule.Driver != "" {
+		supported := false
+		for _, d := range supportedDrivers {
+			if strings.EqualFold(d, rule.Driver) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("unsupported driver %q (supported: %s)", rule.Driver, strings.Join(supportedDrivers, ", "))
+		}
+	}
+
+	return nil
+}
+
+// macToUint64 преобразует MAC-адрес в число для сравнения диапазонов
+func macToUint64(mac string) (uint64, error) {
+	hexStr := strings.NewReplacer(":", "", "-", "").Replace(mac)
+	if len(hexStr) != 12 {
+		return 0, errors.New("MAC address must contain 12 hex digits")
+	}
+	return strconv.ParseUint(hexStr, 16, 64)
+}
+
+// printPolicyRules выводит правила политики в виде таблицы
+func printPolicyRules(policy *AllocationPolicy) {
+	if policy == nil || len(policy.Rules) == 0 {
+		fmt.Println(colorYellow + "No allocation policy configured. The flasher uses the first free address for any board." + colorReset)
+		return
+	}
+
+	fmt.Printf("%-3s %-16s %-32s %-35s %-5s %s\n", "#", "Name", "Match", "Range", "Ports", "Driver")
+	fmt.Println(strings.Repeat("─", 100))
+	for i, rule := range policy.Rules {
+		var match []string
+		if rule.SystemManufacturer != "" {
+			match = append(match, "mfr="+rule.SystemManufacturer)
+		}
+		if rule.ProductName != "" {
+			match = append(match, "product="+rule.ProductName)
+		}
+		if rule.BaseboardManufacturer != "" {
+			match = append(match, "bb_mfr="+rule.BaseboardManufacturer)
+		}
+		if rule.BaseboardProduct != "" {
+			match = append(match, "bb="+rule.BaseboardProduct)
+		}
+		if rule.SKU != "" {
+			match = append(match, "sku="+rule.SKU)
+		}
+		matchStr := "*"
+		if len(match) > 0 {
+			matchStr = strings.Join(match, " ")
+		}
+
+		rangeStr := "any"
+		if rule.RangeStart != "" || rule.RangeEnd != "" {
+			rangeStr = rule.RangeStart + " - " + rule.RangeEnd
+		}
+
+		ports := rule.Ports
+		if ports <= 0 {
+			ports = 1
+		}
+		driver := rule.Driver
+		if driver == "" {
+			driver = "default"
+		}
+
+		fmt.Printf("%-3s %-16s %-32s %-35s %-5d %s\n", fmt.Sprintf("%d.", i+1), rule.Name, matchStr, rangeStr, ports, driver)
+	}
+	fmt.Println()
+	fmt.Println("Boards that match no rule are refused by the flasher.")
+}
+
+// managePolicy показывает меню управления политикой выделения адресов
+func managePolicy(poolFile string) error {
+	pool, password, err := loadAndDecryptPool(poolFile)
+	if err != nil {
+		fmt.Println(colorRed+"Failed to load MAC pool:"+colorReset, err)
+		waitForEnter("")
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	changed := false
+
+	for {
+		clearScreen()
+		showHeader()
+		fmt.Println("Allocation Policy")
+		fmt.Println()
+		printPolicyRules(pool.Policy)
+
+		fmt.Println("\nOptions:")
+		fmt.Println("1. Add rule")
+		fmt.Println("2. Remove rule")
+		fmt.Println("3. Import rules from JSON file")
+		fmt.Println("4. Export rules to JSON file")
+		fmt.Println("5. Clear policy")
+		fmt.Println("0. Save and return")
+
+		fmt.Print("\nSelect option: ")
+		choice, _ := reader.ReadString('\n')
+		choice = strings.TrimSpace(choice)
+
+		switch choice {
+		case "0":
+			if !changed {
+				return nil
+			}
+			pool.LastUpdated = time.Now()
+			signPool(&pool, password)
+			if err := saveEncryptedPool(pool, password, poolFile); err != nil {
+				fmt.Println(colorRed+"Failed to save pool:"+colorReset, err)
+				waitForEnter("")
+				return err
+			}
+			fmt.Println(colorGreen + "Allocation policy saved successfully!" + colorReset)
+			time.Sleep(1 * time.Second)
+			return nil
+
+		case "1":
+			rule, err := promptPolicyRule(reader)
+			if err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			if pool.Policy == nil {
+				pool.Policy = &AllocationPolicy{}
+			}
+			pool.Policy.Rules = append(pool.Policy.Rules, rule)
+			changed = true
+
+		case "2":
+			if pool.Policy == nil || len(pool.Policy.Rules) == 0 {
+				continue
+			}
+			input, _ := readUserInput("Enter number of rule to remove: ")
+			idx, err := strconv.Atoi(input)
+			if err != nil || idx < 1 || idx > len(pool.Policy.Rules) {
+				showErrorAndWait(errors.New("invalid rule number"))
+				continue
+			}
+			pool.Policy.Rules = append(pool.Policy.Rules[:idx-1], pool.Policy.Rules[idx:]...)
+			if len(pool.Policy.Rules) == 0 {
+				pool.Policy = nil
+			}
+			changed = true
+
+		case "3":
+			filePath, _ := readUserInput("Enter path to JSON file: ")
+			policy, err := loadPolicyFile(filePath)
+			if err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			pool.Policy = policy
+			changed = true
+			fmt.Printf(colorGreen+"Imported %d rules.\n"+colorReset, len(policy.Rules))
+			time.Sleep(1 * time.Second)
+
+		case "4":
+			if pool.Policy == nil {
+				showErrorAndWait(errors.New("no policy to export"))
+				continue
+			}
+			filePath, _ := readUserInput("Enter output path: ")
+			data, _ := json.MarshalIndent(pool.Policy, "", "  ")
+			if err := os.WriteFile(filePath, data, 0644); err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			fmt.Printf(colorGreen+"Policy exported to: %s\n"+colorReset, filePath)
+			time.Sleep(1 * time.Second)
+
+		case "5":
+			if getYesNoConfirmation("Remove all policy rules? Boards will get the first free address") {
+				pool.Policy = nil
+				changed = true
+			}
+
+		default:
+			fmt.Println(colorRed + "Invalid option, please try again." + colorReset)
+			time.Sleep(1 * time.Second)
+		}
+	}
+}
+
+// promptPolicyRule запрашивает у пользователя параметры нового правила
+func promptPolicyRule(reader *bufio.Reader) (PolicyRule, error) {
+	var rule PolicyRule
+
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		value, _ := reader.ReadString('\n')
+		return strings.TrimSpace(value)
+	}
+
+	fmt.Println("\nEmpty fields match any value. Wildcards like 'X570*' and regular expressions like '/^X5[57]0/' are allowed.")
+	rule.Name = ask("Rule name: ")
+	rule.SystemManufacturer = ask("System manufacturer: ")
+	rule.ProductName = ask("Product name: ")
+	rule.BaseboardManufacturer = ask("Baseboard manufacturer: ")
+	rule.BaseboardProduct = ask("Baseboard product: ")
+	rule.SKU = ask("SKU: ")
+
+	if start := ask("Range start MAC (empty for any): "); start != "" {
+		rule.RangeStart = standardizeMACFormat(start)
+	}
+	if end := ask("Range end MAC (empty for any): "); end != "" {
+		rule.RangeEnd = standardizeMACFormat(end)
+	}
+
+	rule.Driver = ask(fmt.Sprintf("Driver (%s, empty for default): ", strings.Join(supportedDrivers, ", ")))
+
+	if err := validatePolicyRule(rule); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// loadPolicyFile читает правила политики из JSON-файла (объект с полем rules или массив правил)
+func loadPolicyFile(filePath string) (*AllocationPolicy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+
+	var policy AllocationPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		var rules []PolicyRule
+		if err2 := json.Unmarshal(data, &rules); err2 != nil {
+			return nil, fmt.Errorf("failed to parse policy file: %v", err)
+		}
+		policy.Rules = rules
+	}
+
+	if len(policy.Rules) == 0 {
+		return nil, errors.New("policy file contains no rules")
+	}
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.RangeStart != "" {
+			rule.RangeStart = standardizeMACFormat(rule.RangeStart)
+		}
+		if rule.RangeEnd != "" {
+			rule.RangeEnd = standardizeMACFormat(rule.RangeEnd)
+		}
+		if err := validatePolicyRule(*rule); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+
+	return &policy, nil
+}
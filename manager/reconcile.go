@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Переменная окружения с токеном Bearer для запросов к сервису сбора логов
+const collectorTokenEnv = "MANAGER_COLLECTOR_TOKEN"
+
+// Параметры подключения к сервису сбора логов, задаются флагами
+var (
+	collectorCAFile    string // CA для проверки сертификата сервиса
+	collectorTokenFile string // файл с токеном Bearer
+)
+
+// Виды расхождений между пулом и логами
+const (
+	mismatchUsedWithoutLog = "USED WITHOUT LOG"
+	mismatchLoggedUnused   = "LOGGED BUT UNUSED"
+	mismatchNotInPool      = "NOT IN POOL"
+	mismatchSeveralHosts   = "SEVERAL HOSTS"
+	mismatchFailedButUsed  = "FAILED BUT USED"
+)
+
+// OperationLogEntry - сведения из лога операции, нужные для сверки с пулом
+type OperationLogEntry struct {
+	Source    string // файл лога или идентификатор в сервисе сбора логов
+	Timestamp string
+	MAC       string
+	Action    string
+	Success   bool
+	Host      string // плата, на которой выполнялась операция
+}
+
+// ReconcileMismatch - расхождение по одному MAC-адресу
+type ReconcileMismatch struct {
+	MAC    string
+	Kind   string
+	Detail string
+	Logs   []OperationLogEntry
+}
+
+// ReconcileReport - результат сверки пула с логами
+type ReconcileReport struct {
+	LogsRead   int
+	LoggedMACs int
+	Skipped    []string // логи, которые не удалось прочитать
+	Mismatches []ReconcileMismatch
+}
+
+// reconcileLogFields - поля лога операции, из которых берутся данные для сверки.
+// system_info хранится как есть: его формат зависит от версии лога
+type reconcileLogFields struct {
+	Timestamp       string            `json:"timestamp"`
+	MacAddress      string            `json:"mac_address"`
+	ActionPerformed string            `json:"action_performed"`
+	Success         bool              `json:"success"`
+	SystemInfo      json.RawMessage   `json:"system_info"`
+	HostInfo        map[string]string `json:"host_info"`
+}
+
+// parseOperationLog разбирает лог операции. Логи без MAC-адреса возвращаются с пустым MAC
+func parseOperationLog(source string, data []byte) (OperationLogEntry, error) {
+	var fields reconcileLogFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return OperationLogEntry{}, fmt.Errorf("not a valid log: %v", err)
+	}
+
+	entry := OperationLogEntry{
+		Source:    source,
+		Timestamp: fields.Timestamp,
+		Action:    fields.ActionPerformed,
+		Success:   fields.Success,
+		Host:      logHostIdentity(fields),
+	}
+	if fields.MacAddress != "" {
+		entry.MAC = standardizeMACFormat(strings.TrimSpace(fields.MacAddress))
+	}
+	return entry, nil
+}
+
+// logHostIdentity определяет плату по логу: UUID системы, серийный номер системы, затем имя хоста
+func logHostIdentity(fields reconcileLogFields) string {
+	uuid, serial := systemIdentity(fields.SystemInfo)
+	switch {
+	case uuid != "":
+		return "uuid " + uuid
+	case serial != "":
+		return "serial " + serial
+	case fields.HostInfo["hostname"] != "" && fields.HostInfo["hostname"] != "unknown":
+		return "host " + fields.HostInfo["hostname"]
+	}
+	return ""
+}
+
+// systemIdentity достаёт UUID и серийный номер системы из system_info. Начиная с версии 2
+// это типизированные записи SMBIOS, в версии 1 - карта секций dmidecode
+func systemIdentity(raw json.RawMessage) (uuid, serial string) {
+	if len(raw) == 0 {
+		return "", ""
+	}
+
+	var typed struct {
+		System *struct {
+			UUID         string `json:"uuid"`
+			SerialNumber string `json:"serial_number"`
+		} `json:"system"`
+	}
+	if err := json.Unmarshal(raw, &typed); err == nil && typed.System != nil {
+		return usableIdentity(typed.System.UUID), usableIdentity(typed.System.SerialNumber)
+	}
+
+	var sections map[string]map[string]interface{}
+	if err := json.Unmarshal(raw, &sections); err != nil {
+		return "", ""
+	}
+	for name, section := range sections {
+		if !strings.Contains(name, "DMI type 1,") {
+			continue
+		}
+		uuid, _ = section["UUID"].(string)
+		serial, _ = section["Serial Number"].(string)
+		return usableIdentity(uuid), usableIdentity(serial)
+	}
+	return "", ""
+}
+
+// usableIdentity отбрасывает значения-заглушки, которые производители оставляют в SMBIOS
+func usableIdentity(value string) string {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "", "not specified", "not settable", "not present", "default string", "to be filled by o.e.m.",
+		"none", "0", "00000000-0000-0000-0000-000000000000", "ffffffff-ffff-ffff-ffff-ffffffffffff":
+		return ""
+	}
+	return value
+}
+
+// readLogsFromDirectory читает логи из файла или каталога (*.json в подкаталогах)
+func readLogsFromDirectory(path string) ([]OperationLogEntry, []string, error) {
+	files, err := collectLogFiles(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list logs: %v", err)
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no .json logs found in %s", path)
+	}
+
+	var entries []OperationLogEntry
+	var skipped []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", file, err))
+			continue
+		}
+		entry, err := parseOperationLog(file, data)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", file, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped, nil
+}
+
+// collectorLog - лог в ответе сервиса сбора логов
+type collectorLog struct {
+	ID       string          `json:"id"`
+	Filename string          `json:"filename"`
+	Log      json.RawMessage `json:"log"`
+}
+
+// newCollectorClient создаёт клиента HTTPS для сервиса сбора логов
+func newCollectorClient() (*http.Client, string, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if collectorCAFile != "" {
+		pem, err := os.ReadFile(collectorCAFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, "", fmt.Errorf("no certificates found in %s", collectorCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	token := os.Getenv(collectorTokenEnv)
+	if collectorTokenFile != "" {
+		data, err := os.ReadFile(collectorTokenFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read collector token: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	client := &http.Client{
+		Timeout:   60 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return client, token, nil
+}
+
+// readLogsFromCollector загружает все логи из сервиса сбора логов
+func readLogsFromCollector(baseURL string) ([]OperationLogEntry, []string, error) {
+	if !strings.HasPrefix(baseURL, "https://") {
+		return nil, nil, fmt.Errorf("collector URL %q must use https", baseURL)
+	}
+	client, token, err := newCollectorClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(baseURL, "/")+"/api/v1/logs?limit=0", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query collector: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, nil, fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var logs []collectorLog
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse collector response: %v", err)
+	}
+
+	var entries []OperationLogEntry
+	var skipped []string
+	for _, l := range logs {
+		source := "collector:" + l.ID
+		if l.Filename != "" {
+			source += " (" + l.Filename + ")"
+		}
+		entry, err := parseOperationLog(source, l.Log)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped, nil
+}
+
+// readOperationLogs читает логи из каталога или, если указан адрес https://, из сервиса сбора логов
+func readOperationLogs(source string) ([]OperationLogEntry, []string, error) {
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+		return readLogsFromCollector(source)
+	}
+	return readLogsFromDirectory(source)
+}
+
+// reconcilePool сравнивает использованные адреса пула с логами операций
+func reconcilePool(pool MACPool, logs []OperationLogEntry) ReconcileReport {
+	report := ReconcileReport{LogsRead: len(logs)}
+
+	byMAC := make(map[string][]OperationLogEntry)
+	for _, l := range logs {
+		if l.MAC != "" {
+			byMAC[l.MAC] = append(byMAC[l.MAC], l)
+		}
+	}
+	report.LoggedMACs = len(byMAC)
+
+	inPool := make(map[string]MACAddress, len(pool.Addresses))
+	for _, addr := range pool.Addresses {
+		inPool[standardizeMACFormat(addr.Address)] = addr
+	}
+
+	for mac, entries := range byMAC {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+
+		var succeeded, failed []OperationLogEntry
+		hosts := make(map[string]bool)
+		for _, e := range entries {
+			if !e.Success {
+				failed = append(failed, e)
+				continue
+			}
+			succeeded = append(succeeded, e)
+			if e.Host != "" {
+				hosts[e.Host] = true
+			}
+		}
+
+		addr, known := inPool[mac]
+		switch {
+		case !known && len(succeeded) > 0:
+			report.add(mac, mismatchNotInPool, "successful operation logged for an address that is not in this pool", succeeded)
+		case known && addressState(addr) == stateFree && len(succeeded) > 0:
+			report.add(mac, mismatchLoggedUnused, "successful operation logged, but the pool shows the address as unused", succeeded)
+		case known && addressState(addr) == stateUsed && len(succeeded) == 0 && len(failed) > 0:
+			report.add(mac, mismatchFailedButUsed, "only failed operations logged, but the pool still shows the address as used", failed)
+		}
+
+		if len(hosts) > 1 {
+			names := make([]string, 0, len(hosts))
+			for h := range hosts {
+				names = append(names, h)
+			}
+			sort.Strings(names)
+			report.add(mac, mismatchSeveralHosts, "address written on "+strings.Join(names, ", "), succeeded)
+		}
+	}
+
+	for mac, addr := range inPool {
+		if _, logged := byMAC[mac]; addressState(addr) == stateUsed && !logged {
+			detail := "marked as used"
+			if !addr.UsedAt.IsZero() {
+				detail += " at " + addr.UsedAt.Format("2006-01-02 15:04:05")
+			}
+			if addr.UsedBy != "" {
+				detail += " by " + addr.UsedBy
+			}
+			report.add(mac, mismatchUsedWithoutLog, detail+", but no operation log mentions it", nil)
+		}
+	}
+
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		if report.Mismatches[i].MAC != report.Mismatches[j].MAC {
+			return report.Mismatches[i].MAC < report.Mismatches[j].MAC
+		}
+		return report.Mismatches[i].Kind < report.Mismatches[j].Kind
+	})
+	return report
+}
+
+// add добавляет расхождение в отчёт
+func (r *ReconcileReport) add(mac, kind, detail string, logs []OperationLogEntry) {
+	r.Mismatches = append(r.Mismatches, ReconcileMismatch{MAC: mac, Kind: kind, Detail: detail, Logs: logs})
+}
+
+// printReconcileReport выводит отчёт о сверке и возвращает true, если расхождений нет
+func printReconcileReport(report ReconcileReport) bool {
+	for _, s := range report.Skipped {
+		fmt.Printf(colorYellow+"Skipped %s\n"+colorReset, s)
+	}
+	if len(report.Skipped) > 0 {
+		fmt.Println()
+	}
+
+	counts := make(map[string]int)
+	for _, m := range report.Mismatches {
+		counts[m.Kind]++
+
+		color := colorRed
+		if m.Kind == mismatchUsedWithoutLog || m.Kind == mismatchNotInPool {
+			color = colorYellow
+		}
+		fmt.Printf("%s%-17s%s %s\n", color, m.Kind, colorReset, m.MAC)
+		fmt.Printf("                  %s\n", m.Detail)
+		for _, l := range m.Logs {
+			result := "failed"
+			if l.Success {
+				result = "success"
+			}
+			host := l.Host
+			if host == "" {
+				host = "unknown host"
+			}
+			fmt.Printf("                  %s  %s (%s)  %s  %s\n", l.Timestamp, l.Action, result, host, l.Source)
+		}
+	}
+
+	fmt.Printf("\nRead %d log(s) mentioning %d MAC address(es), skipped %d\n", report.LogsRead, report.LoggedMACs, len(report.Skipped))
+	if len(report.Mismatches) == 0 {
+		fmt.Println(colorGreen + "Pool and operation logs are consistent" + colorReset)
+		return true
+	}
+	fmt.Printf(colorRed+"Found %d mismatch(es):"+colorReset+" %d used without log, %d logged but unused, %d not in pool, %d on several hosts, %d failed but used\n",
+		len(report.Mismatches), counts[mismatchUsedWithoutLog], counts[mismatchLoggedUnused], counts[mismatchNotInPool],
+		counts[mismatchSeveralHosts], counts[mismatchFailedButUsed])
+	return false
+}
+
+// runReconcileCommand сверяет пул с логами без интерактивного меню и возвращает код завершения
+func runReconcileCommand(poolFile, logsSource string) int {
+	if poolFile == "" {
+		fmt.Fprintln(os.Stderr, "-file is required with -reconcile")
+		return 2
+	}
+	pool, _, err := loadAndDecryptPool(poolFile)
+	if err != nil {
+		fmt.Println(colorRed+"Error:"+colorReset, err)
+		return 1
+	}
+	logs, skipped, err := readOperationLogs(logsSource)
+	if err != nil {
+		fmt.Println(colorRed+"Error:"+colorReset, err)
+		return 1
+	}
+
+	report := reconcilePool(pool, logs)
+	report.Skipped = skipped
+	if !printReconcileReport(report) {
+		return 1
+	}
+	return 0
+}
+
+// reconcilePoolWithLogs - пункт меню сверки пула с логами операций
+func reconcilePoolWithLogs(poolFile string) error {
+	clearScreen()
+	showHeader()
+	fmt.Println("Reconcile Pool with Operation Logs")
+	fmt.Println()
+
+	pool, _, err := loadAndDecryptPool(poolFile)
+	if err != nil {
+		showErrorAndWait(err)
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("Log directory or collector URL (https://...): ")
+	source, _ := reader.ReadString('\n')
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return nil
+	}
+
+	logs, skipped, err := readOperationLogs(source)
+	if err != nil {
+		showErrorAndWait(err)
+		return err
+	}
+	if len(logs) == 0 {
+		err := errors.New("no operation logs found")
+		showErrorAndWait(err)
+		return err
+	}
+
+	report := reconcilePool(pool, logs)
+	report.Skipped = skipped
+	fmt.Println()
+	printReconcileReport(report)
+	waitForEnter("")
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReconcilePool(t *testing.T) {
+	pool := MACPool{Addresses: []MACAddress{
+		{Address: "00:E0:4C:00:00:01", Used: true, State: stateUsed},
+		{Address: "00:E0:4C:00:00:02", Used: true, State: stateUsed, UsedAt: time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local), UsedBy: "host-a eth0"},
+		{Address: "00:e0:4c:00:00:03"},
+		{Address: "00:E0:4C:00:00:04", Used: true, State: stateUsed},
+		{Address: "00:E0:4C:00:00:05", Used: true, State: stateUsed},
+		{Address: "00:E0:4C:00:00:06", Used: true, State: stateQuarantined},
+	}}
+	logs := []OperationLogEntry{
+		{Source: "ok.json", Timestamp: "2026-03-01T10:00:00", MAC: "00:E0:4C:00:00:01", Success: true, Host: "uuid a"},
+		{Source: "unused.json", Timestamp: "2026-03-01T11:00:00", MAC: "00:E0:4C:00:00:03", Success: true, Host: "uuid b"},
+		{Source: "failed.json", Timestamp: "2026-03-01T12:00:00", MAC: "00:E0:4C:00:00:04", Success: false},
+		{Source: "second.json", Timestamp: "2026-03-02T10:00:00", MAC: "00:E0:4C:00:00:05", Success: true, Host: "uuid d"},
+		{Source: "first.json", Timestamp: "2026-03-01T10:00:00", MAC: "00:E0:4C:00:00:05", Success: true, Host: "uuid c"},
+		{Source: "foreign.json", Timestamp: "2026-03-01T13:00:00", MAC: "00:E0:4C:00:00:09", Success: true},
+		{Source: "foreign-failed.json", Timestamp: "2026-03-01T13:00:00", MAC: "00:E0:4C:00:00:0A", Success: false},
+		{Source: "no-mac.json", Timestamp: "2026-03-01T14:00:00", Success: false},
+	}
+
+	report := reconcilePool(pool, logs)
+
+	type mismatch struct{ mac, kind string }
+	var got []mismatch
+	for _, m := range report.Mismatches {
+		got = append(got, mismatch{m.MAC, m.Kind})
+	}
+	want := []mismatch{
+		{"00:E0:4C:00:00:02", mismatchUsedWithoutLog},
+		{"00:E0:4C:00:00:03", mismatchLoggedUnused},
+		{"00:E0:4C:00:00:04", mismatchFailedButUsed},
+		{"00:E0:4C:00:00:05", mismatchSeveralHosts},
+		{"00:E0:4C:00:00:09", mismatchNotInPool},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatches = %v, want %v", got, want)
+	}
+	if report.LogsRead != len(logs) || report.LoggedMACs != 6 {
+		t.Errorf("logs read/logged MACs = %d/%d, want %d/6", report.LogsRead, report.LoggedMACs, len(logs))
+	}
+
+	used := report.Mismatches[0]
+	if used.Detail != "marked as used at 2026-03-01 09:00:00 by host-a eth0, but no operation log mentions it" {
+		t.Errorf("used without log detail = %q", used.Detail)
+	}
+	// Логи расхождения упорядочены по времени
+	several := report.Mismatches[3]
+	if several.Detail != "address written on uuid c, uuid d" || several.Logs[0].Source != "first.json" {
+		t.Errorf("several hosts = %q, logs %+v", several.Detail, several.Logs)
+	}
+}
+
+func TestParseOperationLogHost(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		mac  string
+		host string
+	}{
+		{
+			name: "typed SMBIOS records",
+			log:  `{"mac_address":"00-e0-4c-00-00-01","success":true,"schema_version":2,"system_info":{"system":{"uuid":"4C4C4544-0001","serial_number":"SN1"}}}`,
+			mac:  "00:E0:4C:00:00:01",
+			host: "uuid 4C4C4544-0001",
+		},
+		{
+			name: "placeholder UUID falls back to the serial",
+			log:  `{"mac_address":"00:e0:4c:00:00:01","system_info":{"system":{"uuid":"FFFFFFFF-FFFF-FFFF-FFFF-FFFFFFFFFFFF","serial_number":"SN1"}}}`,
+			mac:  "00:E0:4C:00:00:01",
+			host: "serial SN1",
+		},
+		{
+			name: "host name without DMI",
+			log:  `{"host_info":{"hostname":"bench-3"}}`,
+			host: "host bench-3",
+		},
+		{
+			name: "unknown host name",
+			log:  `{"host_info":{"hostname":"unknown"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := parseOperationLog("test.json", []byte(tt.log))
+			if err != nil {
+				t.Fatalf("parseOperationLog: %v", err)
+			}
+			if entry.MAC != tt.mac || entry.Host != tt.host {
+				t.Errorf("mac/host = %q/%q, want %q/%q", entry.MAC, entry.Host, tt.mac, tt.host)
+			}
+		})
+	}
+
+	if _, err := parseOperationLog("bad.json", []byte("not json")); err == nil {
+		t.Error("parseOperationLog accepted invalid JSON")
+	}
+}
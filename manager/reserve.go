@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isReserved проверяет, что адрес зарезервирован и срок резервирования не истёк.
+// Так же резервирование понимает MAC Flasher
+func isReserved(addr MACAddress) bool {
+	if !addr.Reserved {
+		return false
+	}
+	return addr.Reservation == nil || addr.Reservation.ExpiresAt.IsZero() || time.Now().Before(addr.Reservation.ExpiresAt)
+}
+
+// reservationExpired проверяет, что адрес помечен зарезервированным, но срок резервирования истёк
+func reservationExpired(addr MACAddress) bool {
+	return addr.Reserved && !isReserved(addr)
+}
+
+// reservationSummary кратко описывает резервирование для списков
+func reservationSummary(addr MACAddress) string {
+	r := addr.Reservation
+	if r == nil {
+		return "no reason recorded"
+	}
+	summary := r.Reason
+	if r.Owner != "" {
+		summary += ", owner " + r.Owner
+	}
+	if !r.ExpiresAt.IsZero() {
+		if reservationExpired(addr) {
+			summary += ", expired " + r.ExpiresAt.Format("2006-01-02")
+		} else {
+			summary += ", until " + r.ExpiresAt.Format("2006-01-02")
+		}
+	}
+	return summary
+}
+
+// reservationGroupKey возвращает владельца и причину резервирования для группировки
+func reservationGroupKey(addr MACAddress) (owner, reason string) {
+	owner, reason = "(no owner)", "(no reason)"
+	if r := addr.Reservation; r != nil {
+		if r.Owner != "" {
+			owner = r.Owner
+		}
+		if r.Reason != "" {
+			reason = r.Reason
+		}
+	}
+	return owner, reason
+}
+
+// ReservationGroup - адреса одного владельца с одной причиной резервирования
+type ReservationGroup struct {
+	Owner     string
+	Reason    string
+	Addresses []MACAddress
+	Expired   int
+}
+
+// groupReservations группирует зарезервированные адреса (включая истёкшие) по владельцу и причине
+func groupReservations(pool MACPool) []ReservationGroup {
+	index := make(map[[2]string]int)
+	var groups []ReservationGroup
+	for _, addr := range pool.Addresses {
+		if !addr.Reserved {
+			continue
+		}
+		owner, reason := reservationGroupKey(addr)
+		key := [2]string{owner, reason}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, ReservationGroup{Owner: owner, Reason: reason})
+		}
+		groups[i].Addresses = append(groups[i].Addresses, addr)
+		if reservationExpired(addr) {
+			groups[i].Expired++
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Owner != groups[j].Owner {
+			return groups[i].Owner < groups[j].Owner
+		}
+		return groups[i].Reason < groups[j].Reason
+	})
+	return groups
+}
+
+// printReservationGroups выводит зарезервированные адреса по владельцам и причинам
+func printReservationGroups(pool MACPool, withAddresses bool) {
+	groups := groupReservations(pool)
+	if len(groups) == 0 {
+		fmt.Println(colorYellow + "No reserved addresses in pool." + colorReset)
+		return
+	}
+
+	for _, g := range groups {
+		fmt.Printf("%s%s%s - %s: %d address(es)", colorCyan, g.Owner, colorReset, g.Reason, len(g.Addresses))
+		if g.Expired > 0 {
+			fmt.Printf(colorYellow+" (%d expired)"+colorReset, g.Expired)
+		}
+		fmt.Println()
+		if !withAddresses {
+			continue
+		}
+		for _, addr := range g.Addresses {
+			line := "    " + addr.Address
+			if r := addr.Reservation; r != nil {
+				if !r.ReservedAt.IsZero() {
+					line += "  reserved " + r.ReservedAt.Format("2006-01-02")
+					if r.ReservedBy != "" {
+						line += " by " + r.ReservedBy
+					}
+				}
+				if !r.ExpiresAt.IsZero() {
+					line += ", expires " + r.ExpiresAt.Format("2006-01-02")
+				}
+			}
+			if addr.Used {
+				line += "  (used)"
+			}
+			if reservationExpired(addr) {
+				fmt.Println(colorYellow + line + "  EXPIRED" + colorReset)
+			} else {
+				fmt.Println(line)
+			}
+		}
+	}
+}
+
+// matchAddressPattern проверяет MAC-адрес по шаблону: * и ? как в именах файлов,
+// шаблон без подстановочных знаков считается префиксом
+func matchAddressPattern(mac, pattern string) bool {
+	mac = standardizeMACFormat(mac)
+	pattern = standardizeMACFormat(strings.TrimSpace(pattern))
+	if !strings.ContainsAny(pattern, "*?[") {
+		return strings.HasPrefix(mac, pattern)
+	}
+	matched, err := path.Match(pattern, mac)
+	return err == nil && matched
+}
+
+// selectAddresses запрашивает способ выбора адресов и возвращает их индексы в пуле
+func selectAddresses(pool MACPool, reader *bufio.Reader, allowExpired bool) ([]int, error) {
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		value, _ := reader.ReadString('\n')
+		return strings.TrimSpace(value)
+	}
+
+	fmt.Println("\nSelect addresses:")
+	fmt.Println("1. Single MAC address")
+	fmt.Println("2. Range of MAC addresses")
+	fmt.Println("3. Pattern (e.g. 00:1A:2B:00:* or prefix 00:1A:2B:01)")
+	if allowExpired {
+		fmt.Println("4. All expired reservations")
+	}
+	fmt.Println("0. Cancel")
+
+	var indices []int
+	switch ask("\nSelect option: ") {
+	case "0", "":
+		return nil, nil
+
+	case "1":
+		mac := ask("MAC address: ")
+		if !isMACValid(mac) {
+			return nil, errors.New("invalid MAC address format")
+		}
+		mac = standardizeMACFormat(mac)
+		for i, addr := range pool.Addresses {
+			if standardizeMACFormat(addr.Address) == mac {
+				indices = append(indices, i)
+			}
+		}
+		if len(indices) == 0 {
+			return nil, fmt.Errorf("MAC address %s not found in pool", mac)
+		}
+
+	case "2":
+		low, err := macToUint64(ask("Range start MAC: "))
+		if err != nil {
+			return nil, fmt.Errorf("invalid range start: %v", err)
+		}
+		high, err := macToUint64(ask("Range end MAC: "))
+		if err != nil {
+			return nil, fmt.Errorf("invalid range end: %v", err)
+		}
+		if low > high {
+			return nil, errors.New("range start is greater than range end")
+		}
+		for i, addr := range pool.Addresses {
+			if value, err := macToUint64(addr.Address); err == nil && value >= low && value <= high {
+				indices = append(indices, i)
+			}
+		}
+
+	case "3":
+		pattern := ask("Pattern: ")
+		if pattern == "" {
+			return nil, errors.New("empty pattern")
+		}
+		if _, err := path.Match(standardizeMACFormat(pattern), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %v", err)
+		}
+		for i, addr := range pool.Addresses {
+			if matchAddressPattern(addr.Address, pattern) {
+				indices = append(indices, i)
+			}
+		}
+
+	case "4":
+		if !allowExpired {
+			return nil, errors.New("invalid option")
+		}
+		for i, addr := range pool.Addresses {
+			if reservationExpired(addr) {
+				indices = append(indices, i)
+			}
+		}
+
+	default:
+		return nil, errors.New("invalid option")
+	}
+
+	if len(indices) == 0 {
+		return nil, errors.New("no addresses in pool match the selection")
+	}
+	return indices, nil
+}
+
+// parseExpiry разбирает срок резервирования: дата YYYY-MM-DD (до конца дня) или число дней, например 30d
+func parseExpiry(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(strings.ToLower(value), "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return time.Time{}, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Now().AddDate(0, 0, n), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry %q, expected YYYY-MM-DD or number of days like 30d", value)
+	}
+	expires := day.Add(24*time.Hour - time.Second)
+	if expires.Before(time.Now()) {
+		return time.Time{}, errors.New("expiry date is in the past")
+	}
+	return expires, nil
+}
+
+// reserveAddresses резервирует выбранные адреса. Возвращает true, если пул изменён
+func reserveAddresses(pool *MACPool, reader *bufio.Reader) (bool, error) {
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		value, _ := reader.ReadString('\n')
+		return strings.TrimSpace(value)
+	}
+
+	indices, err := selectAddresses(*pool, reader, false)
+	if err != nil || len(indices) == 0 {
+		return false, err
+	}
+
+	var candidates []int
+	used, updated := 0, 0
+	for _, idx := range indices {
+		addr := pool.Addresses[idx]
+		if addressState(addr) != stateFree {
+			used++
+			continue
+		}
+		if addr.Reserved {
+			updated++
+		}
+		candidates = append(candidates, idx)
+	}
+	fmt.Printf("\nSelected %d address(es)", len(indices))
+	if used > 0 {
+		fmt.Printf(colorYellow+", %d not free and will be skipped"+colorReset, used)
+	}
+	if updated > 0 {
+		fmt.Printf(", %d already reserved will get the new reservation", updated)
+	}
+	fmt.Println()
+	if len(candidates) == 0 {
+		return false, errors.New("no unused addresses to reserve")
+	}
+
+	reason := ask("Reason (required): ")
+	if reason == "" {
+		return false, errors.New("a reservation reason is required")
+	}
+
+	owner := os.Getenv("USER")
+	if owner != "" {
+		if input := ask(fmt.Sprintf("Owner [%s]: ", owner)); input != "" {
+			owner = input
+		}
+	} else {
+		owner = ask("Owner (required): ")
+	}
+	if owner == "" {
+		return false, errors.New("a reservation owner is required")
+	}
+
+	expires, err := parseExpiry(ask("Expires (YYYY-MM-DD, number of days like 30d, empty for never): "))
+	if err != nil {
+		return false, err
+	}
+	comment := ask("Comment (optional, empty keeps the current one): ")
+
+	if !getYesNoConfirmation(fmt.Sprintf("Reserve %d address(es) for %s", len(candidates), owner)) {
+		return false, nil
+	}
+
+	now := time.Now()
+	for _, idx := range candidates {
+		pool.Addresses[idx].Reserved = true
+		pool.Addresses[idx].Reservation = &Reservation{
+			Reason:     reason,
+			Owner:      owner,
+			ReservedAt: now,
+			ReservedBy: os.Getenv("USER"),
+			ExpiresAt:  expires,
+		}
+		if comment != "" {
+			pool.Addresses[idx].Comment = comment
+		}
+	}
+	fmt.Printf(colorGreen+"Reserved %d address(es).\n"+colorReset, len(candidates))
+	return true, nil
+}
+
+// unreserveAddresses снимает резервирование с выбранных адресов. Возвращает true, если пул изменён
+func unreserveAddresses(pool *MACPool, reader *bufio.Reader) (bool, error) {
+	indices, err := selectAddresses(*pool, reader, true)
+	if err != nil || len(indices) == 0 {
+		return false, err
+	}
+
+	var reserved []int
+	for _, idx := range indices {
+		if pool.Addresses[idx].Reserved {
+			reserved = append(reserved, idx)
+		}
+	}
+	if len(reserved) == 0 {
+		return false, errors.New("none of the selected addresses are reserved")
+	}
+
+	fmt.Println()
+	for _, idx := range reserved {
+		addr := pool.Addresses[idx]
+		fmt.Printf("  %s - %s\n", addr.Address, reservationSummary(addr))
+	}
+	if !getYesNoConfirmation(fmt.Sprintf("Release %d reservation(s)", len(reserved))) {
+		return false, nil
+	}
+
+	for _, idx := range reserved {
+		pool.Addresses[idx].Reserved = false
+		pool.Addresses[idx].Reservation = nil
+	}
+	fmt.Printf(colorGreen+"Released %d reservation(s).\n"+colorReset, len(reserved))
+	return true, nil
+}
+
+// manageReservations - меню резервирования адресов
+func manageReservations(poolFile string) error {
+	pool, password, err := loadAndDecryptPool(poolFile)
+	if err != nil {
+		fmt.Println(colorRed+"Failed to load MAC pool:"+colorReset, err)
+		waitForEnter("")
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	changed := false
+
+	for {
+		clearScreen()
+		showHeader()
+		fmt.Println("Address Reservations")
+		fmt.Println()
+		printReservationGroups(pool, false)
+
+		fmt.Println("\nOptions:")
+		fmt.Println("1. Reserve addresses")
+		fmt.Println("2. Release reservations")
+		fmt.Println("3. List reserved addresses")
+		fmt.Println("0. Save and return")
+
+		fmt.Print("\nSelect option: ")
+		choice, _ := reader.ReadString('\n')
+		choice = strings.TrimSpace(choice)
+
+		switch choice {
+		case "0":
+			if !changed {
+				return nil
+			}
+			pool.LastUpdated = time.Now()
+			signPool(&pool, password)
+			if err := saveEncryptedPool(pool, password, poolFile); err != nil {
+				fmt.Println(colorRed+"Failed to save pool:"+colorReset, err)
+				waitForEnter("")
+				return err
+			}
+			fmt.Println(colorGreen + "Reservations saved successfully!" + colorReset)
+			time.Sleep(1 * time.Second)
+			return nil
+
+		case "1":
+			modified, err := reserveAddresses(&pool, reader)
+			if err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			changed = changed || modified
+			time.Sleep(1 * time.Second)
+
+		case "2":
+			modified, err := unreserveAddresses(&pool, reader)
+			if err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			changed = changed || modified
+			time.Sleep(1 * time.Second)
+
+		case "3":
+			fmt.Println()
+			printReservationGroups(pool, true)
+			fmt.Println()
+			waitForEnter("")
+
+		default:
+			fmt.Println(colorRed + "Invalid option, please try again." + colorReset)
+			time.Sleep(1 * time.Second)
+		}
+	}
+}
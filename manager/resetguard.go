@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Действия, которые записываются в журнал пула
+const (
+	eventReset = "reset" // адреса возвращены в свободные
+)
+
+// approverHashSize - длина хэша пароля подтверждающего
+const approverHashSize = 32
+
+// hashApproverPassword вычисляет хэш пароля подтверждающего
+func hashApproverPassword(password string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(password), salt, iterations, approverHashSize, sha256.New)
+}
+
+// newApprover создаёт подтверждающего с новой солью
+func newApprover(name, password string) (Approver, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return Approver{}, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	return Approver{
+		Name: name,
+		Salt: base64.StdEncoding.EncodeToString(salt),
+		Hash: base64.StdEncoding.EncodeToString(hashApproverPassword(password, salt)),
+	}, nil
+}
+
+// checkApproverPassword проверяет пароль подтверждающего
+func checkApproverPassword(a Approver, password string) bool {
+	salt, err := base64.StdEncoding.DecodeString(a.Salt)
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(a.Hash)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, hashApproverPassword(password, salt)) == 1
+}
+
+// approversFileName - файл подтверждающих сброс в домашнем каталоге администратора пула
+const approversFileName = ".mac_pool_approvers.json"
+
+// approversPath возвращает путь к списку подтверждающих. Список хранится вне пула: пароль пула
+// знают все станции прошивки, и тот, кто может расшифровать пул, не должен менять подтверждающих
+func approversPath() (string, error) {
+	if appConfig.ApproversFile != "" {
+		return appConfig.ApproversFile, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %v", err)
+	}
+	return filepath.Join(homeDir, approversFileName), nil
+}
+
+// loadApprovers читает список подтверждающих; отсутствующий файл - пустой список
+func loadApprovers() ([]Approver, error) {
+	path, err := approversPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approvers file: %v", err)
+	}
+	var approvers []Approver
+	if err := json.Unmarshal(data, &approvers); err != nil {
+		return nil, fmt.Errorf("failed to parse approvers file %s: %v", path, err)
+	}
+	return approvers, nil
+}
+
+// saveApprovers записывает список подтверждающих с правами только для владельца
+func saveApprovers(approvers []Approver) error {
+	path, err := approversPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(approvers, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode approvers: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write approvers file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write approvers file: %v", err)
+	}
+	return nil
+}
+
+// resetApprovers возвращает подтверждающих, чей пароль нужен для сброса. Подтверждающие,
+// записанные в пул прежними версиями, действуют, пока файл подтверждающих пуст
+func resetApprovers(pool MACPool) ([]Approver, error) {
+	approvers, err := loadApprovers()
+	if err != nil {
+		return nil, err
+	}
+	if len(approvers) == 0 {
+		return pool.Approvers, nil
+	}
+	return approvers, nil
+}
+
+// findApprover ищет подтверждающего по имени без учёта регистра
+func findApprover(approvers []Approver, name string) (Approver, bool) {
+	for _, a := range approvers {
+		if strings.EqualFold(a.Name, name) {
+			return a, true
+		}
+	}
+	return Approver{}, false
+}
+
+// requestApproval запрашивает имя и пароль второго подтверждающего. Оператор не может подтвердить сам себя
+func requestApproval(approvers []Approver, reader *bufio.Reader, operator string) (string, error) {
+	fmt.Print("Approver name: ")
+	name, _ := reader.ReadString('\n')
+	name = strings.TrimSpace(name)
+
+	approver, ok := findApprover(approvers, name)
+	if !ok {
+		return "", fmt.Errorf("%q is not a configured approver", name)
+	}
+	if operator != "" && strings.EqualFold(approver.Name, operator) {
+		return "", errors.New("the approver must be a different person than the operator")
+	}
+
+	fmt.Printf("Password for approver %s: ", approver.Name)
+	password, err := readPassword(reader)
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %v", err)
+	}
+	if !checkApproverPassword(approver, string(password)) {
+		return "", errors.New("approver password is incorrect")
+	}
+	return approver.Name, nil
+}
+
+// completeLogStore сообщает, что source - сервис сбора логов, в который по настройкам
+// выгружают логи все станции. Только в таком хранилище отсутствие записи об адресе
+// означает, что адрес не прошивался
+func completeLogStore(source string) bool {
+	complete := strings.TrimRight(appConfig.CompleteLogStore, "/")
+	return complete != "" && strings.HasPrefix(source, "https://") && strings.TrimRight(source, "/") == complete
+}
+
+// crossCheckResetWithLogs оставляет в сбросе только адреса, для которых логи подтверждают, что
+// адрес не записан в оборудование: в логах есть неудачная прошивка адреса и нет успешной, либо
+// логи взяты из полного хранилища и об адресе в них нет записей. Возвращает оставшиеся индексы
+// и описание сверки для журнала
+func crossCheckResetWithLogs(pool MACPool, indices []int, reader *bufio.Reader) ([]int, string, error) {
+	source := appConfig.LogSource
+	if source != "" {
+		fmt.Printf("Log directory or collector URL [%s]: ", source)
+	} else {
+		fmt.Print("Log directory or collector URL (https://...): ")
+	}
+	input, _ := reader.ReadString('\n')
+	if input = strings.TrimSpace(input); input != "" {
+		source = input
+	}
+	if source == "" {
+		return nil, "", errors.New("no log source specified")
+	}
+
+	logs, skipped, err := readOperationLogs(source)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(logs) == 0 {
+		return nil, "", fmt.Errorf("no operation logs found in %s", source)
+	}
+	appConfig.LogSource = source
+	saveConfig()
+	if len(skipped) > 0 {
+		fmt.Printf(colorYellow+"Skipped %d unreadable log(s)\n"+colorReset, len(skipped))
+	}
+	// Хранилище с нечитаемыми логами нельзя считать полным
+	complete := completeLogStore(source) && len(skipped) == 0
+
+	remaining, failedLogged, absent := resetByLogs(pool, indices, logs, complete)
+	if len(remaining) < len(indices) {
+		fmt.Println(colorYellow + "Skipped addresses can only be reset with a hardware return record." + colorReset)
+	}
+
+	var parts []string
+	if failedLogged > 0 {
+		parts = append(parts, fmt.Sprintf("%d with only failed flashes logged", failedLogged))
+	}
+	if absent > 0 {
+		parts = append(parts, fmt.Sprintf("%d absent from the complete log store", absent))
+	}
+	evidence := fmt.Sprintf("operation logs from %s (%d logs): %s", source, len(logs), strings.Join(parts, ", "))
+	return remaining, evidence, nil
+}
+
+// resetByLogs отбирает адреса, которые логи разрешают сбросить. complete - логи из полного
+// хранилища, тогда сбросить можно и адрес без записей. Возвращает допустимые индексы и число
+// адресов, допущенных по неудачной прошивке и по отсутствию записей
+func resetByLogs(pool MACPool, indices []int, logs []OperationLogEntry, complete bool) ([]int, int, int) {
+	flashed := make(map[string]OperationLogEntry)
+	failed := make(map[string]bool)
+	for _, l := range logs {
+		if l.MAC == "" {
+			continue
+		}
+		if l.Success {
+			flashed[l.MAC] = l
+		} else {
+			failed[l.MAC] = true
+		}
+	}
+
+	var remaining []int
+	failedLogged, absent := 0, 0
+	for _, idx := range indices {
+		mac := standardizeMACFormat(pool.Addresses[idx].Address)
+		switch l, ok := flashed[mac]; {
+		case ok:
+			host := l.Host
+			if host == "" {
+				host = "unknown host"
+			}
+			fmt.Printf(colorRed+"  %s was flashed successfully on %s (%s), skipped\n"+colorReset, mac, l.Timestamp, host)
+		case failed[mac]:
+			remaining = append(remaining, idx)
+			failedLogged++
+		case complete:
+			remaining = append(remaining, idx)
+			absent++
+		default:
+			fmt.Printf(colorYellow+"  %s is not mentioned in the logs, which are not a complete log store, skipped\n"+colorReset, mac)
+		}
+	}
+	return remaining, failedLogged, absent
+}
+
+// guardReset проверяет, что выбранные адреса можно вернуть в свободные: запрашивает причину,
+// сверку с логами операций или запись о возврате оборудования и, если в пуле заданы подтверждающие,
+// пароль второго подтверждающего. Возвращает допустимые индексы и заготовку записи журнала
+func guardReset(pool MACPool, indices []int, reader *bufio.Reader) ([]int, *PoolEvent, error) {
+	if !confirmReleaseBurned(pool, indices) {
+		return nil, nil, nil
+	}
+
+	fmt.Print("\nReason for the reset (required): ")
+	reason, _ := reader.ReadString('\n')
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, nil, errors.New("a reason is required to reset addresses")
+	}
+
+	fmt.Println("\nHow is it confirmed that these addresses are not in shipped hardware?")
+	fmt.Println("1. Cross-check with operation logs (directory or collector)")
+	fmt.Println("2. Hardware return record (RMA or return document number)")
+	fmt.Println("0. Cancel")
+	fmt.Print("\nSelect option: ")
+	choice, _ := reader.ReadString('\n')
+
+	var evidence string
+	switch strings.TrimSpace(choice) {
+	case "1":
+		remaining, summary, err := crossCheckResetWithLogs(pool, indices, reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(remaining) == 0 {
+			return nil, nil, errors.New("the logs do not confirm that any of the selected addresses is unused")
+		}
+		indices, evidence = remaining, summary
+	case "2":
+		fmt.Print("Return record reference: ")
+		ref, _ := reader.ReadString('\n')
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			return nil, nil, errors.New("a return record reference is required")
+		}
+		evidence = "hardware return " + ref
+	default:
+		return nil, nil, nil
+	}
+
+	operator := os.Getenv("USER")
+	event := &PoolEvent{
+		Action:   eventReset,
+		Reason:   reason,
+		Operator: operator,
+		Evidence: evidence,
+	}
+
+	approvers, err := resetApprovers(pool)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(approvers) > 0 {
+		fmt.Println("\nResets require a second approver.")
+		approver, err := requestApproval(approvers, reader, operator)
+		if err != nil {
+			return nil, nil, err
+		}
+		event.Approver = approver
+	}
+	return indices, event, nil
+}
+
+// journalEvent дописывает событие в журнал пула
+func journalEvent(pool *MACPool, event PoolEvent) {
+	event.Time = time.Now()
+	pool.Journal = append(pool.Journal, event)
+}
+
+// printPoolJournal выводит последние записи журнала пула
+func printPoolJournal(pool MACPool, limit int) {
+	if len(pool.Journal) == 0 {
+		fmt.Println("No journal entries.")
+		return
+	}
+	start := 0
+	if limit > 0 && len(pool.Journal) > limit {
+		start = len(pool.Journal) - limit
+	}
+	for _, e := range pool.Journal[start:] {
+		who := e.Operator
+		if who == "" {
+			who = "unknown"
+		}
+		if e.Approver != "" {
+			who += ", approved by " + e.Approver
+		}
+		fmt.Printf("  %s  %s %d address(es) by %s\n", e.Time.Format("2006-01-02 15:04:05"), e.Action, len(e.Addresses), who)
+		fmt.Printf("      reason: %s\n", e.Reason)
+		if e.Evidence != "" {
+			fmt.Printf("      evidence: %s\n", e.Evidence)
+		}
+	}
+}
+
+// manageApprovers - меню подтверждающих сброс адресов. Список хранится в отдельном файле
+// администратора; подтверждающих из пула прежних версий можно перенести в этот файл
+func manageApprovers(poolFile string) error {
+	pool, password, err := loadAndDecryptPool(poolFile)
+	if err != nil {
+		fmt.Println(colorRed+"Failed to load MAC pool:"+colorReset, err)
+		waitForEnter("")
+		return err
+	}
+	approvers, err := loadApprovers()
+	if err != nil {
+		showErrorAndWait(err)
+		return err
+	}
+	path, _ := approversPath()
+
+	reader := bufio.NewReader(os.Stdin)
+	changed, poolChanged := false, false
+
+	for {
+		clearScreen()
+		showHeader()
+		fmt.Println("Reset Approvers")
+		fmt.Println()
+		fmt.Printf("Approvers file: %s\n", path)
+		if len(approvers) == 0 {
+			fmt.Println(colorYellow + "No approvers configured. Resets need a reason and evidence, but no second password." + colorReset)
+		} else {
+			fmt.Println("Resetting used addresses requires the password of one of:")
+			for i, a := range approvers {
+				fmt.Printf("  %d. %s\n", i+1, a.Name)
+			}
+		}
+		if len(pool.Approvers) > 0 {
+			fmt.Printf(colorYellow+"The pool file stores %d approver(s). Anyone with the pool password can change them, move them to the approvers file.\n"+colorReset, len(pool.Approvers))
+		}
+		fmt.Println("\nRecent resets:")
+		printPoolJournal(pool, 5)
+
+		fmt.Println("\nOptions:")
+		fmt.Println("1. Add approver")
+		fmt.Println("2. Remove approver")
+		if len(pool.Approvers) > 0 {
+			fmt.Println("3. Move approvers from the pool file")
+		}
+		fmt.Println("0. Save and return")
+
+		fmt.Print("\nSelect option: ")
+		choice, _ := reader.ReadString('\n')
+		choice = strings.TrimSpace(choice)
+
+		// Менять список может только один из действующих подтверждающих
+		current := approvers
+		if len(current) == 0 {
+			current = pool.Approvers
+		}
+
+		switch choice {
+		case "0":
+			if changed {
+				if err := saveApprovers(approvers); err != nil {
+					showErrorAndWait(err)
+					return err
+				}
+			}
+			if poolChanged {
+				pool.LastUpdated = time.Now()
+				signPool(&pool, password)
+				if err := saveEncryptedPool(pool, password, poolFile); err != nil {
+					fmt.Println(colorRed+"Failed to save pool:"+colorReset, err)
+					waitForEnter("")
+					return err
+				}
+			}
+			if changed || poolChanged {
+				fmt.Println(colorGreen + "Approvers saved successfully!" + colorReset)
+				time.Sleep(1 * time.Second)
+			}
+			return nil
+
+		case "1":
+			if len(current) > 0 {
+				if _, err := requestApproval(current, reader, ""); err != nil {
+					showErrorAndWait(err)
+					continue
+				}
+			}
+			fmt.Print("New approver name: ")
+			name, _ := reader.ReadString('\n')
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, exists := findApprover(approvers, name); exists {
+				showErrorAndWait(fmt.Errorf("approver %s already exists", name))
+				continue
+			}
+
+			fmt.Printf("Password for %s: ", name)
+			first, err := readPassword(reader)
+			fmt.Println()
+			if err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			fmt.Print("Confirm password: ")
+			second, err := readPassword(reader)
+			fmt.Println()
+			if err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			if string(first) != string(second) {
+				showErrorAndWait(errors.New("passwords do not match"))
+				continue
+			}
+			if len(first) < 8 {
+				showErrorAndWait(errors.New("password must be at least 8 characters long"))
+				continue
+			}
+			if string(first) == password {
+				showErrorAndWait(errors.New("the approver password must differ from the pool password"))
+				continue
+			}
+
+			approver, err := newApprover(name, string(first))
+			if err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			if len(approvers) == 0 {
+				// Первый подтверждающий в файле заменяет подтверждающих из пула
+				approvers = append(approvers, pool.Approvers...)
+				if len(pool.Approvers) > 0 {
+					pool.Approvers = nil
+					poolChanged = true
+				}
+			}
+			approvers = append(approvers, approver)
+			changed = true
+
+		case "2":
+			if len(approvers) == 0 {
+				continue
+			}
+			fmt.Print("Enter number of approver to remove: ")
+			input, _ := reader.ReadString('\n')
+			var idx int
+			if _, err := fmt.Sscanf(strings.TrimSpace(input), "%d", &idx); err != nil || idx < 1 || idx > len(approvers) {
+				showErrorAndWait(errors.New("invalid approver number"))
+				continue
+			}
+			if _, err := requestApproval(approvers, reader, ""); err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			approvers = append(approvers[:idx-1], approvers[idx:]...)
+			changed = true
+
+		case "3":
+			if len(pool.Approvers) == 0 {
+				continue
+			}
+			if _, err := requestApproval(current, reader, ""); err != nil {
+				showErrorAndWait(err)
+				continue
+			}
+			for _, a := range pool.Approvers {
+				if _, exists := findApprover(approvers, a.Name); !exists {
+					approvers = append(approvers, a)
+				}
+			}
+			pool.Approvers = nil
+			changed, poolChanged = true, true
+
+		default:
+			fmt.Println(colorRed + "Invalid option, please try again." + colorReset)
+			time.Sleep(1 * time.Second)
+		}
+	}
+}
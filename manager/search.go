@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// bindingFields возвращает поля привязки к оборудованию в виде пар "название - значение"
+func bindingFields(b *HardwareBinding) [][2]string {
+	if b == nil {
+		return nil
+	}
+	fields := [][2]string{
+		{"System UUID", b.SystemUUID},
+		{"System serial", b.SystemSerial},
+		{"Board serial", b.BoardSerial},
+		{"Interface", b.Interface},
+		{"PCI address", b.PCIAddress},
+		{"PCI vendor", b.PCIVendor},
+		{"PCI device", b.PCIDevice},
+		{"PCI subsystem vendor", b.PCISubsystemVendor},
+		{"PCI subsystem device", b.PCISubsystemDevice},
+		{"Previous MAC", b.PreviousMAC},
+	}
+
+	var result [][2]string
+	for _, f := range fields {
+		if f[1] != "" {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// addressMatchesQuery проверяет, содержит ли адрес или его привязка строку поиска
+func addressMatchesQuery(addr MACAddress, query string) bool {
+	query = strings.ToLower(query)
+
+	// MAC-адреса сравниваем без учёта разделителей
+	normalizedQuery := strings.NewReplacer(":", "", "-", "").Replace(query)
+	if normalizedQuery != "" && strings.Contains(strings.NewReplacer(":", "", "-", "").Replace(strings.ToLower(addr.Address)), normalizedQuery) {
+		return true
+	}
+
+	candidates := []string{addr.UsedBy, addr.Comment}
+	if addr.Reservation != nil {
+		candidates = append(candidates, addr.Reservation.Reason, addr.Reservation.Owner)
+	}
+	for _, f := range bindingFields(addr.Binding) {
+		candidates = append(candidates, f[1])
+	}
+	if addr.Binding != nil && addr.Binding.PreviousMAC != "" {
+		candidates = append(candidates, strings.NewReplacer(":", "", "-", "").Replace(addr.Binding.PreviousMAC))
+	}
+
+	for _, c := range candidates {
+		if c != "" && strings.Contains(strings.ToLower(c), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// printAddressDetails выводит полную информацию об адресе и его привязке
+func printAddressDetails(addr MACAddress) {
+	fmt.Printf(colorCyan+"%s"+colorReset+"\n", addr.Address)
+
+	status := "Unused"
+	if state := addressState(addr); state == stateUsed {
+		status = "Used"
+		if addr.UsedAt.Year() > 1 {
+			status += " at " + addr.UsedAt.Format("2006-01-02 15:04:05")
+		}
+	} else if state != stateFree {
+		status = stateLabel(state)
+	}
+	if isReserved(addr) {
+		status += " (Reserved)"
+	} else if addr.Reserved {
+		status += " (Reservation expired)"
+	}
+	fmt.Printf("  %-22s %s\n", "Status:", status)
+
+	if r := addr.Reservation; r != nil {
+		fmt.Printf("  %-22s %s\n", "Reservation reason:", r.Reason)
+		fmt.Printf("  %-22s %s\n", "Reservation owner:", r.Owner)
+		reserved := r.ReservedAt.Format("2006-01-02 15:04:05")
+		if r.ReservedBy != "" {
+			reserved += " by " + r.ReservedBy
+		}
+		fmt.Printf("  %-22s %s\n", "Reserved at:", reserved)
+		if !r.ExpiresAt.IsZero() {
+			fmt.Printf("  %-22s %s\n", "Reservation expires:", r.ExpiresAt.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	if addr.UsedBy != "" {
+		fmt.Printf("  %-22s %s\n", "Used by:", addr.UsedBy)
+	}
+	if addr.Comment != "" {
+		fmt.Printf("  %-22s %s\n", "Comment:", addr.Comment)
+	}
+	for _, f := range bindingFields(addr.Binding) {
+		fmt.Printf("  %-22s %s\n", f[0]+":", f[1])
+	}
+}
+
+// searchAllocations ищет адреса по MAC, UUID, серийным номерам и идентификаторам PCI
+func searchAllocations(poolFile string) error {
+	pool, _, err := loadAndDecryptPool(poolFile)
+	if err != nil {
+		fmt.Println(colorRed+"Failed to load MAC pool:"+colorReset, err)
+		waitForEnter("")
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		clearScreen()
+		showHeader()
+		fmt.Println("Search Allocations")
+		fmt.Println()
+		fmt.Println("Search by MAC, previous MAC, system UUID, system or board serial,")
+		fmt.Println("PCI address or PCI vendor/device ID, host name, comment or reservation reason and owner.")
+		fmt.Print("\nQuery (empty to return): ")
+
+		query, _ := reader.ReadString('\n')
+		query = strings.TrimSpace(query)
+		if query == "" {
+			return nil
+		}
+
+		var matches []MACAddress
+		for _, addr := range pool.Addresses {
+			if addressMatchesQuery(addr, query) {
+				matches = append(matches, addr)
+			}
+		}
+
+		fmt.Println()
+		if len(matches) == 0 {
+			fmt.Println(colorYellow + "No matching addresses found." + colorReset)
+		} else {
+			fmt.Printf(colorGreen+"Found %d matching addresses:\n\n"+colorReset, len(matches))
+			for _, addr := range matches {
+				printAddressDetails(addr)
+				fmt.Println()
+			}
+		}
+
+		waitForEnter("Press ENTER to search again...")
+	}
+}